@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Names of the built-in backends
+const (
+	BackendAerospike = "aerospike"
+	BackendMemory    = "memory"
+	BackendRedis     = "redis"
+)
+
+// Backend stores the encoded values of a cache, see NewRepository. All the backends share
+// the semantics checked by cachetest.RunConformance.
+type Backend interface {
+	// Set stores value under key, replacing its previous value and expiry. An exp of zero
+	// (or less) keeps the value until it is deleted or evicted.
+	Set(ctx context.Context, key string, value []byte, exp time.Duration) error
+
+	// Get returns the value of key, or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Delete removes the value of key, deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+
+	// Close releases the resources of the backend
+	Close() error
+}
+
+// BackendFactory creates a backend out of the configuration of a cache
+type BackendFactory func(config *Config) (Backend, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]BackendFactory)
+)
+
+// RegisterBackend makes a backend available under the given name, typically from the init
+// function of the package implementing it. It panics if the name is already registered.
+func RegisterBackend(name string, factory BackendFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if factory == nil {
+		panic("cache: nil factory for backend " + name)
+	}
+	if _, ok := backends[name]; ok {
+		panic("cache: backend " + name + " registered twice")
+	}
+	backends[name] = factory
+}
+
+// Backends returns the names of the registered backends, sorted
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// NewBackend creates the backend selected by config.Backend
+func NewBackend(config *Config) (Backend, error) {
+	name := config.Backend
+	if name == "" {
+		name = BackendAerospike
+	}
+
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+	}
+	return factory(config)
+}
+
+// New creates a cache of values of type T on the backend selected by config.Backend
+func New[T any](config *Config) (Repository[T], error) {
+	backend, err := NewBackend(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewRepository[T](backend), nil
+}
+
+var _ Repository[any] = &BackendRepo[any]{}
+
+// BackendRepo is a cache of values of type T stored in a Backend. Values implementing
+// encoding.BinaryMarshaler (and encoding.BinaryUnmarshaler through a pointer) are stored
+// in their binary form, other values as JSON.
+type BackendRepo[T any] struct {
+	backend Backend
+}
+
+// NewRepository returns a cache of values of type T stored in backend
+func NewRepository[T any](backend Backend) *BackendRepo[T] {
+	return &BackendRepo[T]{backend: backend}
+}
+
+// Set implements `Set()` method from cache's interface
+func (r *BackendRepo[T]) Set(ctx context.Context, key any, value T, exp time.Duration) error {
+	k, err := keyString(key)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if marshaler, ok := any(value).(encoding.BinaryMarshaler); ok {
+		data, err = marshaler.MarshalBinary()
+	} else {
+		data, err = json.Marshal(value)
+	}
+	if err != nil {
+		return fmt.Errorf("cache: encode %T: %w", value, err)
+	}
+	return r.backend.Set(ctx, k, data, exp)
+}
+
+// Get implements `Get()` method from cache's interface
+func (r *BackendRepo[T]) Get(ctx context.Context, key any) (T, error) {
+	var result T
+	k, err := keyString(key)
+	if err != nil {
+		return result, err
+	}
+
+	data, err := r.backend.Get(ctx, k)
+	if err != nil {
+		return result, err
+	}
+
+	if unmarshaler, ok := any(&result).(encoding.BinaryUnmarshaler); ok {
+		err = unmarshaler.UnmarshalBinary(data)
+	} else {
+		err = json.Unmarshal(data, &result)
+	}
+	if err != nil {
+		return result, fmt.Errorf("cache: decode %T: %w", result, err)
+	}
+	return result, nil
+}
+
+// Delete implements `Delete()` method from cache's interface
+func (r *BackendRepo[T]) Delete(ctx context.Context, key any) error {
+	k, err := keyString(key)
+	if err != nil {
+		return err
+	}
+	return r.backend.Delete(ctx, k)
+}
+
+// Close closes the backend of the cache
+func (r *BackendRepo[T]) Close() error {
+	return r.backend.Close()
+}
+
+// keyString converts a key to the string it is stored under, integers are formatted in
+// base 10 so that 42 and "42" are the same key
+func keyString(key any) (string, error) {
+	switch k := key.(type) {
+	case string:
+		return k, nil
+	case []byte:
+		return string(k), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(k), nil
+	case fmt.Stringer:
+		return k.String(), nil
+	default:
+		return "", fmt.Errorf("%w: %T", ErrInvalidKey, key)
+	}
+}
@@ -0,0 +1,35 @@
+package cache_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/swarit-pandey/e-commerce/common/cache"
+	"github.com/swarit-pandey/e-commerce/common/cache/cachetest"
+)
+
+func TestConformance(t *testing.T) {
+	t.Run("memory", func(t *testing.T) { cachetest.RunConformance(t, cachetest.Memory) })
+	t.Run("redis", func(t *testing.T) { cachetest.RunConformance(t, newRedis) })
+}
+
+// newRedis returns a redis backend on an in-process server, whose clock advances without
+// waiting
+func newRedis(t *testing.T) (cache.Backend, func(d time.Duration)) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	port, err := strconv.Atoi(server.Port())
+	if err != nil {
+		t.Fatalf("parse redis port: %v", err)
+	}
+
+	backend, err := cache.NewBackend(&cache.Config{Backend: cache.BackendRedis, URL: server.Host(), Port: port, Set: "test"})
+	if err != nil {
+		t.Fatalf("create redis backend: %v", err)
+	}
+	t.Cleanup(func() { backend.Close() })
+	return backend, server.FastForward
+}
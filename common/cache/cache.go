@@ -5,6 +5,7 @@ import (
 	"encoding"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	aero "github.com/aerospike/aerospike-client-go/v7"
@@ -61,13 +62,20 @@ func (r *AeroRepo[T]) Set(ctx context.Context, key any, value T, exp time.Durati
 		return err
 	}
 
+	// TTLs are whole seconds on aerospike, values without expiry are kept until deleted
+	ttl := uint32(aero.TTLDontExpire)
+	if exp > 0 {
+		ttl = uint32(math.Ceil(exp.Seconds()))
+	}
+
 	bins := aero.BinMap{r.bin: value}
-	policy := aero.NewWritePolicy(0, uint32(exp.Seconds()))
+	policy := aero.NewWritePolicy(0, ttl)
 	return r.client.Put(policy, aerokey, bins)
 }
 
+// Delete implements `Delete()` method from cache's interface
 func (r *AeroRepo[T]) Delete(ctx context.Context, key any) error {
-	aerokey, err := aero.NewKey(r.ns, r.bin, key)
+	aerokey, err := aero.NewKey(r.ns, r.set, key)
 	if err != nil {
 		klog.ErrorS(err, "cache: aerokey error")
 		return err
@@ -89,7 +97,7 @@ func (r *AeroRepo[T]) Delete(ctx context.Context, key any) error {
 // Get implements `Get()` method from cache's interface
 func (r *AeroRepo[T]) Get(ctx context.Context, key any) (T, error) {
 	var result T
-	aerokey, err := aero.NewKey(r.ns, r.bin, key)
+	aerokey, err := aero.NewKey(r.ns, r.set, key)
 	if err != nil {
 		klog.ErrorS(err, "cache: aero get error")
 		return result, err
@@ -131,6 +139,11 @@ func (r *AeroRepo[T]) Get(ctx context.Context, key any) (T, error) {
 
 // deserializeRecord will deserialize an Aerospike's record to a type T (type T should implment `encoding` interface)
 func deserializeRecord[T any](value any) (T, error) {
+	// Values already of type T, such as the []byte of the aerospike backend, are returned as is
+	if result, ok := value.(T); ok {
+		return result, nil
+	}
+
 	var result T
 
 	switch v := value.(type) {
@@ -158,3 +171,39 @@ func deserializeRecord[T any](value any) (T, error) {
 
 	return result, nil
 }
+
+func init() {
+	RegisterBackend(BackendAerospike, func(config *Config) (Backend, error) {
+		repo, err := NewAero[[]byte](config)
+		if err != nil {
+			return nil, err
+		}
+		return &aeroBackend{repo: repo}, nil
+	})
+}
+
+// aeroBackend stores the encoded values of a cache in the bin of an AeroRepo
+type aeroBackend struct {
+	repo *AeroRepo[[]byte]
+}
+
+func (b *aeroBackend) Set(ctx context.Context, key string, value []byte, exp time.Duration) error {
+	return b.repo.Set(ctx, key, value, exp)
+}
+
+func (b *aeroBackend) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := b.repo.Get(ctx, key)
+	if errors.Is(err, aero.ErrKeyNotFound) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (b *aeroBackend) Delete(ctx context.Context, key string) error {
+	return b.repo.Delete(ctx, key)
+}
+
+func (b *aeroBackend) Close() error {
+	b.repo.client.Close()
+	return nil
+}
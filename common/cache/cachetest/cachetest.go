@@ -0,0 +1,281 @@
+// Package cachetest checks that the cache backends share the semantics of cache.Backend,
+// see RunConformance.
+package cachetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/cache"
+)
+
+// NewBackend creates an empty backend for a subtest, along with a function advancing the
+// clock the backend expires its entries by
+type NewBackend func(t *testing.T) (cache.Backend, func(d time.Duration))
+
+// Memory returns a memory backend, whose clock advances by sleeping
+func Memory(t *testing.T) (cache.Backend, func(d time.Duration)) {
+	t.Helper()
+
+	backend, err := cache.NewBackend(&cache.Config{Backend: cache.BackendMemory})
+	if err != nil {
+		t.Fatalf("create memory backend: %v", err)
+	}
+	t.Cleanup(func() { backend.Close() })
+	return backend, time.Sleep
+}
+
+// Item is the value exercised by RunConformance
+type Item struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+// RunConformance checks that a backend behaves as cache.Backend documents it, through a
+// cache.Repository of items. newBackend is called by every subtest, typically Memory, or
+// a function creating a redis backend on an in-process server such as miniredis, which
+// the package leaves to the tests so that it does not depend on it:
+//
+//	func TestConformance(t *testing.T) {
+//		t.Run("memory", func(t *testing.T) { cachetest.RunConformance(t, cachetest.Memory) })
+//		t.Run("redis", func(t *testing.T) { cachetest.RunConformance(t, newRedis) })
+//	}
+func RunConformance(t *testing.T, newBackend NewBackend) {
+	t.Helper()
+
+	for _, c := range conformanceCases {
+		t.Run(c.name, func(t *testing.T) {
+			backend, advance := newBackend(t)
+			c.run(t, context.Background(), backend, advance)
+		})
+	}
+}
+
+type conformanceCase struct {
+	name string
+	run  func(t *testing.T, ctx context.Context, backend cache.Backend, advance func(time.Duration))
+}
+
+var conformanceCases = []conformanceCase{
+	{"missing", testMissing},
+	{"set and get", testSetGet},
+	{"overwrite", testOverwrite},
+	{"delete", testDelete},
+	{"expiry", testExpiry},
+	{"overwrite expiry", testOverwriteExpiry},
+	{"keys", testKeys},
+	{"values are copied", testCopies},
+}
+
+// ttl is the expiry of the entries of the expiry cases, they are read after advancing the
+// clock by twice as much
+const ttl = 50 * time.Millisecond
+
+func expectError(t *testing.T, what string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s: got error %v, want %v", what, err, want)
+	}
+}
+
+func expectItem(t *testing.T, ctx context.Context, repo cache.Repository[Item], key any, want Item) {
+	t.Helper()
+
+	got, err := repo.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("get %v: %v", key, err)
+	}
+	if got.Name != want.Name || got.Count != want.Count || !slices.Equal(got.Tags, want.Tags) {
+		t.Errorf("get %v: got %+v, want %+v", key, got, want)
+	}
+}
+
+func testMissing(t *testing.T, ctx context.Context, backend cache.Backend, _ func(time.Duration)) {
+	repo := cache.NewRepository[Item](backend)
+
+	_, err := repo.Get(ctx, "missing")
+	expectError(t, "get missing", err, cache.ErrNotFound)
+
+	err = repo.Delete(ctx, "missing")
+	if err != nil {
+		t.Errorf("delete missing: %v", err)
+	}
+}
+
+func testSetGet(t *testing.T, ctx context.Context, backend cache.Backend, _ func(time.Duration)) {
+	repo := cache.NewRepository[Item](backend)
+
+	alpha := Item{Name: "alpha", Count: 1, Tags: []string{"a", "b"}}
+	bravo := Item{Name: "bravo", Count: 2}
+	for key, item := range map[string]Item{"alpha": alpha, "bravo": bravo} {
+		err := repo.Set(ctx, key, item, time.Hour)
+		if err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+	expectItem(t, ctx, repo, "alpha", alpha)
+	expectItem(t, ctx, repo, "bravo", bravo)
+
+	// Empty values are values
+	err := backend.Set(ctx, "empty", []byte{}, 0)
+	if err != nil {
+		t.Fatalf("set empty: %v", err)
+	}
+	value, err := backend.Get(ctx, "empty")
+	if err != nil || len(value) != 0 {
+		t.Errorf("get empty: got %q, %v", value, err)
+	}
+}
+
+func testOverwrite(t *testing.T, ctx context.Context, backend cache.Backend, _ func(time.Duration)) {
+	repo := cache.NewRepository[Item](backend)
+
+	err := repo.Set(ctx, "alpha", Item{Name: "alpha", Tags: []string{"old"}}, time.Hour)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	err = repo.Set(ctx, "alpha", Item{Name: "alpha", Count: 2}, time.Hour)
+	if err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	expectItem(t, ctx, repo, "alpha", Item{Name: "alpha", Count: 2})
+}
+
+func testDelete(t *testing.T, ctx context.Context, backend cache.Backend, _ func(time.Duration)) {
+	repo := cache.NewRepository[Item](backend)
+
+	for _, key := range []string{"alpha", "bravo"} {
+		err := repo.Set(ctx, key, Item{Name: key}, 0)
+		if err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+
+	err := repo.Delete(ctx, "alpha")
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	_, err = repo.Get(ctx, "alpha")
+	expectError(t, "get deleted", err, cache.ErrNotFound)
+	expectItem(t, ctx, repo, "bravo", Item{Name: "bravo"})
+
+	err = repo.Delete(ctx, "alpha")
+	if err != nil {
+		t.Errorf("delete twice: %v", err)
+	}
+
+	// A deleted key can be set again
+	err = repo.Set(ctx, "alpha", Item{Name: "again"}, 0)
+	if err != nil {
+		t.Fatalf("set deleted: %v", err)
+	}
+	expectItem(t, ctx, repo, "alpha", Item{Name: "again"})
+}
+
+func testExpiry(t *testing.T, ctx context.Context, backend cache.Backend, advance func(time.Duration)) {
+	repo := cache.NewRepository[Item](backend)
+
+	err := repo.Set(ctx, "expiring", Item{Name: "expiring"}, ttl)
+	if err != nil {
+		t.Fatalf("set expiring: %v", err)
+	}
+	err = repo.Set(ctx, "kept", Item{Name: "kept"}, 0)
+	if err != nil {
+		t.Fatalf("set without expiry: %v", err)
+	}
+	err = repo.Set(ctx, "negative", Item{Name: "negative"}, -time.Second)
+	if err != nil {
+		t.Fatalf("set with a negative expiry: %v", err)
+	}
+	expectItem(t, ctx, repo, "expiring", Item{Name: "expiring"})
+
+	advance(2 * ttl)
+
+	_, err = repo.Get(ctx, "expiring")
+	expectError(t, "get expired", err, cache.ErrNotFound)
+	expectItem(t, ctx, repo, "kept", Item{Name: "kept"})
+	expectItem(t, ctx, repo, "negative", Item{Name: "negative"})
+
+	// An expired key can be set again
+	err = repo.Set(ctx, "expiring", Item{Name: "again"}, 0)
+	if err != nil {
+		t.Fatalf("set expired: %v", err)
+	}
+	expectItem(t, ctx, repo, "expiring", Item{Name: "again"})
+}
+
+func testOverwriteExpiry(t *testing.T, ctx context.Context, backend cache.Backend, advance func(time.Duration)) {
+	repo := cache.NewRepository[Item](backend)
+
+	// Overwriting replaces the expiry, both ways
+	err := repo.Set(ctx, "extended", Item{Name: "extended"}, ttl)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	err = repo.Set(ctx, "extended", Item{Name: "extended"}, 0)
+	if err != nil {
+		t.Fatalf("overwrite without expiry: %v", err)
+	}
+	err = repo.Set(ctx, "shortened", Item{Name: "shortened"}, 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	err = repo.Set(ctx, "shortened", Item{Name: "shortened"}, ttl)
+	if err != nil {
+		t.Fatalf("overwrite with expiry: %v", err)
+	}
+
+	advance(2 * ttl)
+
+	expectItem(t, ctx, repo, "extended", Item{Name: "extended"})
+	_, err = repo.Get(ctx, "shortened")
+	expectError(t, "get shortened", err, cache.ErrNotFound)
+}
+
+func testKeys(t *testing.T, ctx context.Context, backend cache.Backend, _ func(time.Duration)) {
+	repo := cache.NewRepository[Item](backend)
+
+	// Integers are stored under their decimal form
+	err := repo.Set(ctx, 42, Item{Name: "int"}, 0)
+	if err != nil {
+		t.Fatalf("set int key: %v", err)
+	}
+	expectItem(t, ctx, repo, "42", Item{Name: "int"})
+	expectItem(t, ctx, repo, uint8(42), Item{Name: "int"})
+	expectItem(t, ctx, repo, []byte("42"), Item{Name: "int"})
+
+	err = repo.Set(ctx, struct{}{}, Item{}, 0)
+	expectError(t, "set invalid key", err, cache.ErrInvalidKey)
+	_, err = repo.Get(ctx, 4.2)
+	expectError(t, "get invalid key", err, cache.ErrInvalidKey)
+	err = repo.Delete(ctx, nil)
+	expectError(t, "delete invalid key", err, cache.ErrInvalidKey)
+}
+
+func testCopies(t *testing.T, ctx context.Context, backend cache.Backend, _ func(time.Duration)) {
+	value := []byte("value")
+	err := backend.Set(ctx, "key", value, 0)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	value[0] = 'X'
+
+	got, err := backend.Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !bytes.Equal(got, []byte("value")) {
+		t.Errorf("get after changing the set value: got %q", got)
+	}
+	got[0] = 'X'
+
+	got, err = backend.Get(ctx, "key")
+	if err != nil || !bytes.Equal(got, []byte("value")) {
+		t.Errorf("get after changing the read value: got %q, %v", got, err)
+	}
+}
@@ -1,22 +1,38 @@
 package cache
 
-// Config holds aerospike's configuration
+// Config holds the configuration of a cache backend
 type Config struct {
-	// Aerospike connection URL
-	URL string
+	// Backend names the registered backend storing the entries: aerospike (the default),
+	// memory or redis, see RegisterBackend
+	Backend string
+
+	// URL and Port locate the server of the aerospike and redis backends
+	URL  string
+	Port int
 
 	// Aerospike logging level
 	LogLevel string
 
-	// Port on which Aerospike is running
-	Port int
-
 	// Namespace
 	Namespace string
 
-	// Set
+	// Set groups the entries, it also prefixes the keys of the redis backend
 	Set string
 
 	// Bin
 	Bin string
+
+	// Password and DB select the redis database
+	Password string
+	DB       int
+
+	// MaxEntries and MaxBytes bound the memory backend, the least recently used entries
+	// are evicted past either of them. They default to 100000 entries and 64 MiB, keys and
+	// values counting towards the bytes.
+	MaxEntries int
+	MaxBytes   int64
+
+	// Shards splits the memory backend into independently locked shards (16 by default),
+	// each holding an equal part of MaxEntries and MaxBytes
+	Shards int
 }
@@ -0,0 +1,20 @@
+package cache
+
+import "errors"
+
+var (
+	// ErrNotFound is returned by the backends for keys without a value, either never set,
+	// deleted, expired or evicted
+	ErrNotFound = errors.New("cache: key not found")
+
+	// ErrUnknownBackend is returned for a Config naming a backend that is not registered
+	ErrUnknownBackend = errors.New("cache: unknown backend")
+
+	// ErrInvalidKey is returned for keys that are neither strings, byte slices, integers
+	// nor fmt.Stringer implementations
+	ErrInvalidKey = errors.New("cache: invalid key")
+
+	// ErrTooLarge is returned by the memory backend for entries larger than the bytes
+	// of a shard
+	ErrTooLarge = errors.New("cache: entry too large")
+)
@@ -5,9 +5,9 @@ import (
 	"time"
 )
 
-// Repository defines a simple interface to interact with Aerospike database
+// Repository defines a simple interface to interact with a cache, see New for the backends
 type Repository[T any] interface {
-	// Set will set a type T with TTL
+	// Set will set a type T with TTL, a zero TTL keeps it until it is deleted or evicted
 	Set(ctx context.Context, key any, value T, exp time.Duration) error
 
 	// Get will fetch the result against a given ID
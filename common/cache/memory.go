@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxEntries = 100000
+	defaultMaxBytes   = 64 << 20
+	defaultShards     = 16
+)
+
+func init() {
+	RegisterBackend(BackendMemory, func(config *Config) (Backend, error) {
+		return NewMemoryBackend(config)
+	})
+}
+
+var _ Backend = &MemoryBackend{}
+
+// MemoryBackend is an in-process LRU cache with expiry, bounded by its number of entries
+// and bytes. Keys are spread over shards, each with its own lock and LRU list, so that
+// concurrent requests seldom contend. Expired entries are dropped when they are read or
+// evicted.
+type MemoryBackend struct {
+	seed   maphash.Seed
+	shards []*memoryShard
+}
+
+// memoryShard is an LRU list of entries, most recently used first
+type memoryShard struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time // zero for entries that do not expire
+}
+
+func (e *memoryEntry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+// NewMemoryBackend creates a memory backend bounded by config.MaxEntries and config.MaxBytes
+// over config.Shards shards
+func NewMemoryBackend(config *Config) (*MemoryBackend, error) {
+	maxEntries, maxBytes, shards := config.MaxEntries, config.MaxBytes, config.Shards
+	if maxEntries == 0 {
+		maxEntries = defaultMaxEntries
+	}
+	if maxBytes == 0 {
+		maxBytes = defaultMaxBytes
+	}
+	if shards == 0 {
+		shards = defaultShards
+	}
+	if maxEntries < 0 || maxBytes < 0 || shards < 0 {
+		return nil, fmt.Errorf("cache: negative memory bounds")
+	}
+
+	// Every shard holds at least one entry, so that the bounds are never exceeded
+	shards = min(shards, maxEntries)
+
+	b := &MemoryBackend{seed: maphash.MakeSeed(), shards: make([]*memoryShard, shards)}
+	for i := range b.shards {
+		s := &memoryShard{
+			entries:    make(map[string]*list.Element),
+			lru:        list.New(),
+			maxEntries: maxEntries / shards,
+			maxBytes:   maxBytes / int64(shards),
+		}
+		// The remainders go to the first shards
+		if i < maxEntries%shards {
+			s.maxEntries++
+		}
+		if int64(i) < maxBytes%int64(shards) {
+			s.maxBytes++
+		}
+		b.shards[i] = s
+	}
+	return b, nil
+}
+
+func (b *MemoryBackend) shard(key string) *memoryShard {
+	return b.shards[maphash.String(b.seed, key)%uint64(len(b.shards))]
+}
+
+// Set implements `Set()` from Backend interface
+func (b *MemoryBackend) Set(ctx context.Context, key string, value []byte, exp time.Duration) error {
+	entry := &memoryEntry{key: key, value: bytes.Clone(value)}
+	if entry.value == nil {
+		entry.value = []byte{}
+	}
+	if exp > 0 {
+		entry.expires = time.Now().Add(exp)
+	}
+
+	s := b.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		s.remove(elem)
+	}
+	if entry.size() > s.maxBytes {
+		return fmt.Errorf("%w: %d bytes for %d bytes per shard", ErrTooLarge, entry.size(), s.maxBytes)
+	}
+
+	s.entries[key] = s.lru.PushFront(entry)
+	s.bytes += entry.size()
+	for len(s.entries) > s.maxEntries || s.bytes > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+	return nil
+}
+
+// Get implements `Get()` from Backend interface
+func (b *MemoryBackend) Get(ctx context.Context, key string) ([]byte, error) {
+	s := b.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expires.IsZero() && !time.Now().Before(entry.expires) {
+		s.remove(elem)
+		return nil, ErrNotFound
+	}
+
+	s.lru.MoveToFront(elem)
+	return bytes.Clone(entry.value), nil
+}
+
+// Delete implements `Delete()` from Backend interface
+func (b *MemoryBackend) Delete(ctx context.Context, key string) error {
+	s := b.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		s.remove(elem)
+	}
+	return nil
+}
+
+// Close implements `Close()` from Backend interface, it drops every entry
+func (b *MemoryBackend) Close() error {
+	for _, s := range b.shards {
+		s.mu.Lock()
+		s.entries = make(map[string]*list.Element)
+		s.lru.Init()
+		s.bytes = 0
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Len returns the number of entries held, including the expired ones not evicted yet
+func (b *MemoryBackend) Len() int {
+	n := 0
+	for _, s := range b.shards {
+		s.mu.Lock()
+		n += len(s.entries)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// remove drops an entry of the shard, its lock must be held
+func (s *memoryShard) remove(elem *list.Element) {
+	entry := s.lru.Remove(elem).(*memoryEntry)
+	delete(s.entries, entry.key)
+	s.bytes -= entry.size()
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisPingTimeout bounds the check of the connection made by NewRedisBackend
+const redisPingTimeout = 5 * time.Second
+
+func init() {
+	RegisterBackend(BackendRedis, func(config *Config) (Backend, error) {
+		return NewRedisBackend(config)
+	})
+}
+
+var _ Backend = &RedisBackend{}
+
+// RedisBackend stores the entries on a server speaking the Redis protocol, with the
+// expiry of the server
+type RedisBackend struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisBackend connects to the redis server at config.URL and config.Port, keys are
+// prefixed with config.Set when it is set
+func NewRedisBackend(config *Config) (*RedisBackend, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     net.JoinHostPort(config.URL, strconv.Itoa(config.Port)),
+		Password: config.Password,
+		DB:       config.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisPingTimeout)
+	defer cancel()
+	err := client.Ping(ctx).Err()
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("cache: connect to redis: %w", err), client.Close())
+	}
+
+	b := &RedisBackend{client: client}
+	if config.Set != "" {
+		b.prefix = config.Set + ":"
+	}
+	return b, nil
+}
+
+// Set implements `Set()` from Backend interface
+func (b *RedisBackend) Set(ctx context.Context, key string, value []byte, exp time.Duration) error {
+	// Negative expirations keep the previous TTL on redis
+	exp = max(exp, 0)
+	return b.client.Set(ctx, b.prefix+key, value, exp).Err()
+}
+
+// Get implements `Get()` from Backend interface
+func (b *RedisBackend) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := b.client.Get(ctx, b.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+// Delete implements `Delete()` from Backend interface
+func (b *RedisBackend) Delete(ctx context.Context, key string) error {
+	return b.client.Del(ctx, b.prefix+key).Err()
+}
+
+// Close implements `Close()` from Backend interface
+func (b *RedisBackend) Close() error {
+	return b.client.Close()
+}
@@ -0,0 +1,73 @@
+package conf
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+)
+
+// Database is the database section of the service configuration files
+type Database struct {
+	Port        int    `mapstructure:"port"`
+	Driver      string `mapstructure:"driver"`
+	Address     string `mapstructure:"address"`
+	Dialect     string `mapstructure:"dialect"`
+	Name        string `mapstructure:"name"`
+	Username    string `mapstructure:"username"`
+	Password    string `mapstructure:"password"`
+	SSL         string `mapstructure:"ssl"`
+	MaxConnPool int    `mapstructure:"maxconnpool"`
+	SSLRootCert string `mapstructure:"ssl-root-cert"`
+	SSLCert     string `mapstructure:"ssl-cert"`
+	SSLKey      string `mapstructure:"ssl-key"`
+
+	ConnMaxLifetime  time.Duration `mapstructure:"conn-max-lifetime"`
+	ConnMaxIdleTime  time.Duration `mapstructure:"conn-max-idle-time"`
+	DialTimeout      time.Duration `mapstructure:"dial-timeout"`
+	StatementTimeout time.Duration `mapstructure:"statement-timeout"`
+	ConnectAttempts  int           `mapstructure:"connect-attempts"`
+
+	// SlowQueryThreshold logs the statements running for longer, zero disables the log
+	SlowQueryThreshold time.Duration `mapstructure:"slow-query-threshold"`
+
+	Replicas []Replica `mapstructure:"replicas"`
+}
+
+type Replica struct {
+	Address string `mapstructure:"address"`
+	Port    int    `mapstructure:"port"`
+}
+
+// SQLConfig maps the database section to the configuration of the common database client
+func (d Database) SQLConfig() *database.Config {
+	var replicas []database.Replica
+	for _, replica := range d.Replicas {
+		replicas = append(replicas, database.Replica{
+			ConnectionString: replica.Address,
+			Port:             strconv.Itoa(replica.Port),
+		})
+	}
+
+	return &database.Config{
+		Driver:             d.Driver,
+		ConnectionString:   d.Address,
+		Port:               strconv.Itoa(d.Port),
+		Username:           d.Username,
+		Password:           d.Password,
+		MaxOpenConnections: d.MaxConnPool,
+		MaxIdleConnections: d.MaxConnPool,
+		SSLMode:            d.SSL,
+		SSLRootCert:        d.SSLRootCert,
+		SSLCert:            d.SSLCert,
+		SSLKey:             d.SSLKey,
+		ConnMaxLifetime:    d.ConnMaxLifetime,
+		ConnMaxIdleTime:    d.ConnMaxIdleTime,
+		DialTimeout:        d.DialTimeout,
+		StatementTimeout:   d.StatementTimeout,
+		ConnectAttempts:    d.ConnectAttempts,
+		DBName:             d.Name,
+		Replicas:           replicas,
+		Observability:      &database.Observability{SlowThreshold: d.SlowQueryThreshold},
+	}
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// aggregateFunctions lists the accepted aggregate functions
+var aggregateFunctions = map[string]bool{
+	"COUNT": true,
+	"SUM":   true,
+	"AVG":   true,
+	"MIN":   true,
+	"MAX":   true,
+}
+
+// Aggregate runs a query over the entities of the handler, typically grouping them with
+// qf.GroupBy and computing p.Aggregates, and scans every row of the result into an R.
+// The columns of the result are matched to the fields of R by name, e.g. an aggregate
+// aliased total_amount is scanned into R.TotalAmount.
+func Aggregate[T, R any](ctx context.Context, r *SQLHandler[T], qf QueryFilter, p *Projection) ([]R, error) {
+	if len(qf.Preload) > 0 {
+		return nil, fmt.Errorf("%w: associations can not be preloaded by aggregates", ErrInvalidFilter)
+	}
+
+	var results []R
+	err := r.retry(ctx, func(ctx context.Context) error {
+		results = nil
+
+		// The projection comes first, so that the filters can order and group by its aliases
+		db := r.db.WithContext(ctx).Model(new(T))
+		db = applyProjections(db, p)
+		db = applyQueryFilters(db, qf)
+		return classifyError(db.Scan(&results).Error)
+	})
+	return results, err
+}
+
+// Query runs a SQL query and scans every row of its result into an R, for the reports that
+// can not be expressed with Aggregate. The query is used as is, so it must never be built
+// from user input; values go through args. It is always served by the primary, and it is
+// not tenant scoped, so queries on tenant scoped tables must filter on TenantColumn.
+func Query[R any](ctx context.Context, db *gorm.DB, query string, args ...any) ([]R, error) {
+	var results []R
+	err := db.WithContext(ctx).Raw(query, args...).Scan(&results).Error
+	return results, classifyError(err)
+}
+
+// alias registers an alias of the projection, expr is the SQL it can be grouped by
+func (b *exprBuilder) alias(alias, expr string) error {
+	if !identifierRegex.MatchString(alias) {
+		return fmt.Errorf("%w: invalid alias %q", ErrInvalidFilter, alias)
+	}
+	if _, ok := b.aliases[alias]; ok {
+		return fmt.Errorf("%w: alias %q used more than once", ErrInvalidFilter, alias)
+	}
+	b.aliases[alias] = expr
+	return nil
+}
+
+// aggregate builds an aggregate projection, the function must be one of aggregateFunctions
+func (b *exprBuilder) aggregate(a AggregateProjection) (clause.Expression, error) {
+	function := strings.ToUpper(strings.TrimSpace(a.Function))
+	if !aggregateFunctions[function] {
+		return nil, fmt.Errorf("%w: invalid aggregate function %q", ErrInvalidFilter, a.Function)
+	}
+
+	var column any = clause.Expr{SQL: "*"}
+	if a.Field == "*" {
+		if function != "COUNT" {
+			return nil, fmt.Errorf("%w: %s(*) is not an aggregate", ErrInvalidFilter, function)
+		}
+	} else {
+		c, err := b.column(a.Field)
+		if err != nil {
+			return nil, err
+		}
+		column = c
+	}
+
+	alias := a.Alias
+	if alias == "" {
+		alias = strings.ToLower(function) + "_" + strings.ReplaceAll(a.Field, ".", "_")
+		if a.Field == "*" {
+			alias = strings.ToLower(function)
+		}
+	}
+	err := b.alias(alias, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return clause.Expr{SQL: function + "(?) AS ?", Vars: []any{column, clause.Column{Name: alias}}}, nil
+}
+
+// bucket returns the SQL truncating a time column to the unit of the bucket, in the
+// dialect of the driver
+func (b *exprBuilder) bucket(query *gorm.DB, bucket TimeBucket) (string, error) {
+	column, err := b.column(bucket.Field)
+	if err != nil {
+		return "", err
+	}
+	if column.Table == clause.CurrentTable {
+		column.Table = b.schema.Table
+	}
+
+	expr, err := b.dialect.truncateTime(query.Statement.Quote(column), strings.ToLower(bucket.Unit))
+	if err != nil {
+		return "", err
+	}
+
+	err = b.alias(bucket.Alias, expr)
+	if err != nil {
+		return "", err
+	}
+	return expr, nil
+}
+
+// truncateTime truncates the (quoted) column to the start of its hour, day, week, month or year
+func (d dialect) truncateTime(column, unit string) (string, error) {
+	switch unit {
+	case "hour", "day", "week", "month", "year":
+	default:
+		return "", fmt.Errorf("%w: invalid time bucket unit %q", ErrInvalidFilter, unit)
+	}
+
+	switch d {
+	case dialectPostgres:
+		return "date_trunc('" + unit + "', " + column + ")", nil
+	case dialectMySQL:
+		switch unit {
+		case "hour":
+			return "DATE_FORMAT(" + column + ", '%Y-%m-%d %H:00:00')", nil
+		case "day":
+			return "DATE(" + column + ")", nil
+		case "week":
+			return "DATE(" + column + " - INTERVAL WEEKDAY(" + column + ") DAY)", nil
+		case "month":
+			return "DATE_FORMAT(" + column + ", '%Y-%m-01')", nil
+		default:
+			return "DATE_FORMAT(" + column + ", '%Y-01-01')", nil
+		}
+	case dialectSQLServer:
+		if unit == "week" {
+			// Independent of DATEFIRST, 1900-01-01 was a Monday
+			return "DATEADD(day, DATEDIFF(day, 0, " + column + ") / 7 * 7, 0)", nil
+		}
+		return "DATEADD(" + unit + ", DATEDIFF(" + unit + ", 0, " + column + "), 0)", nil
+	case dialectSQLite:
+		switch unit {
+		case "hour":
+			return "strftime('%Y-%m-%d %H:00:00', " + column + ")", nil
+		case "day":
+			return "date(" + column + ")", nil
+		case "week":
+			// Moves to the next Sunday (or stays on it) then back to its Monday
+			return "date(" + column + ", 'weekday 0', '-6 days')", nil
+		default:
+			return "date(" + column + ", 'start of " + unit + "')", nil
+		}
+	default:
+		return "", d.unsupported("time buckets")
+	}
+}
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Actions recorded in the audit trail
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+
+	// AuditUpsert records the rows written by an Upsert, which may have been inserted or
+	// updated, so only their new values are known
+	AuditUpsert = "upsert"
+)
+
+// Auditable is implemented by the models whose writes are recorded in the audit trail, see
+// RegisterAudit. AuditType names the entity in the trail, such as "user".
+//
+// Fields tagged `audit:"-"` are left out of the trail, and fields tagged `audit:"redact"`
+// are recorded as changed without their values.
+type Auditable interface {
+	AuditType() string
+}
+
+// AuditEntry is a row of the append-only audit trail, recording a write to a single entity.
+// Entries are tenant scoped, they belong to the tenant of the written entity, or to the one
+// of the write's context for entities that are not tenant scoped.
+type AuditEntry struct {
+	ID         uint64       `gorm:"primaryKey" json:"id"`
+	TenantID   string       `gorm:"size:64;not null;default:'';index:idx_audit_entries_entity,priority:1" json:"tenant_id"`
+	EntityType string       `gorm:"size:64;not null;index:idx_audit_entries_entity,priority:2" json:"entity_type"`
+	EntityID   string       `gorm:"size:64;not null;index:idx_audit_entries_entity,priority:3" json:"entity_id"`
+	Action     string       `gorm:"size:16;not null" json:"action"`
+	Changes    AuditChanges `gorm:"not null" json:"changes"`
+	Actor      string       `gorm:"size:128;not null;default:''" json:"actor"`
+	RequestID  string       `gorm:"size:128;not null;default:''" json:"request_id"`
+	CreatedAt  time.Time    `gorm:"not null;index:idx_audit_entries_entity,priority:4;index" json:"created_at"`
+}
+
+// TableName returns the name of the audit table
+func (AuditEntry) TableName() string {
+	return "audit_entries"
+}
+
+// AuditChange holds the value of a column before and after a write, Old is nil for
+// creates and New is nil for hard deletes
+type AuditChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// AuditChanges maps the changed columns of an entity to their values, it is stored as JSON
+type AuditChanges map[string]AuditChange
+
+// Value implements driver.Valuer
+func (c AuditChanges) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner
+func (c *AuditChanges) Scan(src any) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, c)
+	case string:
+		return json.Unmarshal([]byte(src), c)
+	case nil:
+		*c = nil
+		return nil
+	default:
+		return fmt.Errorf("database: can not scan %T into AuditChanges", src)
+	}
+}
+
+// GormDBDataType returns the JSON column type of the dialect
+func (AuditChanges) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return "JSONB"
+	case "mysql":
+		return "JSON"
+	case "sqlserver":
+		return "NVARCHAR(MAX)"
+	default:
+		return "TEXT"
+	}
+}
+
+type (
+	auditActorKey     struct{}
+	auditRequestIDKey struct{}
+)
+
+// WithActor returns a context whose writes are attributed to the given actor in the audit
+// trail, such as the ID of the authenticated user or the name of a background job
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// WithRequestID returns a context whose writes are recorded in the audit trail with the ID
+// of the request that made them
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, auditRequestIDKey{}, requestID)
+}
+
+// Headers read by AuditRequest
+const (
+	// RequestIDHeader carries the ID of a request, one is generated for requests without it
+	RequestIDHeader = "X-Request-ID"
+
+	// ActorHeader carries the caller authenticated by the gateway in front of the services,
+	// which must drop the header from the requests of clients
+	ActorHeader = "X-Actor"
+)
+
+// auditHeaderSize is the size of the actor and request_id columns of the audit trail
+const auditHeaderSize = 128
+
+// AuditRequest returns r with a context attributing its writes to the actor and request ID
+// of its headers, see WithActor and WithRequestID, along with the request ID. Headers longer
+// than the columns of the audit trail are ignored, and a request ID is generated for the
+// requests without one.
+func AuditRequest(r *http.Request) (*http.Request, string) {
+	requestID := r.Header.Get(RequestIDHeader)
+	if requestID == "" || len(requestID) > auditHeaderSize {
+		var id [16]byte
+		_, _ = rand.Read(id[:])
+		requestID = hex.EncodeToString(id[:])
+	}
+
+	ctx := WithRequestID(r.Context(), requestID)
+	if actor := r.Header.Get(ActorHeader); actor != "" && len(actor) <= auditHeaderSize {
+		ctx = WithActor(ctx, actor)
+	}
+	return r.WithContext(ctx), requestID
+}
+
+// AuditHandler serves the requests with next under the context of AuditRequest, echoing
+// their request ID in the response
+func AuditHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, requestID := AuditRequest(r)
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// auditContext returns the actor and request ID of the writes made with ctx
+func auditContext(ctx context.Context) (actor, requestID string) {
+	if ctx == nil {
+		return "", ""
+	}
+	actor, _ = ctx.Value(auditActorKey{}).(string)
+	requestID, _ = ctx.Value(auditRequestIDKey{}).(string)
+	return actor, requestID
+}
+
+// AuditQuery selects the audit entries of an entity type, or of a single entity, within
+// a time range
+type AuditQuery struct {
+	// EntityType is required, EntityID selects a single entity of the type
+	EntityType string
+	EntityID   string
+
+	// From (inclusive) and To (exclusive) bound the time of the entries, the zero time
+	// leaves the range open on that side
+	From time.Time
+	To   time.Time
+
+	// Size and Cursor page through the entries, as for ListPage
+	Size   int
+	Cursor string
+}
+
+// AuditLog reads the audit trail. Entries are only written by the audit callbacks, the
+// trail has no update or delete operation.
+type AuditLog struct {
+	handler *SQLHandler[AuditEntry]
+}
+
+// NewAuditLog returns the audit trail stored in db
+func NewAuditLog(db *gorm.DB, opts ...Option) *AuditLog {
+	return &AuditLog{handler: NewSQLHandler[AuditEntry](db, opts...)}
+}
+
+// History returns a page of the entries matching the query, most recent first. Only the
+// entries of the tenant of ctx are read, see WithTenant and CrossTenant.
+func (l *AuditLog) History(ctx context.Context, q AuditQuery) (*Page[AuditEntry], error) {
+	if q.EntityType == "" {
+		return nil, fmt.Errorf("%w: audit query requires an entity type", ErrInvalidFilter)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return nil, fmt.Errorf("%w: audit query range ends before it starts", ErrInvalidFilter)
+	}
+
+	exprs := []Expr{Eq("entity_type", q.EntityType)}
+	if q.EntityID != "" {
+		exprs = append(exprs, Eq("entity_id", q.EntityID))
+	}
+	if !q.From.IsZero() {
+		exprs = append(exprs, Gte("created_at", q.From))
+	}
+	if !q.To.IsZero() {
+		exprs = append(exprs, Lt("created_at", q.To))
+	}
+
+	return l.handler.ListPage(ctx, QueryFilter{
+		Where:   And(exprs...),
+		OrderBy: "created_at DESC",
+		Limit:   q.Size,
+		Cursor:  q.Cursor,
+	}, nil)
+}
@@ -0,0 +1,126 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+	"gorm.io/gorm"
+)
+
+type auditedRecord struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func (auditedRecord) AuditType() string {
+	return "record"
+}
+
+// Without GORM's default transaction a write whose entries fail must not be committed either
+func TestAuditWithoutDefaultTransaction(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.New(t, &auditedRecord{}, &database.AuditEntry{}).Instance()
+	if err := database.RegisterAudit(db); err != nil {
+		t.Fatalf("register audit: %v", err)
+	}
+	db = db.Session(&gorm.Session{SkipDefaultTransaction: true})
+
+	if err := db.WithContext(ctx).Create(&auditedRecord{Name: "alpha"}).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	var entries int64
+	if err := db.WithContext(database.CrossTenant(ctx)).Model(&database.AuditEntry{}).Count(&entries).Error; err != nil || entries != 1 {
+		t.Fatalf("audit entries: got %d, %v, want 1", entries, err)
+	}
+
+	if err := db.Migrator().DropTable(&database.AuditEntry{}); err != nil {
+		t.Fatalf("drop audit entries: %v", err)
+	}
+	if err := db.WithContext(ctx).Create(&auditedRecord{Name: "bravo"}).Error; err == nil {
+		t.Fatal("create without an audit trail: got no error")
+	}
+
+	var records int64
+	if err := db.Model(&auditedRecord{}).Count(&records).Error; err != nil || records != 1 {
+		t.Errorf("records after a failed audit: got %d, %v, want 1", records, err)
+	}
+}
+
+type tenantAuditedRecord struct {
+	ID       uint   `gorm:"primaryKey"`
+	TenantID string `gorm:"size:64;not null"`
+	Name     string
+}
+
+func (tenantAuditedRecord) AuditType() string {
+	return "tenant_record"
+}
+
+// The entries of tenant scoped records belong to their tenant, the history of another
+// tenant must not show them
+func TestAuditTenantHistory(t *testing.T) {
+	db := databasetest.New(t, &tenantAuditedRecord{}, &database.AuditEntry{}).Instance()
+	if err := database.RegisterAudit(db); err != nil {
+		t.Fatalf("register audit: %v", err)
+	}
+	acme := database.WithTenant(context.Background(), "acme")
+	globex := database.WithTenant(context.Background(), "globex")
+
+	if err := db.WithContext(acme).Create(&tenantAuditedRecord{Name: "alpha"}).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	cross := database.CrossTenant(context.Background())
+	if err := db.WithContext(cross).Create(&tenantAuditedRecord{TenantID: "globex", Name: "bravo"}).Error; err != nil {
+		t.Fatalf("create across tenants: %v", err)
+	}
+
+	log := database.NewAuditLog(db, database.WithCursorKey([]byte("audit-test-key")))
+	query := database.AuditQuery{EntityType: "tenant_record"}
+	for ctx, want := range map[context.Context]string{acme: "acme", globex: "globex"} {
+		page, err := log.History(ctx, query)
+		if err != nil {
+			t.Fatalf("history of %s: %v", want, err)
+		}
+		if len(page.Items) != 1 || page.Items[0].TenantID != want {
+			t.Errorf("history of %s: got %+v", want, page.Items)
+		}
+	}
+	if _, err := log.History(context.Background(), query); !errors.Is(err, database.ErrTenantRequired) {
+		t.Errorf("history without a tenant: got %v, want ErrTenantRequired", err)
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	db := databasetest.New(t, &auditedRecord{}, &database.AuditEntry{}).Instance()
+	if err := database.RegisterAudit(db); err != nil {
+		t.Fatalf("register audit: %v", err)
+	}
+
+	handler := database.AuditHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := db.WithContext(r.Context()).Create(&auditedRecord{Name: "alpha"}).Error; err != nil {
+			t.Errorf("create: %v", err)
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/records", nil)
+	req.Header.Set(database.ActorHeader, "user:42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	requestID := rec.Header().Get(database.RequestIDHeader)
+	if requestID == "" {
+		t.Fatal("response without a generated request ID")
+	}
+	var entry database.AuditEntry
+	if err := db.WithContext(database.CrossTenant(context.Background())).First(&entry).Error; err != nil {
+		t.Fatalf("audit entry: %v", err)
+	}
+	if entry.Actor != "user:42" || entry.RequestID != requestID {
+		t.Errorf("audit entry: got actor %q and request ID %q, want user:42 and %q", entry.Actor, entry.RequestID, requestID)
+	}
+}
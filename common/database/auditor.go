@@ -0,0 +1,406 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// auditStateKey holds the rows an audited update or delete matched before it ran
+	auditStateKey = "database:audit"
+
+	// auditTxKey marks the writes auditBegin opened a transaction for
+	auditTxKey = "database:audit_tx"
+
+	// auditRedacted replaces the values of the fields tagged audit:"redact"
+	auditRedacted = "[REDACTED]"
+)
+
+// auditRow is the state of an audited row
+type auditRow struct {
+	id     string
+	tenant string
+	pk     []any
+	values map[string]any
+}
+
+// RegisterAudit registers the callbacks recording the writes of Auditable models in the
+// audit trail. Creates, updates and deletes (soft or hard) are recorded with the changed
+// columns, the actor and the request ID of their context, see WithActor and WithRequestID.
+//
+// Entries are written in the transaction of the write, or in the one GORM opens around
+// it. Databases skipping GORM's default transaction get one opened by the callbacks, so a
+// write is never committed without its entries. Raw SQL and MemoryRepository writes are
+// not audited. Connect registers the callbacks when Config.Audit is set.
+func RegisterAudit(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("*").Register("database:audit_begin", auditBegin),
+		cb.Create().After("*").Register("database:audit_end", auditEnd),
+		cb.Update().Before("*").Register("database:audit_begin", auditBegin),
+		cb.Update().After("*").Register("database:audit_end", auditEnd),
+		cb.Delete().Before("*").Register("database:audit_begin", auditBegin),
+		cb.Delete().After("*").Register("database:audit_end", auditEnd),
+		cb.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("database:audit_create", auditCreate),
+		cb.Update().Before("gorm:update").After("gorm:begin_transaction").Register("database:audit_before", auditBefore),
+		cb.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("database:audit_update", auditAfter(AuditUpdate)),
+		cb.Delete().Before("gorm:delete").After("gorm:begin_transaction").Register("database:audit_before", auditBefore),
+		cb.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("database:audit_delete", auditAfter(AuditDelete)),
+	)
+}
+
+// auditBegin opens a transaction around the audited writes of a database skipping GORM's
+// default transaction, which auditEnd ends
+func auditBegin(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || !db.SkipDefaultTransaction {
+		return
+	}
+	if _, ok := auditType(db.Statement.Schema); !ok {
+		return
+	}
+
+	tx := db.Begin()
+	switch {
+	case tx.Error == nil:
+		db.Statement.ConnPool = tx.Statement.ConnPool
+		db.InstanceSet(auditTxKey, true)
+	case errors.Is(tx.Error, gorm.ErrInvalidTransaction):
+		// The write is already part of a transaction
+	default:
+		db.AddError(tx.Error)
+	}
+}
+
+// auditEnd commits the transaction opened by auditBegin, or rolls it back if the write
+// or its entries failed
+func auditEnd(db *gorm.DB) {
+	if _, ok := db.InstanceGet(auditTxKey); !ok {
+		return
+	}
+	if db.Error != nil {
+		db.Rollback()
+	} else {
+		db.Commit()
+	}
+	db.Statement.ConnPool = db.ConnPool
+}
+
+// auditType returns the entity type of an Auditable model
+func auditType(sch *schema.Schema) (string, bool) {
+	if sch == nil {
+		return "", false
+	}
+	auditable, ok := reflect.New(sch.ModelType).Interface().(Auditable)
+	if !ok {
+		return "", false
+	}
+	return auditable.AuditType(), true
+}
+
+func auditCreate(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.DryRun || db.RowsAffected == 0 {
+		return
+	}
+
+	action := AuditCreate
+	if _, upsert := stmt.Clauses["ON CONFLICT"]; upsert {
+		action = AuditUpsert
+	}
+	auditCreated(db, stmt.Schema, stmt.ReflectValue, action)
+}
+
+// auditUpserted records the entities of rv, written by an Upsert statement the audit
+// callbacks did not see, when the callbacks are registered
+func auditUpserted(tx *gorm.DB, sch *schema.Schema, rv reflect.Value) error {
+	if tx.Callback().Create().Get("database:audit_create") == nil {
+		return nil
+	}
+	db := tx.Session(&gorm.Session{})
+	auditCreated(db, sch, rv, AuditUpsert)
+	return db.Error
+}
+
+// auditCreated records the creation of rv, a model or a slice of models
+func auditCreated(db *gorm.DB, sch *schema.Schema, rv reflect.Value, action string) {
+	entityType, ok := auditType(sch)
+	if !ok {
+		return
+	}
+
+	var rows []auditRow
+	switch rv.Kind() {
+	case reflect.Struct:
+		rows = append(rows, auditSnapshot(db.Statement.Context, sch, rv))
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			elem := reflect.Indirect(rv.Index(i))
+			if elem.Kind() == reflect.Struct {
+				rows = append(rows, auditSnapshot(db.Statement.Context, sch, elem))
+			}
+		}
+	}
+
+	entries := make([]AuditEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, newAuditEntry(db, entityType, row, action, auditDiff(sch, nil, row.values)))
+	}
+	writeAuditEntries(db, entries)
+}
+
+// auditBefore reads the rows an update or delete is about to write, locking them so that
+// they can not change before the statement runs
+func auditBefore(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.DryRun {
+		return
+	}
+	if _, ok := auditType(stmt.Schema); !ok {
+		return
+	}
+
+	conds := auditConditions(stmt)
+	// GORM rejects the statement when it has no conditions
+	if len(conds) == 0 && !db.AllowGlobalUpdate {
+		return
+	}
+
+	rows, err := loadAuditRows(db, conds, stmt.Unscoped, true)
+	if err != nil {
+		db.AddError(fmt.Errorf("database: audit: %w", err))
+		return
+	}
+	stmt.Settings.Store(auditStateKey, rows)
+}
+
+// auditAfter records the changes made by an update or delete to the rows read by auditBefore
+func auditAfter(action string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		stmt := db.Statement
+		value, ok := stmt.Settings.LoadAndDelete(auditStateKey)
+		if !ok || db.Error != nil || db.RowsAffected == 0 {
+			return
+		}
+		before := value.([]auditRow)
+		if len(before) == 0 {
+			return
+		}
+
+		pks := make([][]any, len(before))
+		for i, row := range before {
+			pks[i] = row.pk
+		}
+		column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, pks)
+
+		// Soft deleted rows are read back too, hard deleted ones are gone
+		after, err := loadAuditRows(db, []clause.Expression{clause.IN{Column: column, Values: values}}, true, false)
+		if err != nil {
+			db.AddError(fmt.Errorf("database: audit: %w", err))
+			return
+		}
+		afterByID := make(map[string]auditRow, len(after))
+		for _, row := range after {
+			afterByID[row.id] = row
+		}
+
+		entityType, _ := auditType(stmt.Schema)
+		var entries []AuditEntry
+		for _, row := range before {
+			var changes AuditChanges
+			if a, ok := afterByID[row.id]; ok {
+				changes = auditDiff(stmt.Schema, row.values, a.values)
+			} else {
+				changes = auditDiff(stmt.Schema, row.values, nil)
+			}
+			if len(changes) > 0 {
+				entries = append(entries, newAuditEntry(db, entityType, row, action, changes))
+			}
+		}
+		writeAuditEntries(db, entries)
+	}
+}
+
+// auditConditions returns the conditions of an update or delete, including the primary keys
+// of the model or of the deleted value, which GORM adds to them while building the statement
+func auditConditions(stmt *gorm.Statement) []clause.Expression {
+	var conds []clause.Expression
+	if where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where); ok {
+		conds = append(conds, where.Exprs...)
+	}
+
+	values := []reflect.Value{stmt.ReflectValue}
+	if stmt.Model != nil && stmt.Model != stmt.Dest {
+		values = append(values, reflect.Indirect(reflect.ValueOf(stmt.Model)))
+	}
+	for _, value := range values {
+		switch value.Kind() {
+		case reflect.Struct, reflect.Slice, reflect.Array:
+		default:
+			continue
+		}
+		_, pks := schema.GetIdentityFieldValuesMap(stmt.Context, value, stmt.Schema.PrimaryFields)
+		column, pkValues := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, pks)
+		if len(pkValues) > 0 {
+			conds = append(conds, clause.IN{Column: column, Values: pkValues})
+		}
+	}
+	return conds
+}
+
+// loadAuditRows reads the rows of the statement's model matching conds, within the
+// statement's transaction
+func loadAuditRows(db *gorm.DB, conds []clause.Expression, unscoped, lock bool) ([]auditRow, error) {
+	stmt := db.Statement
+	rows := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+
+	// The primary has to serve the read when GORM's default transaction is disabled
+	query := db.Session(&gorm.Session{NewDB: true, Context: ReadYourWrites(stmt.Context)}).
+		Model(reflect.New(stmt.Schema.ModelType).Interface()).
+		Table(stmt.Table)
+	if unscoped {
+		query = query.Unscoped()
+	}
+	if lock && inTransaction(stmt.ConnPool) {
+		query = applyLock(query, RowLock{Mode: LockForUpdate})
+	}
+
+	err := query.Clauses(clause.Where{Exprs: conds}).Find(rows.Interface()).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rows = rows.Elem()
+	result := make([]auditRow, rows.Len())
+	for i := range result {
+		result[i] = auditSnapshot(stmt.Context, stmt.Schema, rows.Index(i))
+	}
+	return result, nil
+}
+
+// auditSnapshot captures the primary key and the audited column values of a row
+func auditSnapshot(ctx context.Context, sch *schema.Schema, rv reflect.Value) auditRow {
+	row := auditRow{values: make(map[string]any)}
+
+	ids := make([]string, len(sch.PrimaryFields))
+	for i, field := range sch.PrimaryFields {
+		value, _ := field.ValueOf(ctx, rv)
+		row.pk = append(row.pk, value)
+		ids[i] = fmt.Sprint(reflect.Indirect(reflect.ValueOf(value)))
+	}
+	row.id = strings.Join(ids, ",")
+
+	if field := tenantField(sch); field != nil {
+		value, _ := field.ValueOf(ctx, rv)
+		row.tenant = fmt.Sprint(reflect.Indirect(reflect.ValueOf(value)))
+	}
+
+	for _, field := range sch.Fields {
+		if field.DBName == "" || field.Tag.Get("audit") == "-" {
+			continue
+		}
+		value, _ := field.ValueOf(ctx, rv)
+		row.values[field.DBName] = auditValue(value)
+	}
+	return row
+}
+
+// auditValue converts a field value to the value stored in the database, such as a
+// gorm.DeletedAt to a time or nil
+func auditValue(value any) any {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || (rv.Kind() == reflect.Pointer && rv.IsNil()) {
+		return nil
+	}
+	if valuer, ok := value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err == nil {
+			return v
+		}
+	}
+	return value
+}
+
+// auditDiff returns the columns whose values differ between two states of a row, a nil
+// state being a row that does not exist. Columns updated automatically on every write are
+// left out of updates.
+func auditDiff(sch *schema.Schema, before, after map[string]any) AuditChanges {
+	changes := make(AuditChanges)
+	for _, field := range sch.Fields {
+		if field.DBName == "" || field.Tag.Get("audit") == "-" {
+			continue
+		}
+		if before != nil && after != nil && field.AutoUpdateTime > 0 {
+			continue
+		}
+
+		change := AuditChange{}
+		if before != nil {
+			change.Old = before[field.DBName]
+		}
+		if after != nil {
+			change.New = after[field.DBName]
+		}
+		if auditEqual(change.Old, change.New) {
+			continue
+		}
+
+		if field.Tag.Get("audit") == "redact" {
+			if change.Old != nil {
+				change.Old = auditRedacted
+			}
+			if change.New != nil {
+				change.New = auditRedacted
+			}
+		}
+		changes[field.DBName] = change
+	}
+	return changes
+}
+
+// auditEqual compares two column values by their JSON encoding, which is how they are recorded
+func auditEqual(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+func newAuditEntry(db *gorm.DB, entityType string, row auditRow, action string, changes AuditChanges) AuditEntry {
+	actor, requestID := auditContext(db.Statement.Context)
+	tenant := row.tenant
+	if tenant == "" {
+		tenant, _ = TenantFromContext(db.Statement.Context)
+	}
+	return AuditEntry{
+		TenantID:   tenant,
+		EntityType: entityType,
+		EntityID:   row.id,
+		Action:     action,
+		Changes:    changes,
+		Actor:      actor,
+		RequestID:  requestID,
+		CreatedAt:  db.NowFunc(),
+	}
+}
+
+// writeAuditEntries appends entries to the audit trail within the statement's transaction,
+// failing the statement if they can not be written
+func writeAuditEntries(db *gorm.DB, entries []AuditEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	// The entries already carry their tenant, which may be empty
+	err := db.Session(&gorm.Session{NewDB: true}).Set(tenantStampedKey, true).Create(&entries).Error
+	if err != nil {
+		db.AddError(fmt.Errorf("database: audit: %w", err))
+	}
+}
@@ -0,0 +1,619 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// defaultBatchSize is the number of rows written per statement by the bulk operations
+// when no batch size is given, it keeps statements well below the bind parameter
+// limits of the drivers
+const defaultBatchSize = 100
+
+// UpsertResult holds the per-row outcome of an Upsert
+type UpsertResult struct {
+	// Inserted is the number of entities inserted as new rows
+	Inserted int64
+
+	// Updated is the number of entities which conflicted with an existing row that was updated
+	Updated int64
+
+	// Unchanged is the number of entities which conflicted with an existing row that was
+	// left as is, because no update columns were given
+	Unchanged int64
+}
+
+// CreateBatch implements `CreateBatch()` from Repository interface
+func (r *SQLHandler[T]) CreateBatch(ctx context.Context, entities []T, batchSize int) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	return r.retry(ctx, func(ctx context.Context) error {
+		return classifyError(r.db.WithContext(ctx).CreateInBatches(entities, batchSize).Error)
+	})
+}
+
+// Upsert implements `Upsert()` from Repository interface
+func (r *SQLHandler[T]) Upsert(ctx context.Context, entities []T, conflictColumns, updateColumns []string) (*UpsertResult, error) {
+	result := &UpsertResult{}
+	if len(entities) == 0 {
+		return result, nil
+	}
+
+	sch, err := parseSchema(r.db, new(T))
+	if err != nil {
+		return nil, err
+	}
+
+	conflictFields, err := lookUpFields(sch, conflictColumns)
+	if err != nil {
+		return nil, err
+	}
+	if len(conflictFields) == 0 {
+		return nil, fmt.Errorf("%w: upsert requires conflict columns", ErrInvalidFilter)
+	}
+	updateFields, err := lookUpFields(sch, updateColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	// The tenant is stamped before the entities are deduplicated on their conflict key,
+	// which may include it
+	if field := tenantField(sch); field != nil {
+		if len(updateFields) > 0 {
+			err := checkTenantConflict(fieldColumns(conflictFields))
+			if err != nil {
+				return nil, err
+			}
+			if dialectOf(r.db) == dialectMySQL {
+				err := checkTenantKeys(ctx, sch, entities)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		for i := range entities {
+			err := stampTenant(ctx, field, reflect.ValueOf(&entities[i]).Elem())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	onConflict := upsertClause(sch, conflictFields, updateFields)
+	keep := lastByKey(ctx, conflictFields, entities)
+
+	err = r.retry(ctx, func(ctx context.Context) error {
+		rows := make([]T, len(keep))
+		for i, j := range keep {
+			rows[i] = entities[j]
+		}
+
+		*result = UpsertResult{}
+		err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			tx = tx.Session(&gorm.Session{SkipHooks: true})
+			switch dialectOf(tx) {
+			case dialectPostgres:
+				return upsertReturning(tx, sch, onConflict, rows, result)
+			case dialectMySQL:
+				return upsertEach(tx, onConflict, rows, result)
+			case dialectSQLServer:
+				return upsertMerge(tx, sch, onConflict, rows, result)
+			default:
+				return upsertCounted(ctx, tx, sch, conflictFields, onConflict, rows, result)
+			}
+		})
+		if err != nil {
+			return classifyError(err)
+		}
+
+		for i, j := range keep {
+			entities[j] = rows[i]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// lastByKey returns the indexes of the entities to upsert, in order, keeping the last of the
+// entities with the same conflict key: a statement can not write a row twice. As in SQL,
+// keys with a NULL column never conflict.
+func lastByKey[T any](ctx context.Context, fields []*schema.Field, entities []T) []int {
+	last := make(map[string]int, len(entities))
+	keys := make([]string, len(entities))
+	for i := range entities {
+		rv := reflect.ValueOf(&entities[i]).Elem()
+
+		var key strings.Builder
+		for _, field := range fields {
+			value, _ := field.ValueOf(ctx, rv)
+			value = sqlValue(value)
+			if value == nil {
+				key.Reset()
+				break
+			}
+			if t, ok := value.(time.Time); ok {
+				value = t.UTC().Format(time.RFC3339Nano)
+			}
+			fmt.Fprintf(&key, "%T:%v\x00", value, value)
+		}
+		if key.Len() > 0 {
+			keys[i] = key.String()
+			last[keys[i]] = i
+		}
+	}
+
+	keep := make([]int, 0, len(last))
+	for i, key := range keys {
+		if key == "" || last[key] == i {
+			keep = append(keep, i)
+		}
+	}
+	return keep
+}
+
+// upsertReturning upserts the entities on postgres, where the rows returned by the
+// statement tell the inserted rows, with no xmax yet, from the updated ones
+func upsertReturning[T any](tx *gorm.DB, sch *schema.Schema, onConflict clause.OnConflict, entities []T, result *UpsertResult) error {
+	returning := clause.Returning{}
+	for _, field := range sch.PrimaryFields {
+		returning.Columns = append(returning.Columns, clause.Column{Name: field.DBName})
+	}
+	returning.Columns = append(returning.Columns, clause.Column{Name: "(xmax = 0)", Raw: true})
+
+	for start := 0; start < len(entities); start += defaultBatchSize {
+		batch := entities[start:min(start+defaultBatchSize, len(entities))]
+
+		dry := tx.Session(&gorm.Session{DryRun: true}).Omit(clause.Associations).Clauses(onConflict, returning).Create(&batch)
+		if dry.Error != nil {
+			return dry.Error
+		}
+
+		// Conflicting rows left as is are not returned, the returned rows can then not
+		// be matched to the entities
+		written := 0
+		err := queryRows(tx, dry.Statement, func(rows *sql.Rows) error {
+			dest := make([]any, len(sch.PrimaryFields)+1)
+			pk := make([]any, len(sch.PrimaryFields))
+			for i := range pk {
+				dest[i] = &pk[i]
+			}
+			var inserted bool
+			dest[len(pk)] = &inserted
+
+			err := rows.Scan(dest...)
+			if err != nil {
+				return err
+			}
+			if inserted {
+				result.Inserted++
+			} else {
+				result.Updated++
+			}
+			if !onConflict.DoNothing && written < len(batch) {
+				err := setPrimaryKey(tx, sch, reflect.ValueOf(&batch[written]).Elem(), pk)
+				if err != nil {
+					return err
+				}
+			}
+			written++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		result.Unchanged += int64(len(batch) - written)
+
+		if written > 0 {
+			err := auditUpserted(tx, sch, reflect.ValueOf(batch))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// upsertEach upserts the entities one by one on MySQL, where the rows affected by a
+// statement tell an inserted row (1) from an updated (2) or unchanged (0) one. A row
+// updated with the values it already had is unchanged to MySQL, it is counted as updated.
+func upsertEach[T any](tx *gorm.DB, onConflict clause.OnConflict, entities []T, result *UpsertResult) error {
+	for i := range entities {
+		db := tx.Omit(clause.Associations).Clauses(onConflict).Create(&entities[i])
+		if db.Error != nil {
+			return db.Error
+		}
+
+		switch {
+		case db.RowsAffected == 1:
+			result.Inserted++
+		case onConflict.DoNothing:
+			result.Unchanged++
+		default:
+			result.Updated++
+		}
+	}
+	return nil
+}
+
+// upsertRowColumn numbers the source rows of a MERGE, so that its output can be matched
+// to the entities
+const upsertRowColumn = "upsert_row"
+
+// upsertTarget names the rows of a filtered unique index a MERGE is restricted to
+const upsertTarget = "upsert_target"
+
+// upsertMerge upserts the entities on SQL Server with a MERGE on the conflict columns, whose
+// output tells the inserted rows from the updated ones. The MERGE built by GORM only
+// matches rows on their primary key.
+func upsertMerge[T any](tx *gorm.DB, sch *schema.Schema, onConflict clause.OnConflict, entities []T, result *UpsertResult) error {
+	for start := 0; start < len(entities); start += defaultBatchSize {
+		batch := entities[start:min(start+defaultBatchSize, len(entities))]
+
+		// A plain insert converts the entities to the values of the MERGE
+		dry := tx.Session(&gorm.Session{DryRun: true}).Omit(clause.Associations).Create(&batch)
+		if dry.Error != nil {
+			return dry.Error
+		}
+		stmt := dry.Statement
+		values, _ := stmt.Clauses["VALUES"].Expression.(clause.Values)
+		if len(values.Columns) == 0 {
+			return fmt.Errorf("%w: upsert of %s without values", ErrInvalidFilter, sch.Name)
+		}
+		buildMerge(stmt, sch, onConflict, values)
+
+		written := 0
+		err := queryRows(tx, stmt, func(rows *sql.Rows) error {
+			var action string
+			var row int
+			pk := make([]any, len(sch.PrimaryFields))
+			dest := []any{&action, &row}
+			for i := range pk {
+				dest = append(dest, &pk[i])
+			}
+
+			err := rows.Scan(dest...)
+			if err != nil {
+				return err
+			}
+			if action == "INSERT" {
+				result.Inserted++
+			} else {
+				result.Updated++
+			}
+			if row >= 0 && row < len(batch) {
+				err := setPrimaryKey(tx, sch, reflect.ValueOf(&batch[row]).Elem(), pk)
+				if err != nil {
+					return err
+				}
+			}
+			written++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		result.Unchanged += int64(len(batch) - written)
+
+		if written > 0 {
+			err := auditUpserted(tx, sch, reflect.ValueOf(batch))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// buildMerge replaces the statement's SQL with a MERGE of values into its table
+func buildMerge(stmt *gorm.Statement, sch *schema.Schema, onConflict clause.OnConflict, values clause.Values) {
+	stmt.SQL.Reset()
+	stmt.Vars = nil
+
+	// HOLDLOCK keeps concurrent merges of the same key from both inserting it. The rows out
+	// of a filtered unique index are hidden from the merge, as they never conflict.
+	if len(onConflict.TargetWhere.Exprs) > 0 {
+		stmt.WriteString("WITH ")
+		stmt.WriteQuoted(upsertTarget)
+		stmt.WriteString(" AS (SELECT * FROM ")
+		stmt.WriteQuoted(stmt.Table)
+		stmt.WriteString(" WITH (HOLDLOCK) WHERE ")
+		onConflict.TargetWhere.Build(stmt)
+		stmt.WriteString(") MERGE INTO ")
+		stmt.WriteQuoted(upsertTarget)
+		stmt.WriteString(" AS ")
+		stmt.WriteQuoted(stmt.Table)
+	} else {
+		stmt.WriteString("MERGE INTO ")
+		stmt.WriteQuoted(stmt.Table)
+		stmt.WriteString(" WITH (HOLDLOCK)")
+	}
+	stmt.WriteString(" USING (VALUES ")
+	for i, row := range values.Values {
+		if i > 0 {
+			stmt.WriteByte(',')
+		}
+		stmt.WriteByte('(')
+		stmt.AddVar(stmt, append(slices.Clip(row), i)...)
+		stmt.WriteByte(')')
+	}
+	stmt.WriteString(") AS excluded (")
+	for _, column := range values.Columns {
+		stmt.WriteQuoted(column.Name)
+		stmt.WriteByte(',')
+	}
+	stmt.WriteQuoted(upsertRowColumn)
+	stmt.WriteString(") ON ")
+	for i, column := range onConflict.Columns {
+		if i > 0 {
+			stmt.WriteString(" AND ")
+		}
+		stmt.WriteQuoted(clause.Column{Table: stmt.Table, Name: column.Name})
+		stmt.WriteString(" = ")
+		stmt.WriteQuoted(clause.Column{Table: "excluded", Name: column.Name})
+	}
+
+	if !onConflict.DoNothing {
+		stmt.WriteString(" WHEN MATCHED THEN UPDATE SET ")
+		onConflict.DoUpdates.Build(stmt)
+	}
+
+	// Identity columns are generated by the database
+	var columns []clause.Column
+	for _, column := range values.Columns {
+		field := sch.LookUpField(column.Name)
+		if field == nil || !field.AutoIncrement {
+			columns = append(columns, column)
+		}
+	}
+	stmt.WriteString(" WHEN NOT MATCHED THEN INSERT (")
+	for i, column := range columns {
+		if i > 0 {
+			stmt.WriteByte(',')
+		}
+		stmt.WriteQuoted(column.Name)
+	}
+	stmt.WriteString(") VALUES (")
+	for i, column := range columns {
+		if i > 0 {
+			stmt.WriteByte(',')
+		}
+		stmt.WriteQuoted(clause.Column{Table: "excluded", Name: column.Name})
+	}
+
+	stmt.WriteString(") OUTPUT $action,")
+	stmt.WriteQuoted(clause.Column{Table: "excluded", Name: upsertRowColumn})
+	for _, field := range sch.PrimaryFields {
+		stmt.WriteString(",INSERTED.")
+		stmt.WriteQuoted(field.DBName)
+	}
+	stmt.WriteByte(';')
+}
+
+// upsertCounted upserts the entities on SQLite, which can not tell inserted rows from
+// updated ones, by counting the conflicting rows first. SQLite runs one write transaction
+// at a time and fails a transaction whose reads were outdated by another one, so a
+// concurrent write can not skew the counts.
+func upsertCounted[T any](ctx context.Context, tx *gorm.DB, sch *schema.Schema, conflictFields []*schema.Field, onConflict clause.OnConflict, entities []T, result *UpsertResult) error {
+	existing, err := countExisting(ctx, tx, sch, conflictFields, onConflict.TargetWhere, entities)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Omit(clause.Associations).Clauses(onConflict).CreateInBatches(entities, defaultBatchSize).Error
+	if err != nil {
+		return err
+	}
+
+	result.Inserted = int64(len(entities)) - existing
+	if onConflict.DoNothing {
+		result.Unchanged = existing
+	} else {
+		result.Updated = existing
+	}
+	return nil
+}
+
+// queryRows runs the SQL built for stmt, passing each of the returned rows to scan
+func queryRows(tx *gorm.DB, stmt *gorm.Statement, scan func(*sql.Rows) error) error {
+	// The SQL is already bound, Raw must not parse its placeholders
+	query := tx.Raw(stmt.SQL.String())
+	query.Statement.Vars = stmt.Vars
+
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := scan(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// setPrimaryKey sets the primary key values returned by the database on the entity
+func setPrimaryKey(tx *gorm.DB, sch *schema.Schema, rv reflect.Value, pk []any) error {
+	for i, field := range sch.PrimaryFields {
+		err := field.Set(tx.Statement.Context, rv, pk[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookUpFields resolves field or column names to the fields of the model
+func lookUpFields(sch *schema.Schema, names []string) ([]*schema.Field, error) {
+	fields := make([]*schema.Field, 0, len(names))
+	for _, name := range names {
+		field := sch.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("%w: unknown column %q for %s", ErrInvalidFilter, name, sch.Name)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// fieldColumns returns the columns of fields
+func fieldColumns(fields []*schema.Field) []string {
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = field.DBName
+	}
+	return columns
+}
+
+// upsertClause builds the ON CONFLICT clause, which GORM translates to ON CONFLICT,
+// ON DUPLICATE KEY UPDATE or MERGE depending on the driver
+func upsertClause(sch *schema.Schema, conflictFields, updateFields []*schema.Field) clause.OnConflict {
+	onConflict := clause.OnConflict{}
+	for _, field := range conflictFields {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: field.DBName})
+	}
+
+	// Postgres and SQLite only match a partial unique index to a conflict target carrying
+	// its condition, the rows outside of the index never conflict
+	if where := conflictCondition(sch, conflictFields); where != "" {
+		onConflict.TargetWhere = clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: where}}}
+	}
+
+	if len(updateFields) == 0 {
+		onConflict.DoNothing = true
+		return onConflict
+	}
+
+	var columns []string
+	seen := make(map[string]bool)
+	for _, field := range updateFields {
+		if !seen[field.DBName] {
+			seen[field.DBName] = true
+			columns = append(columns, field.DBName)
+		}
+	}
+
+	// Updated rows get a fresh update timestamp, like any other update
+	for _, field := range sch.Fields {
+		if field.AutoUpdateTime > 0 && field.DBName != "" && !seen[field.DBName] {
+			seen[field.DBName] = true
+			columns = append(columns, field.DBName)
+		}
+	}
+	onConflict.DoUpdates = clause.AssignmentColumns(columns)
+
+	// Soft deleted rows are brought back by the update, as the entities are live
+	if field := deletedAtField(sch); field != nil && !seen[field.DBName] {
+		onConflict.DoUpdates = append(onConflict.DoUpdates, clause.Assignment{
+			Column: clause.Column{Name: field.DBName},
+			Value:  nil,
+		})
+	}
+
+	// and versioned rows a new version, see Update
+	if field := versionField(sch); field != nil && !seen[field.DBName] {
+		onConflict.DoUpdates = append(onConflict.DoUpdates, clause.Assignment{
+			Column: clause.Column{Name: field.DBName},
+			Value: clause.Expr{
+				SQL:  "? + 1",
+				Vars: []any{clause.Column{Table: clause.CurrentTable, Name: field.DBName}},
+			},
+		})
+	}
+
+	return onConflict
+}
+
+// conflictCondition returns the condition of the partial unique index of the model on the
+// conflict columns, or "" when the columns have a unique index over all the rows or none
+// the model declares
+func conflictCondition(sch *schema.Schema, conflictFields []*schema.Field) string {
+	var where string
+	indexes := sch.ParseIndexes()
+	for _, name := range sortedKeys(indexes) {
+		index := indexes[name]
+		if index.Class != "UNIQUE" {
+			continue
+		}
+
+		var fields []*schema.Field
+		for _, option := range index.Fields {
+			fields = append(fields, option.Field)
+		}
+		if !sameColumns(fields, conflictFields) {
+			continue
+		}
+
+		if index.Where == "" {
+			return ""
+		}
+		if where == "" {
+			where = index.Where
+		}
+	}
+	return where
+}
+
+// sameColumns reports whether a and b are the fields of the same columns, in any order
+func sameColumns(a, b []*schema.Field) bool {
+	columnsA, columnsB := fieldColumns(a), fieldColumns(b)
+	slices.Sort(columnsA)
+	slices.Sort(columnsB)
+	return slices.Equal(columnsA, columnsB)
+}
+
+// countExisting counts the rows (soft deleted ones included) conflicting with the entities,
+// out of the rows matching the target condition of a partial index
+func countExisting[T any](ctx context.Context, tx *gorm.DB, sch *schema.Schema, fields []*schema.Field, target clause.Where, entities []T) (int64, error) {
+	var total int64
+	for start := 0; start < len(entities); start += defaultBatchSize {
+		end := min(start+defaultBatchSize, len(entities))
+
+		var keys []clause.Expression
+		for i := start; i < end; i++ {
+			rv := reflect.ValueOf(&entities[i]).Elem()
+
+			var key []clause.Expression
+			for _, field := range fields {
+				value, _ := field.ValueOf(ctx, rv)
+				key = append(key, clause.Eq{
+					Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName},
+					Value:  value,
+				})
+			}
+			keys = append(keys, joinExpressions(key, false))
+		}
+
+		query := tx.Unscoped().Model(new(T)).Where(joinExpressions(keys, true))
+		for _, expr := range target.Exprs {
+			query = query.Where(expr)
+		}
+
+		var count int64
+		err := query.Count(&count).Error
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/glebarez/go-sqlite"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Constraint names are only reported in the messages of mysql and sqlserver
+var (
+	mysqlUniqueKey    = regexp.MustCompile(`for key '([^']+)'`)
+	mysqlForeignKey   = regexp.MustCompile("CONSTRAINT `([^`]+)`")
+	sqlserverQuoted   = regexp.MustCompile(`constraint ['"]([^'"]+)['"]`)
+	sqlserverIndex    = regexp.MustCompile(`unique index '([^']+)'`)
+	sqliteConstrained = regexp.MustCompile(`(?:UNIQUE|PRIMARY KEY) constraint failed: ([^ ]+)`)
+)
+
+// sqlserverError is implemented by the errors of the sqlserver driver
+type sqlserverError interface {
+	SQLErrorNumber() int32
+	SQLErrorMessage() string
+}
+
+// classifyError maps an error returned by GORM or a driver to the errors of the package,
+// errors that are already classified or not known are returned as is
+func classifyError(err error) error {
+	if err == nil || isClassified(err) {
+		return err
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	var (
+		pgErr        *pgconn.PgError
+		mysqlErr     *mysql.MySQLError
+		sqlserverErr sqlserverError
+		sqliteErr    *sqlite.Error
+		netErr       net.Error
+	)
+	switch {
+	case errors.As(err, &pgErr):
+		return classifyPostgres(err, pgErr)
+	case errors.As(err, &mysqlErr):
+		return classifyMySQL(err, mysqlErr)
+	case errors.As(err, &sqlserverErr):
+		return classifySQLServer(err, sqlserverErr)
+	case errors.As(err, &sqliteErr):
+		return classifySQLite(err, sqliteErr)
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// isClassified reports if err was already classified by classifyError
+func isClassified(err error) bool {
+	for _, kind := range []error{ErrNotFound, ErrUniqueViolation, ErrForeignKeyViolation, ErrDeadlock, ErrSerialization, ErrLockNotAvailable, ErrTimeout} {
+		if errors.Is(err, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+func classifyPostgres(err error, pgErr *pgconn.PgError) error {
+	switch pgErr.Code {
+	case "23505": // unique_violation
+		return &ConstraintError{Kind: ErrUniqueViolation, Constraint: pgErr.ConstraintName, Err: err}
+	case "23503": // foreign_key_violation
+		return &ConstraintError{Kind: ErrForeignKeyViolation, Constraint: pgErr.ConstraintName, Err: err}
+	case "40P01": // deadlock_detected
+		return fmt.Errorf("%w: %w", ErrDeadlock, err)
+	case "40001": // serialization_failure
+		return fmt.Errorf("%w: %w", ErrSerialization, err)
+	case "55P03": // lock_not_available (NOWAIT, lock_timeout)
+		return fmt.Errorf("%w: %w", ErrLockNotAvailable, err)
+	case "57014": // query_canceled (statement_timeout)
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+func classifyMySQL(err error, mysqlErr *mysql.MySQLError) error {
+	switch mysqlErr.Number {
+	case 1062: // ER_DUP_ENTRY
+		constraint := submatch(mysqlUniqueKey, mysqlErr.Message)
+		// MySQL 8 prefixes the index name with its table
+		if i := strings.LastIndexByte(constraint, '.'); i >= 0 {
+			constraint = constraint[i+1:]
+		}
+		return &ConstraintError{Kind: ErrUniqueViolation, Constraint: constraint, Err: err}
+	case 1451, 1452: // ER_ROW_IS_REFERENCED_2, ER_NO_REFERENCED_ROW_2
+		return &ConstraintError{Kind: ErrForeignKeyViolation, Constraint: submatch(mysqlForeignKey, mysqlErr.Message), Err: err}
+	case 1213: // ER_LOCK_DEADLOCK
+		return fmt.Errorf("%w: %w", ErrDeadlock, err)
+	case 3572: // ER_LOCK_NOWAIT
+		return fmt.Errorf("%w: %w", ErrLockNotAvailable, err)
+	case 1205, 3024: // ER_LOCK_WAIT_TIMEOUT, ER_QUERY_TIMEOUT (max_execution_time)
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// https://learn.microsoft.com/en-us/sql/relational-databases/errors-events/database-engine-events-and-errors
+func classifySQLServer(err error, sqlserverErr sqlserverError) error {
+	message := sqlserverErr.SQLErrorMessage()
+	switch sqlserverErr.SQLErrorNumber() {
+	case 2627: // Violation of PRIMARY KEY or UNIQUE KEY constraint
+		return &ConstraintError{Kind: ErrUniqueViolation, Constraint: submatch(sqlserverQuoted, message), Err: err}
+	case 2601: // Duplicate key row in object with unique index
+		return &ConstraintError{Kind: ErrUniqueViolation, Constraint: submatch(sqlserverIndex, message), Err: err}
+	case 547: // Conflict with a FOREIGN KEY, REFERENCE or CHECK constraint
+		if strings.Contains(message, "FOREIGN KEY") || strings.Contains(message, "REFERENCE") {
+			return &ConstraintError{Kind: ErrForeignKeyViolation, Constraint: submatch(sqlserverQuoted, message), Err: err}
+		}
+	case 1205: // Transaction was deadlocked
+		return fmt.Errorf("%w: %w", ErrDeadlock, err)
+	case 3960, 3961: // Snapshot isolation update conflict
+		return fmt.Errorf("%w: %w", ErrSerialization, err)
+	case 1222: // Lock request time out period exceeded (NOWAIT, LOCK_TIMEOUT)
+		return fmt.Errorf("%w: %w", ErrLockNotAvailable, err)
+	}
+	return err
+}
+
+// https://www.sqlite.org/rescode.html
+func classifySQLite(err error, sqliteErr *sqlite.Error) error {
+	switch sqliteErr.Code() {
+	case 2067, 1555: // SQLITE_CONSTRAINT_UNIQUE, SQLITE_CONSTRAINT_PRIMARYKEY
+		return &ConstraintError{Kind: ErrUniqueViolation, Constraint: submatch(sqliteConstrained, sqliteErr.Error()), Err: err}
+	case 787: // SQLITE_CONSTRAINT_FOREIGNKEY
+		return &ConstraintError{Kind: ErrForeignKeyViolation, Err: err}
+	}
+
+	// The busy timeout expired, extended codes carry the primary one in their low byte
+	switch sqliteErr.Code() & 0xff {
+	case 5, 6: // SQLITE_BUSY, SQLITE_LOCKED
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// submatch returns the first group of re in s, or an empty string
+func submatch(re *regexp.Regexp, s string) string {
+	match := re.FindStringSubmatch(s)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
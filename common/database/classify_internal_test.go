@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+type fakeSQLServerError struct {
+	number  int32
+	message string
+}
+
+func (e fakeSQLServerError) Error() string           { return e.message }
+func (e fakeSQLServerError) SQLErrorNumber() int32   { return e.number }
+func (e fakeSQLServerError) SQLErrorMessage() string { return e.message }
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		want       error
+		constraint string
+	}{
+		{"not found", gorm.ErrRecordNotFound, ErrNotFound, ""},
+		{"deadline", context.DeadlineExceeded, ErrTimeout, ""},
+		{"network timeout", fmt.Errorf("dial: %w", timeoutError{}), ErrTimeout, ""},
+
+		{"postgres unique", &pgconn.PgError{Code: "23505", ConstraintName: "idx_users_email"}, ErrUniqueViolation, "idx_users_email"},
+		{"postgres foreign key", &pgconn.PgError{Code: "23503", ConstraintName: "fk_orders_user"}, ErrForeignKeyViolation, "fk_orders_user"},
+		{"postgres deadlock", &pgconn.PgError{Code: "40P01"}, ErrDeadlock, ""},
+		{"postgres serialization", &pgconn.PgError{Code: "40001"}, ErrSerialization, ""},
+		{"postgres lock", &pgconn.PgError{Code: "55P03"}, ErrLockNotAvailable, ""},
+		{"postgres statement timeout", &pgconn.PgError{Code: "57014"}, ErrTimeout, ""},
+
+		{"mysql unique", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'users.idx_users_email'"}, ErrUniqueViolation, "idx_users_email"},
+		{"mysql foreign key", &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails (`shop`.`orders`, CONSTRAINT `fk_orders_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`))"}, ErrForeignKeyViolation, "fk_orders_user"},
+		{"mysql deadlock", &mysql.MySQLError{Number: 1213}, ErrDeadlock, ""},
+		{"mysql nowait", &mysql.MySQLError{Number: 3572}, ErrLockNotAvailable, ""},
+		{"mysql lock wait timeout", &mysql.MySQLError{Number: 1205}, ErrTimeout, ""},
+
+		{"sqlserver unique", fakeSQLServerError{2627, "Violation of UNIQUE KEY constraint 'uq_users_email'."}, ErrUniqueViolation, "uq_users_email"},
+		{"sqlserver unique index", fakeSQLServerError{2601, "Cannot insert duplicate key row in object 'dbo.users' with unique index 'idx_users_email'."}, ErrUniqueViolation, "idx_users_email"},
+		{"sqlserver foreign key", fakeSQLServerError{547, `The INSERT statement conflicted with the FOREIGN KEY constraint "fk_orders_user".`}, ErrForeignKeyViolation, "fk_orders_user"},
+		{"sqlserver deadlock", fakeSQLServerError{1205, "Transaction was deadlocked"}, ErrDeadlock, ""},
+		{"sqlserver snapshot", fakeSQLServerError{3960, "Snapshot isolation transaction aborted"}, ErrSerialization, ""},
+		{"sqlserver lock", fakeSQLServerError{1222, "Lock request time out period exceeded."}, ErrLockNotAvailable, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// GORM hands the driver errors wrapped
+			err := classifyError(fmt.Errorf("query: %w", test.err))
+			if !errors.Is(err, test.want) {
+				t.Fatalf("got %v, want %v", err, test.want)
+			}
+			if !errors.Is(err, test.err) {
+				t.Errorf("driver error dropped from %v", err)
+			}
+
+			var constraintErr *ConstraintError
+			isConstraint := errors.As(err, &constraintErr)
+			switch {
+			case isConstraint != (test.want == ErrUniqueViolation || test.want == ErrForeignKeyViolation):
+				t.Errorf("got %T, ConstraintError expected only for constraint violations", err)
+			case isConstraint && constraintErr.Constraint != test.constraint:
+				t.Errorf("constraint: got %q, want %q", constraintErr.Constraint, test.constraint)
+			}
+
+			if again := classifyError(err); again != err {
+				t.Errorf("classified again: got %v", again)
+			}
+		})
+	}
+}
+
+func TestClassifyErrorUnknown(t *testing.T) {
+	errs := []error{
+		errors.New("boom"),
+		&pgconn.PgError{Code: "42601"},
+		&mysql.MySQLError{Number: 1064},
+		fakeSQLServerError{547, `The INSERT statement conflicted with the CHECK constraint "ck_price".`},
+	}
+	for _, err := range errs {
+		if got := classifyError(err); got != err || isClassified(got) {
+			t.Errorf("%v: got %v, want it as is", err, got)
+		}
+	}
+	if classifyError(nil) != nil {
+		t.Error("nil error classified")
+	}
+}
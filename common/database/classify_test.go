@@ -0,0 +1,70 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+)
+
+type parent struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+type child struct {
+	ID       uint `gorm:"primaryKey"`
+	ParentID uint
+	Parent   parent
+}
+
+func TestClassifySQLite(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.New(t, &databasetest.Record{}, &parent{}, &child{}).Instance()
+	records := database.NewSQLHandler[databasetest.Record](db)
+	parents := database.NewSQLHandler[parent](db)
+	children := database.NewSQLHandler[child](db)
+
+	if err := records.Create(ctx, &databasetest.Record{Name: "alpha"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	err := records.Create(ctx, &databasetest.Record{Name: "alpha"})
+	var constraintErr *database.ConstraintError
+	switch {
+	case !errors.Is(err, database.ErrUniqueViolation) || errors.Is(err, database.ErrForeignKeyViolation):
+		t.Errorf("duplicate: got %v, want ErrUniqueViolation", err)
+	case !errors.As(err, &constraintErr):
+		t.Errorf("duplicate: got %T, want *ConstraintError", err)
+	case constraintErr.Constraint != "records.name":
+		t.Errorf("duplicate: got constraint %q, want records.name", constraintErr.Constraint)
+	}
+
+	err = children.Create(ctx, &child{ParentID: 42})
+	if !errors.Is(err, database.ErrForeignKeyViolation) || !errors.As(err, &constraintErr) {
+		t.Errorf("missing parent: got %v, want a ConstraintError matching ErrForeignKeyViolation", err)
+	}
+
+	p := parent{Name: "ada"}
+	if err := parents.Create(ctx, &p); err != nil {
+		t.Fatalf("create parent: %v", err)
+	}
+	if err := children.Create(ctx, &child{ParentID: p.ID}); err != nil {
+		t.Fatalf("create child: %v", err)
+	}
+	err = parents.Delete(ctx, database.QueryFilter{WhereMap: map[string]any{"id": p.ID}})
+	if !errors.Is(err, database.ErrForeignKeyViolation) {
+		t.Errorf("delete of a referenced parent: got %v, want ErrForeignKeyViolation", err)
+	}
+
+	_, err = records.Get(ctx, database.QueryFilter{WhereMap: map[string]any{"name": "missing"}}, nil)
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("get missing: got %v, want ErrNotFound", err)
+	}
+
+	// Classified errors are neither retried nor classified again
+	if database.IsRetryable(err) || errors.Is(err, database.ErrUniqueViolation) {
+		t.Errorf("not found: got %v, classified as more than ErrNotFound", err)
+	}
+}
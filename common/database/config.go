@@ -1,16 +1,78 @@
 package database
 
+import "time"
+
 // Config struct holds necessary fields for
 // a new client to connect to the DB
 type Config struct {
-	Driver             string
+	// Driver is one of mysql, postgres (or postgresql), sqlserver or sqlite
+	Driver string
+
+	// ConnectionString is the host of the database server, for sqlite it is
+	// the path of the database file or ":memory:" for an in-memory database
 	ConnectionString   string
 	Port               string
 	Username           string
 	Password           string
 	MaxOpenConnections int
 	MaxIdleConnections int
-	SSLEnabled         bool
 	SchemaName         string
 	DBName             string
+
+	// ConnMaxLifetime and ConnMaxIdleTime recycle pooled connections, so that the pool
+	// follows failovers and DNS changes and does not hold on to idle connections
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// DialTimeout bounds the time spent establishing a connection
+	DialTimeout time.Duration
+
+	// StatementTimeout makes the server abort statements running for longer, it is
+	// supported by postgres and by mysql (for SELECT statements only)
+	StatementTimeout time.Duration
+
+	// ConnectAttempts is the number of attempts made to reach the database on Connect,
+	// waiting ConnectBackoff (doubled after every attempt) in between. Defaults to 5
+	// attempts with an initial backoff of 500ms.
+	ConnectAttempts int
+	ConnectBackoff  time.Duration
+
+	// SSLEnabled enables TLS in verify-full mode when SSLMode is not set
+	SSLEnabled bool
+
+	// SSLMode is one of disable, require (encrypted but not verified), verify-ca (the
+	// server certificate is signed by SSLRootCert) or verify-full (verify-ca and the
+	// certificate matches the host)
+	SSLMode string
+
+	// SSLRootCert is the path of the PEM CA bundle verifying the server certificate,
+	// the system pool is used when empty
+	SSLRootCert string
+
+	// SSLCert and SSLKey are the paths of the PEM client certificate and key, for
+	// servers requiring client certificate authentication
+	SSLCert string
+	SSLKey  string
+
+	// Replicas are read replicas of the database, sharing its driver, credentials and
+	// database name. Reads made outside of transactions are balanced over the healthy
+	// replicas, see ReadYourWrites to read from the primary instead.
+	Replicas []Replica
+
+	// Retry, if set, retries the transactions of SQLDatabase.RunInTx failing with
+	// transient errors, see RetryPolicy
+	Retry *RetryPolicy
+
+	// Observability, if set, traces the statements, records their latency and logs the
+	// slow ones, see Instrument
+	Observability *Observability
+
+	// Audit records the writes of Auditable models in the audit trail, see RegisterAudit
+	Audit bool
+}
+
+// Replica holds the address of a read replica
+type Replica struct {
+	ConnectionString string
+	Port             string
 }
@@ -0,0 +1,12 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+)
+
+func TestConformance(t *testing.T) {
+	databasetest.RunBackends(t, []any{&databasetest.Record{}}, []database.Option{databasetest.CursorKey}, databasetest.RunConformance)
+}
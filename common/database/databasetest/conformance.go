@@ -0,0 +1,721 @@
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"gorm.io/gorm"
+)
+
+// Record is the model exercised by RunConformance
+type Record struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"uniqueIndex"`
+	Category  string
+	Score     int
+	Rating    *float64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Version   uint           `gorm:"not null;default:0"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// SQLiteRecords returns a SQLHandler of records on a new in-memory SQLite database
+func SQLiteRecords(t *testing.T) database.Repository[Record] {
+	return database.NewSQLHandler[Record](New(t, &Record{}).Instance(), CursorKey)
+}
+
+// RunConformance checks that a Repository behaves like a SQLHandler on SQLite. newRepository
+// is called by every subtest for a repository over an empty table of records, typically
+// handed by RunBackends:
+//
+//	func TestConformance(t *testing.T) {
+//		databasetest.RunBackends(t, []any{&databasetest.Record{}}, []database.Option{databasetest.CursorKey}, databasetest.RunConformance)
+//	}
+func RunConformance(t *testing.T, newRepository func(t *testing.T) database.Repository[Record]) {
+	t.Helper()
+
+	for _, c := range conformanceCases {
+		t.Run(c.name, func(t *testing.T) {
+			repo := newRepository(t)
+			c.run(t, context.Background(), repo)
+		})
+	}
+}
+
+type conformanceCase struct {
+	name string
+	run  func(t *testing.T, ctx context.Context, repo database.Repository[Record])
+}
+
+var conformanceCases = []conformanceCase{
+	{"create", testCreate},
+	{"create batch", testCreateBatch},
+	{"where map", testWhereMap},
+	{"expressions", testExpressions},
+	{"or", testOr},
+	{"search", testSearch},
+	{"order and limit", testOrderAndLimit},
+	{"projection", testProjection},
+	{"update", testUpdate},
+	{"soft delete", testSoftDelete},
+	{"count and batch", testCountAndBatch},
+	{"pagination", testPagination},
+	{"upsert", testUpsert},
+	{"transactions", testTransactions},
+	{"invalid filters", testInvalidFilters},
+}
+
+func rating(r float64) *float64 {
+	return &r
+}
+
+// seed creates the records used by most of the cases:
+//
+//	name    category score rating
+//	alpha   fruit    10    4.5
+//	Bravo   fruit    20    NULL
+//	charlie veggie   20    2
+//	delta   veggie   30    NULL
+//	echo_1  nuts     40    5
+func seed(t *testing.T, ctx context.Context, repo database.Repository[Record]) []Record {
+	t.Helper()
+
+	records := []Record{
+		{Name: "alpha", Category: "fruit", Score: 10, Rating: rating(4.5)},
+		{Name: "Bravo", Category: "fruit", Score: 20},
+		{Name: "charlie", Category: "veggie", Score: 20, Rating: rating(2)},
+		{Name: "delta", Category: "veggie", Score: 30},
+		{Name: "echo_1", Category: "nuts", Score: 40, Rating: rating(5)},
+	}
+	for i := range records {
+		err := repo.Create(ctx, &records[i])
+		if err != nil {
+			t.Fatalf("create %s: %v", records[i].Name, err)
+		}
+	}
+	return records
+}
+
+func names(records []Record) []string {
+	out := make([]string, len(records))
+	for i, r := range records {
+		out[i] = r.Name
+	}
+	return out
+}
+
+// expectNames lists the records matching the filter and compares their names, in order
+// unless sorted is false
+func expectNames(t *testing.T, ctx context.Context, repo database.Repository[Record], qf database.QueryFilter, sorted bool, want ...string) {
+	t.Helper()
+
+	records, err := repo.List(ctx, qf, nil)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	got := names(records)
+	if !sorted {
+		slices.Sort(got)
+		want = slices.Clone(want)
+		slices.Sort(want)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("list %+v: got %q, want %q", qf, got, want)
+	}
+}
+
+func expectError(t *testing.T, what string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s: got error %v, want %v", what, err, want)
+	}
+}
+
+func testCreate(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	records := seed(t, ctx, repo)
+	for i, r := range records {
+		if r.ID != uint(i+1) {
+			t.Errorf("%s: got id %d, want %d", r.Name, r.ID, i+1)
+		}
+		if r.CreatedAt.IsZero() || r.UpdatedAt.IsZero() {
+			t.Errorf("%s: timestamps were not set", r.Name)
+		}
+	}
+
+	got, err := repo.Get(ctx, database.QueryFilter{WhereMap: map[string]any{"id": records[2].ID}}, nil)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Name != "charlie" || got.Score != 20 || got.Rating == nil || *got.Rating != 2 {
+		t.Errorf("get: got %+v", got)
+	}
+
+	_, err = repo.Get(ctx, database.QueryFilter{WhereMap: map[string]any{"id": 42}}, nil)
+	expectError(t, "get missing", err, database.ErrNotFound)
+
+	err = repo.Create(ctx, &Record{Name: "alpha"})
+	expectError(t, "create duplicate", err, database.ErrUniqueViolation)
+
+	explicit := Record{ID: 10, Name: "explicit"}
+	err = repo.Create(ctx, &explicit)
+	if err != nil {
+		t.Fatalf("create with id: %v", err)
+	}
+	next := Record{Name: "next"}
+	err = repo.Create(ctx, &next)
+	if err != nil {
+		t.Fatalf("create after explicit id: %v", err)
+	}
+	if next.ID != 11 {
+		t.Errorf("create after explicit id: got id %d, want 11", next.ID)
+	}
+}
+
+func testCreateBatch(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	batch := []Record{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	err := repo.CreateBatch(ctx, batch, 2)
+	if err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	if batch[2].ID != 3 {
+		t.Errorf("create batch: got id %d, want 3", batch[2].ID)
+	}
+
+	// A conflicting batch is rolled back as a whole
+	err = repo.CreateBatch(ctx, []Record{{Name: "d"}, {Name: "a"}}, 0)
+	expectError(t, "create conflicting batch", err, database.ErrUniqueViolation)
+	expectNames(t, ctx, repo, database.QueryFilter{}, false, "a", "b", "c")
+}
+
+func testWhereMap(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	seed(t, ctx, repo)
+
+	expectNames(t, ctx, repo, database.QueryFilter{WhereMap: map[string]any{"category": "fruit"}}, false, "alpha", "Bravo")
+	expectNames(t, ctx, repo, database.QueryFilter{WhereMap: map[string]any{"category": "veggie", "score": 30}}, false, "delta")
+	expectNames(t, ctx, repo, database.QueryFilter{WhereMap: map[string]any{"Score": uint8(20)}}, false, "Bravo", "charlie")
+	expectNames(t, ctx, repo, database.QueryFilter{WhereMap: map[string]any{"rating": nil}}, false, "Bravo", "delta")
+	expectNames(t, ctx, repo, database.QueryFilter{WhereMap: map[string]any{"score": []int{10, 40}}}, false, "alpha", "echo_1")
+	expectNames(t, ctx, repo, database.QueryFilter{WhereMap: map[string]any{"records.name": "delta"}}, false, "delta")
+	expectNames(t, ctx, repo, database.QueryFilter{RegexFilter: map[string]string{"name": "^[a-c]"}}, false, "alpha", "charlie")
+}
+
+func testExpressions(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	seed(t, ctx, repo)
+
+	cases := []struct {
+		expr database.Expr
+		want []string
+	}{
+		{database.Gt("score", 20), []string{"delta", "echo_1"}},
+		{database.Lte("rating", 4.5), []string{"alpha", "charlie"}},
+		// Comparisons with NULL are unknown, so are their negations
+		{database.Not(database.Gt("rating", 3)), []string{"charlie"}},
+		{database.Ne("rating", 2), []string{"alpha", "echo_1"}},
+		{database.Ne("rating", nil), []string{"alpha", "charlie", "echo_1"}},
+		{database.IsNull("rating"), []string{"Bravo", "delta"}},
+		{database.In("category", "nuts", "veggie"), []string{"charlie", "delta", "echo_1"}},
+		{database.In("score", []int{10, 30}), []string{"alpha", "delta"}},
+		{database.NotIn("rating", 2, 5), []string{"alpha"}},
+		{database.In("name"), nil},
+		{database.NotIn("rating"), []string{"alpha", "Bravo", "charlie", "delta", "echo_1"}},
+		{database.Between("score", 20, 30), []string{"Bravo", "charlie", "delta"}},
+		{database.Or(database.Eq("score", 10), database.IsNull("rating")), []string{"alpha", "Bravo", "delta"}},
+		{database.And(database.Eq("category", "veggie"), database.Or(database.Gt("rating", 1), database.Eq("score", 40))), []string{"charlie"}},
+		{database.Or(database.IsNull("rating"), database.Not(database.Lt("rating", 4))), []string{"alpha", "Bravo", "delta", "echo_1"}},
+		{database.And(), []string{"alpha", "Bravo", "charlie", "delta", "echo_1"}},
+		{database.HasPrefix("name", "b"), nil},
+		{database.IHasPrefix("name", "b"), []string{"Bravo"}},
+		{database.Contains("name", "o_"), []string{"echo_1"}},
+		{database.Contains("name", "a%"), nil},
+		{database.IContains("name", "RAV"), []string{"Bravo"}},
+		{database.EqualFold("name", "BRAVO"), []string{"Bravo"}},
+		{database.Like("name", "%a"), []string{"alpha", "delta"}},
+		{database.Regex("category", "^v"), []string{"charlie", "delta"}},
+		{database.IRegex("name", "^B"), []string{"Bravo"}},
+	}
+	for _, c := range cases {
+		expectNames(t, ctx, repo, database.QueryFilter{Where: c.expr}, false, c.want...)
+	}
+}
+
+func testOr(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	seed(t, ctx, repo)
+
+	expectNames(t, ctx, repo, database.QueryFilter{
+		WhereMap: map[string]any{"category": "fruit"},
+		Or: []database.QueryFilter{
+			{WhereMap: map[string]any{"score": 40}},
+			{Where: database.Eq("name", "delta")},
+		},
+	}, false, "alpha", "Bravo", "delta", "echo_1")
+
+	expectNames(t, ctx, repo, database.QueryFilter{
+		Or: []database.QueryFilter{
+			{WhereMap: map[string]any{"category": "veggie", "score": 20}},
+			{Where: database.Gt("rating", 4.9)},
+		},
+	}, false, "charlie", "echo_1")
+}
+
+func testSearch(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	seed(t, ctx, repo)
+
+	expectNames(t, ctx, repo, database.QueryFilter{Where: database.Search("Fruit", "name", "category")}, false, "alpha", "Bravo")
+	expectNames(t, ctx, repo, database.QueryFilter{Where: database.Search("bravo, fruit!", "name", "category")}, false, "Bravo")
+	expectNames(t, ctx, repo, database.QueryFilter{Where: database.Search("echo", "name")}, false, "echo_1")
+	expectNames(t, ctx, repo, database.QueryFilter{
+		Where: database.Or(database.Search("nuts", "category"), database.Eq("name", "alpha")),
+	}, false, "alpha", "echo_1")
+
+	// Every word has to be found, each in any of the columns
+	expectNames(t, ctx, repo, database.QueryFilter{Where: database.Search("bravo delta", "name")}, false)
+	expectNames(t, ctx, repo, database.QueryFilter{Where: database.Search("VEGGIE char", "name", "category")}, false, "charlie")
+	expectNames(t, ctx, repo, database.QueryFilter{Where: database.Search("veggie alpha", "name", "category")}, false)
+
+	// Punctuation and the operators of the full-text syntaxes are words separators
+	expectNames(t, ctx, repo, database.QueryFilter{Where: database.Search(`+alpha* -"fruit"`, "name", "category")}, false, "alpha")
+	expectNames(t, ctx, repo, database.QueryFilter{Where: database.Search("(nuts | echo) & !1:*", "name", "category")}, false, "echo_1")
+
+	// A NULL column matches no word, but another column may
+	expectNames(t, ctx, repo, database.QueryFilter{Where: database.Search("4", "rating")}, false, "alpha")
+	expectNames(t, ctx, repo, database.QueryFilter{Where: database.Search("bravo", "name", "rating")}, false, "Bravo")
+	expectNames(t, ctx, repo, database.QueryFilter{Where: database.Not(database.Search("4", "rating"))}, false, "charlie", "echo_1")
+
+	// Ranks count the columns each word is found in on SQLite
+	records, err := repo.List(ctx, database.QueryFilter{Where: database.Search("a", "name"), OrderBy: "relevance DESC, name"},
+		&database.Projection{Ranks: []database.SearchRank{{Query: "a fruit", Columns: []string{"name", "category"}, Alias: "relevance"}}})
+	switch {
+	case errors.Is(err, database.ErrUnsupportedFilter):
+	case err != nil:
+		t.Errorf("list ranked: %v", err)
+	case !slices.Equal(names(records), []string{"Bravo", "alpha", "charlie", "delta"}):
+		t.Errorf("list ranked: got %q", names(records))
+	case records[1].Score != 10 || records[1].Category != "fruit":
+		t.Errorf("list ranked: got %+v", records[1])
+	}
+
+	// NULL columns add nothing to the rank, which can be selected along with other fields
+	records, err = repo.List(ctx, database.QueryFilter{OrderBy: "relevance DESC, id", Limit: 2},
+		&database.Projection{Fields: []string{"name"}, Ranks: []database.SearchRank{{Query: "4 fruit", Columns: []string{"name", "category", "rating"}, Alias: "relevance"}}})
+	switch {
+	case errors.Is(err, database.ErrUnsupportedFilter):
+	case err != nil:
+		t.Errorf("list ranked fields: %v", err)
+	case !slices.Equal(names(records), []string{"alpha", "Bravo"}):
+		t.Errorf("list ranked fields: got %q", names(records))
+	case records[0].Category != "" || records[0].Rating != nil:
+		t.Errorf("list ranked fields: got %+v", records[0])
+	}
+
+	invalid := []database.Expr{
+		database.Search("%_!", "name"),
+		database.Search("alpha"),
+		database.Search("alpha", "missing"),
+	}
+	for _, expr := range invalid {
+		_, err := repo.List(ctx, database.QueryFilter{Where: expr}, nil)
+		expectError(t, fmt.Sprintf("search %+v", expr), err, database.ErrInvalidFilter)
+	}
+}
+
+func testOrderAndLimit(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	seed(t, ctx, repo)
+
+	expectNames(t, ctx, repo, database.QueryFilter{OrderBy: "score desc, name"}, true, "echo_1", "delta", "Bravo", "charlie", "alpha")
+	expectNames(t, ctx, repo, database.QueryFilter{OrderBy: "score, name DESC"}, true, "alpha", "charlie", "Bravo", "delta", "echo_1")
+
+	// NULLs sort first in ascending order
+	expectNames(t, ctx, repo, database.QueryFilter{OrderBy: "rating, id"}, true, "Bravo", "delta", "charlie", "alpha", "echo_1")
+	expectNames(t, ctx, repo, database.QueryFilter{OrderBy: "rating desc, id"}, true, "echo_1", "alpha", "charlie", "Bravo", "delta")
+
+	expectNames(t, ctx, repo, database.QueryFilter{OrderBy: "id", Limit: 2}, true, "alpha", "Bravo")
+	expectNames(t, ctx, repo, database.QueryFilter{OrderBy: "id", Limit: 2, Offset: 3}, true, "delta", "echo_1")
+
+	got, err := repo.Get(ctx, database.QueryFilter{WhereMap: map[string]any{"score": 20}}, nil)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Name != "Bravo" {
+		t.Errorf("get without ordering: got %s, want the lowest id", got.Name)
+	}
+
+	got, err = repo.Get(ctx, database.QueryFilter{OrderBy: "score desc"}, nil)
+	if err != nil {
+		t.Fatalf("get ordered: %v", err)
+	}
+	if got.Name != "echo_1" {
+		t.Errorf("get ordered: got %s, want echo_1", got.Name)
+	}
+}
+
+func testProjection(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	seed(t, ctx, repo)
+
+	records, err := repo.List(ctx, database.QueryFilter{OrderBy: "id", Limit: 1}, &database.Projection{Fields: []string{"name", "Score"}})
+	if err != nil {
+		t.Fatalf("list fields: %v", err)
+	}
+	if len(records) != 1 || records[0] != (Record{Name: "alpha", Score: 10}) {
+		t.Errorf("list fields: got %+v", records)
+	}
+
+	records, err = repo.List(ctx, database.QueryFilter{OrderBy: "id", Limit: 1, Pluck: "category"}, nil)
+	if err != nil {
+		t.Fatalf("list plucked: %v", err)
+	}
+	if len(records) != 1 || records[0] != (Record{Category: "fruit"}) {
+		t.Errorf("list plucked: got %+v", records)
+	}
+
+	got, err := repo.Get(ctx, database.QueryFilter{WhereMap: map[string]any{"name": "alpha"}},
+		&database.Projection{Exclude: []string{"rating", "Category"}})
+	if err != nil {
+		t.Fatalf("get excluded: %v", err)
+	}
+	if got.ID != 1 || got.Name != "alpha" || got.Score != 10 || got.Rating != nil || got.Category != "" {
+		t.Errorf("get excluded: got %+v", got)
+	}
+}
+
+func testUpdate(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	records := seed(t, ctx, repo)
+
+	err := repo.Update(ctx, database.QueryFilter{
+		WhereMap:  map[string]any{"category": "fruit"},
+		UpdateMap: map[string]any{"score": 15, "Rating": 1.5},
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	expectNames(t, ctx, repo, database.QueryFilter{Where: database.And(database.Eq("score", 15), database.Eq("rating", 1.5))}, false, "alpha", "Bravo")
+
+	got, err := repo.Get(ctx, database.QueryFilter{WhereMap: map[string]any{"name": "alpha"}}, nil)
+	if err != nil {
+		t.Fatalf("get updated: %v", err)
+	}
+	if got.Version != 1 {
+		t.Errorf("update: got version %d, want 1", got.Version)
+	}
+
+	// Optimistic concurrency control with the version read by the caller
+	err = repo.Update(ctx, database.QueryFilter{
+		WhereMap:  map[string]any{"id": got.ID},
+		UpdateMap: map[string]any{"score": 16, "version": got.Version},
+	})
+	if err != nil {
+		t.Fatalf("versioned update: %v", err)
+	}
+	err = repo.Update(ctx, database.QueryFilter{
+		WhereMap:  map[string]any{"id": got.ID},
+		UpdateMap: map[string]any{"score": 17, "version": got.Version},
+	})
+	expectError(t, "stale update", err, database.ErrConcurrentModification)
+
+	err = repo.Update(ctx, database.QueryFilter{
+		WhereMap:  map[string]any{"id": 42},
+		UpdateMap: map[string]any{"score": 17, "version": 0},
+	})
+	if err != nil {
+		t.Errorf("versioned update of a missing record: %v", err)
+	}
+
+	err = repo.Update(ctx, database.QueryFilter{
+		WhereMap:  map[string]any{"id": records[1].ID},
+		UpdateMap: map[string]any{"name": "alpha"},
+	})
+	expectError(t, "conflicting update", err, database.ErrUniqueViolation)
+
+	err = repo.Update(ctx, database.QueryFilter{UpdateMap: map[string]any{"score": 0}})
+	expectError(t, "update without conditions", err, gorm.ErrMissingWhereClause)
+
+	got, err = repo.Get(ctx, database.QueryFilter{WhereMap: map[string]any{"name": "alpha"}}, nil)
+	if err != nil {
+		t.Fatalf("get updated: %v", err)
+	}
+	if got.Score != 16 || got.Version != 2 {
+		t.Errorf("update: got score %d version %d, want 16 and 2", got.Score, got.Version)
+	}
+}
+
+func testSoftDelete(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	seed(t, ctx, repo)
+
+	err := repo.Delete(ctx, database.QueryFilter{WhereMap: map[string]any{"category": "veggie"}})
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	expectNames(t, ctx, repo, database.QueryFilter{}, false, "alpha", "Bravo", "echo_1")
+
+	deleted, err := repo.ListDeleted(ctx, database.QueryFilter{OrderBy: "name"}, nil)
+	if err != nil {
+		t.Fatalf("list deleted: %v", err)
+	}
+	if got := names(deleted); !slices.Equal(got, []string{"charlie", "delta"}) {
+		t.Errorf("list deleted: got %q", got)
+	}
+
+	// Deleted records keep their unique keys
+	err = repo.Create(ctx, &Record{Name: "delta"})
+	expectError(t, "create over a deleted record", err, database.ErrUniqueViolation)
+
+	err = repo.Delete(ctx, database.QueryFilter{})
+	expectError(t, "delete without conditions", err, gorm.ErrMissingWhereClause)
+
+	err = repo.Restore(ctx, database.QueryFilter{WhereMap: map[string]any{"name": "charlie"}})
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	expectNames(t, ctx, repo, database.QueryFilter{WhereMap: map[string]any{"category": "veggie"}}, false, "charlie")
+
+	purged, err := repo.Purge(ctx, time.Hour)
+	if err != nil || purged != 0 {
+		t.Errorf("purge recent: got %d, %v", purged, err)
+	}
+	purged, err = repo.Purge(ctx, -time.Second)
+	if err != nil || purged != 1 {
+		t.Errorf("purge: got %d, %v, want 1", purged, err)
+	}
+
+	deleted, err = repo.ListDeleted(ctx, database.QueryFilter{}, nil)
+	if err != nil || len(deleted) != 0 {
+		t.Errorf("list deleted after purge: got %q, %v", names(deleted), err)
+	}
+}
+
+func testCountAndBatch(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	seed(t, ctx, repo)
+
+	count, err := repo.Count(ctx, database.QueryFilter{Where: database.Gte("score", 20)})
+	if err != nil || count != 4 {
+		t.Errorf("count: got %d, %v, want 4", count, err)
+	}
+
+	exists, err := repo.Exists(ctx, database.QueryFilter{WhereMap: map[string]any{"category": "nuts"}})
+	if err != nil || !exists {
+		t.Errorf("exists: got %t, %v", exists, err)
+	}
+	exists, err = repo.Exists(ctx, database.QueryFilter{WhereMap: map[string]any{"category": "grain"}})
+	if err != nil || exists {
+		t.Errorf("exists missing: got %t, %v", exists, err)
+	}
+
+	batch, err := repo.Batch(ctx, "id", []any{1, 3, 42})
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	got := names(batch)
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"alpha", "charlie"}) {
+		t.Errorf("batch: got %q", got)
+	}
+
+	all, err := repo.All(ctx)
+	if err != nil || len(all) != 5 {
+		t.Errorf("all: got %d records, %v", len(all), err)
+	}
+}
+
+func testPagination(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	seed(t, ctx, repo)
+
+	qf := database.QueryFilter{OrderBy: "score desc", Limit: 2}
+	var pages [][]string
+	var last *database.Page[Record]
+	for {
+		page, err := repo.ListPage(ctx, qf, nil)
+		if err != nil {
+			t.Fatalf("list page: %v", err)
+		}
+		pages = append(pages, names(page.Items))
+		last = page
+		if page.NextCursor == "" {
+			break
+		}
+		qf.Cursor = page.NextCursor
+	}
+
+	want := [][]string{{"echo_1", "delta"}, {"charlie", "Bravo"}, {"alpha"}}
+	if fmt.Sprint(pages) != fmt.Sprint(want) {
+		t.Errorf("list pages: got %q, want %q", pages, want)
+	}
+
+	qf.Cursor = last.PrevCursor
+	page, err := repo.ListPage(ctx, qf, nil)
+	if err != nil {
+		t.Fatalf("list previous page: %v", err)
+	}
+	if got := names(page.Items); !slices.Equal(got, want[1]) || page.PrevCursor == "" {
+		t.Errorf("list previous page: got %q", got)
+	}
+
+	var visited []string
+	err = repo.ForEach(ctx, database.QueryFilter{Where: database.IsNull("rating"), OrderBy: "name"}, 1, func(r *Record) error {
+		visited = append(visited, r.Name)
+		return nil
+	})
+	if err != nil || !slices.Equal(visited, []string{"Bravo", "delta"}) {
+		t.Errorf("for each: got %q, %v", visited, err)
+	}
+
+	stream, err := repo.Stream(ctx, database.QueryFilter{OrderBy: "id", Offset: 3}, nil)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	var streamed []string
+	for stream.Next() {
+		streamed = append(streamed, stream.Entity().Name)
+	}
+	if err := stream.Err(); err != nil {
+		t.Errorf("stream: %v", err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Errorf("close stream: %v", err)
+	}
+	if !slices.Equal(streamed, []string{"delta", "echo_1"}) {
+		t.Errorf("stream: got %q", streamed)
+	}
+}
+
+func testUpsert(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	seed(t, ctx, repo)
+
+	result, err := repo.Upsert(ctx, []Record{
+		{Name: "alpha", Category: "other", Score: 11},
+		{Name: "foxtrot", Category: "nuts", Score: 50},
+	}, []string{"name"}, []string{"score"})
+	if err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if *result != (database.UpsertResult{Inserted: 1, Updated: 1}) {
+		t.Errorf("upsert: got %+v", result)
+	}
+
+	got, err := repo.Get(ctx, database.QueryFilter{WhereMap: map[string]any{"name": "alpha"}}, nil)
+	if err != nil {
+		t.Fatalf("get upserted: %v", err)
+	}
+	if got.Score != 11 || got.Category != "fruit" || got.Version != 1 {
+		t.Errorf("upsert: got %+v", got)
+	}
+
+	result, err = repo.Upsert(ctx, []Record{{Name: "Bravo", Score: 99}}, []string{"name"}, nil)
+	if err != nil {
+		t.Fatalf("upsert without updates: %v", err)
+	}
+	if *result != (database.UpsertResult{Unchanged: 1}) {
+		t.Errorf("upsert without updates: got %+v", result)
+	}
+	expectNames(t, ctx, repo, database.QueryFilter{WhereMap: map[string]any{"score": 99}}, false)
+
+	// Only the last of the entities with the same key is written
+	result, err = repo.Upsert(ctx, []Record{
+		{Name: "golf", Score: 1},
+		{Name: "charlie", Score: 2},
+		{Name: "golf", Score: 3},
+	}, []string{"name"}, []string{"score"})
+	if err != nil {
+		t.Fatalf("upsert of duplicate keys: %v", err)
+	}
+	if *result != (database.UpsertResult{Inserted: 1, Updated: 1}) {
+		t.Errorf("upsert of duplicate keys: got %+v", result)
+	}
+	expectNames(t, ctx, repo, database.QueryFilter{WhereMap: map[string]any{"score": 3}}, false, "golf")
+
+	// Updated rows are restored
+	err = repo.Delete(ctx, database.QueryFilter{WhereMap: map[string]any{"name": []string{"delta", "echo_1"}}})
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	result, err = repo.Upsert(ctx, []Record{{Name: "delta", Score: 31}}, []string{"name"}, []string{"score"})
+	if err != nil {
+		t.Fatalf("upsert of a deleted record: %v", err)
+	}
+	if *result != (database.UpsertResult{Updated: 1}) {
+		t.Errorf("upsert of a deleted record: got %+v", result)
+	}
+	expectNames(t, ctx, repo, database.QueryFilter{WhereMap: map[string]any{"category": "veggie"}}, false, "charlie", "delta")
+
+	result, err = repo.Upsert(ctx, []Record{{Name: "echo_1"}}, []string{"name"}, nil)
+	if err != nil || *result != (database.UpsertResult{Unchanged: 1}) {
+		t.Errorf("upsert of a deleted record without updates: got %+v, %v", result, err)
+	}
+	expectNames(t, ctx, repo, database.QueryFilter{WhereMap: map[string]any{"name": "echo_1"}}, false)
+}
+
+func testTransactions(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	errRollback := errors.New("rollback")
+
+	err := repo.RunInTx(ctx, func(tx *database.Tx) error {
+		err := repo.WithTx(tx).Create(ctx, &Record{Name: "rolled back"})
+		if err != nil {
+			return err
+		}
+		return errRollback
+	})
+	expectError(t, "rolled back transaction", err, errRollback)
+
+	err = repo.RunInTx(ctx, func(tx *database.Tx) error {
+		txRepo := repo.WithTx(tx)
+		err := txRepo.Create(ctx, &Record{Name: "committed"})
+		if err != nil {
+			return err
+		}
+
+		// A failing savepoint only rolls back its own writes
+		err = tx.RunInTx(ctx, func(tx *database.Tx) error {
+			err := repo.WithTx(tx).Create(ctx, &Record{Name: "savepoint"})
+			if err != nil {
+				return err
+			}
+			return errRollback
+		})
+		expectError(t, "rolled back savepoint", err, errRollback)
+
+		records, err := txRepo.List(ctx, database.QueryFilter{Lock: database.RowLock{Mode: database.LockForUpdate}}, nil)
+		if err != nil {
+			return err
+		}
+		if got := names(records); !slices.Equal(got, []string{"committed"}) {
+			t.Errorf("read within transaction: got %q", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+	expectNames(t, ctx, repo, database.QueryFilter{}, false, "committed")
+}
+
+func testInvalidFilters(t *testing.T, ctx context.Context, repo database.Repository[Record]) {
+	seed(t, ctx, repo)
+
+	filters := []database.QueryFilter{
+		{WhereMap: map[string]any{"missing": 1}},
+		{WhereMap: map[string]any{"name; DROP TABLE records": 1}},
+		{Where: database.Gt("missing", 1)},
+		{OrderBy: "missing"},
+		{OrderBy: "name sideways"},
+		{Pluck: "missing"},
+		{Or: []database.QueryFilter{{WhereMap: map[string]any{"missing": 1}}}},
+		{Lock: database.RowLock{Mode: database.LockForUpdate}},
+	}
+	for _, qf := range filters {
+		_, err := repo.List(ctx, qf, nil)
+		expectError(t, fmt.Sprintf("list %+v", qf), err, database.ErrInvalidFilter)
+	}
+
+	_, err := repo.List(ctx, database.QueryFilter{}, &database.Projection{Fields: []string{"missing"}})
+	expectError(t, "project unknown field", err, database.ErrInvalidFilter)
+
+	_, err = repo.ListPage(ctx, database.QueryFilter{Cursor: "tampered"}, nil)
+	expectError(t, "list page with invalid cursor", err, database.ErrInvalidCursor)
+	_, err = repo.ListPage(ctx, database.QueryFilter{OrderBy: "rating"}, nil)
+	expectError(t, "list page on nullable column", err, database.ErrInvalidFilter)
+}
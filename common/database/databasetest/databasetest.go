@@ -0,0 +1,63 @@
+// Package databasetest provides in-process SQLite databases for exercising
+// repositories built on common/database without a database server.
+package databasetest
+
+import (
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+)
+
+// CursorKey signs the page cursors of the repositories returned by this package, pass it to
+// RunBackends for repositories serving ListPage
+var CursorKey = database.WithCursorKey([]byte("databasetest"))
+
+// New returns an in-memory SQLite database with the given models migrated. Every call
+// returns a new, isolated database which is closed when the test completes.
+func New(t testing.TB, models ...any) database.SQLDatabase {
+	t.Helper()
+
+	db, err := database.NewSQLDatabase(&database.Config{
+		Driver:           "sqlite",
+		ConnectionString: ":memory:",
+	})
+	if err != nil {
+		t.Fatalf("databasetest: connect: %v", err)
+	}
+
+	t.Cleanup(func() {
+		err := db.Disconnect()
+		if err != nil {
+			t.Errorf("databasetest: disconnect: %v", err)
+		}
+	})
+
+	if len(models) > 0 {
+		err = db.Instance().AutoMigrate(models...)
+		if err != nil {
+			t.Fatalf("databasetest: migrate: %v", err)
+		}
+	}
+
+	return db
+}
+
+// RunBackends runs test as the subtests "sqlite" and "memory". newRepository returns a
+// repository of T over empty tables on every call: a SQLHandler on a new in-memory SQLite
+// database with models migrated, or a MemoryRepository on a new MemoryDatabase, both built
+// with opts.
+func RunBackends[T any](t *testing.T, models []any, opts []database.Option,
+	test func(t *testing.T, newRepository func(t *testing.T) database.Repository[T])) {
+	t.Helper()
+
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, func(t *testing.T) database.Repository[T] {
+			return database.NewSQLHandler[T](New(t, models...).Instance(), opts...)
+		})
+	})
+	t.Run("memory", func(t *testing.T) {
+		test(t, func(t *testing.T) database.Repository[T] {
+			return database.NewMemoryRepository[T](database.NewMemoryDatabase(), opts...)
+		})
+	})
+}
@@ -0,0 +1,419 @@
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"gorm.io/gorm"
+)
+
+// TenantRecord is the tenant scoped model exercised by RunTenantIsolation
+type TenantRecord struct {
+	ID        uint   `gorm:"primaryKey"`
+	TenantID  string `gorm:"size:64;not null;uniqueIndex:idx_tenant_records_name,priority:1"`
+	Name      string `gorm:"uniqueIndex:idx_tenant_records_name,priority:2"`
+	Score     int
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// RunTenantIsolation checks that a Repository never reads or writes the rows of another
+// tenant than the one of its context, see database.WithTenant. newRepository is called by
+// every subtest for a repository over an empty table of tenant records, typically
+// handed by RunBackends.
+func RunTenantIsolation(t *testing.T, newRepository func(t *testing.T) database.Repository[TenantRecord]) {
+	t.Helper()
+
+	for _, c := range tenantCases {
+		t.Run(c.name, func(t *testing.T) {
+			repo := newRepository(t)
+			c.run(t, context.Background(), repo)
+		})
+	}
+}
+
+type tenantCase struct {
+	name string
+	run  func(t *testing.T, ctx context.Context, repo database.Repository[TenantRecord])
+}
+
+var tenantCases = []tenantCase{
+	{"requires tenant", testTenantRequired},
+	{"stamps creates", testTenantCreate},
+	{"scopes reads", testTenantReads},
+	{"scopes writes", testTenantWrites},
+	{"tenant can not change", testTenantChange},
+	{"upsert", testTenantUpsert},
+	{"cross tenant", testCrossTenant},
+	{"transactions", testTenantTransactions},
+}
+
+// seedTenants creates the records used by most of the cases, both tenants have a record
+// with the same name:
+//
+//	tenant name    score
+//	acme   alpha   10
+//	acme   bravo   20
+//	globex alpha   30
+//	globex charlie 40
+func seedTenants(t *testing.T, ctx context.Context, repo database.Repository[TenantRecord]) {
+	t.Helper()
+
+	records := []TenantRecord{
+		{TenantID: "acme", Name: "alpha", Score: 10},
+		{TenantID: "acme", Name: "bravo", Score: 20},
+		{TenantID: "globex", Name: "alpha", Score: 30},
+		{TenantID: "globex", Name: "charlie", Score: 40},
+	}
+	err := repo.CreateBatch(database.CrossTenant(ctx), records, 0)
+	if err != nil {
+		t.Fatalf("seed tenants: %v", err)
+	}
+}
+
+func tenantNames(records []TenantRecord) []string {
+	out := make([]string, len(records))
+	for i, r := range records {
+		out[i] = r.TenantID + "/" + r.Name
+	}
+	slices.Sort(out)
+	return out
+}
+
+// expectTenantNames lists the records matching the filter and compares their tenants and
+// names, in any order
+func expectTenantNames(t *testing.T, ctx context.Context, repo database.Repository[TenantRecord], qf database.QueryFilter, want ...string) {
+	t.Helper()
+
+	records, err := repo.List(ctx, qf, nil)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	want = slices.Clone(want)
+	slices.Sort(want)
+	if got := tenantNames(records); !slices.Equal(got, want) {
+		t.Errorf("list %+v: got %q, want %q", qf, got, want)
+	}
+}
+
+func testTenantRequired(t *testing.T, ctx context.Context, repo database.Repository[TenantRecord]) {
+	seedTenants(t, ctx, repo)
+
+	_, err := repo.List(ctx, database.QueryFilter{}, nil)
+	expectError(t, "list without tenant", err, database.ErrTenantRequired)
+
+	_, err = repo.Count(ctx, database.QueryFilter{})
+	expectError(t, "count without tenant", err, database.ErrTenantRequired)
+
+	err = repo.Create(ctx, &TenantRecord{TenantID: "acme", Name: "delta"})
+	expectError(t, "create without tenant", err, database.ErrTenantRequired)
+
+	err = repo.Update(ctx, database.QueryFilter{
+		WhereMap:  map[string]any{"name": "alpha"},
+		UpdateMap: map[string]any{"score": 0},
+	})
+	expectError(t, "update without tenant", err, database.ErrTenantRequired)
+
+	err = repo.Delete(ctx, database.QueryFilter{WhereMap: map[string]any{"name": "alpha"}})
+	expectError(t, "delete without tenant", err, database.ErrTenantRequired)
+
+	_, err = repo.Purge(ctx, -time.Second)
+	expectError(t, "purge without tenant", err, database.ErrTenantRequired)
+
+	_, err = repo.List(database.WithTenant(ctx, ""), database.QueryFilter{}, nil)
+	expectError(t, "list with an empty tenant", err, database.ErrTenantRequired)
+}
+
+func testTenantCreate(t *testing.T, ctx context.Context, repo database.Repository[TenantRecord]) {
+	acme := database.WithTenant(ctx, "acme")
+
+	record := TenantRecord{Name: "alpha"}
+	err := repo.Create(acme, &record)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if record.TenantID != "acme" {
+		t.Errorf("create: got tenant %q, want acme", record.TenantID)
+	}
+
+	batch := []TenantRecord{{Name: "bravo"}, {TenantID: "acme", Name: "charlie"}}
+	err = repo.CreateBatch(acme, batch, 0)
+	if err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	if batch[0].TenantID != "acme" {
+		t.Errorf("create batch: got tenant %q, want acme", batch[0].TenantID)
+	}
+
+	err = repo.Create(acme, &TenantRecord{TenantID: "globex", Name: "delta"})
+	expectError(t, "create for another tenant", err, database.ErrTenantMismatch)
+
+	// A batch holding a record of another tenant is rejected as a whole
+	err = repo.CreateBatch(acme, []TenantRecord{{Name: "echo"}, {TenantID: "globex", Name: "foxtrot"}}, 0)
+	expectError(t, "create batch for another tenant", err, database.ErrTenantMismatch)
+
+	err = repo.Create(database.CrossTenant(ctx), &TenantRecord{Name: "golf"})
+	expectError(t, "create across tenants without a tenant", err, database.ErrTenantRequired)
+
+	expectTenantNames(t, database.CrossTenant(ctx), repo, database.QueryFilter{}, "acme/alpha", "acme/bravo", "acme/charlie")
+}
+
+func testTenantReads(t *testing.T, ctx context.Context, repo database.Repository[TenantRecord]) {
+	seedTenants(t, ctx, repo)
+	acme := database.WithTenant(ctx, "acme")
+
+	expectTenantNames(t, acme, repo, database.QueryFilter{}, "acme/alpha", "acme/bravo")
+	expectTenantNames(t, acme, repo, database.QueryFilter{WhereMap: map[string]any{"name": "charlie"}})
+	expectTenantNames(t, acme, repo, database.QueryFilter{WhereMap: map[string]any{"tenant_id": "globex"}})
+
+	// Alternatives are grouped, so they can not escape the tenant condition
+	expectTenantNames(t, acme, repo, database.QueryFilter{
+		WhereMap: map[string]any{"name": "bravo"},
+		Or:       []database.QueryFilter{{WhereMap: map[string]any{"tenant_id": "globex"}}},
+	}, "acme/bravo")
+	expectTenantNames(t, acme, repo, database.QueryFilter{
+		Where: database.Or(database.Eq("name", "charlie"), database.Gte("score", 0)),
+	}, "acme/alpha", "acme/bravo")
+
+	records, err := repo.List(acme, database.QueryFilter{WhereQuery: "1 = 1 OR 1 = 1"}, nil)
+	if err == nil {
+		if got := tenantNames(records); !slices.Equal(got, []string{"acme/alpha", "acme/bravo"}) {
+			t.Errorf("list with a custom where clause: got %q", got)
+		}
+	} else if !errors.Is(err, database.ErrUnsupportedFilter) {
+		t.Errorf("list with a custom where clause: %v", err)
+	}
+
+	got, err := repo.Get(acme, database.QueryFilter{WhereMap: map[string]any{"name": "alpha"}}, nil)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.TenantID != "acme" || got.Score != 10 {
+		t.Errorf("get: got %+v", got)
+	}
+	_, err = repo.Get(acme, database.QueryFilter{WhereMap: map[string]any{"name": "charlie"}}, nil)
+	expectError(t, "get a record of another tenant", err, database.ErrNotFound)
+
+	count, err := repo.Count(acme, database.QueryFilter{Where: database.Gte("score", 0)})
+	if err != nil || count != 2 {
+		t.Errorf("count: got %d, %v, want 2", count, err)
+	}
+	exists, err := repo.Exists(acme, database.QueryFilter{WhereMap: map[string]any{"name": "charlie"}})
+	if err != nil || exists {
+		t.Errorf("exists in another tenant: got %t, %v", exists, err)
+	}
+
+	batch, err := repo.Batch(acme, "score", []any{10, 30, 40})
+	if err != nil || !slices.Equal(tenantNames(batch), []string{"acme/alpha"}) {
+		t.Errorf("batch: got %q, %v", tenantNames(batch), err)
+	}
+
+	all, err := repo.All(acme)
+	if err != nil || len(all) != 2 {
+		t.Errorf("all: got %q, %v", tenantNames(all), err)
+	}
+
+	page, err := repo.ListPage(acme, database.QueryFilter{OrderBy: "score", Limit: 10}, nil)
+	if err != nil || !slices.Equal(tenantNames(page.Items), []string{"acme/alpha", "acme/bravo"}) {
+		t.Errorf("list page: got %+v, %v", page, err)
+	}
+
+	var visited []TenantRecord
+	err = repo.ForEach(acme, database.QueryFilter{}, 1, func(r *TenantRecord) error {
+		visited = append(visited, *r)
+		return nil
+	})
+	if err != nil || !slices.Equal(tenantNames(visited), []string{"acme/alpha", "acme/bravo"}) {
+		t.Errorf("for each: got %q, %v", tenantNames(visited), err)
+	}
+
+	stream, err := repo.Stream(acme, database.QueryFilter{}, nil)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	var streamed []TenantRecord
+	for stream.Next() {
+		streamed = append(streamed, *stream.Entity())
+	}
+	if err := stream.Err(); err != nil {
+		t.Errorf("stream: %v", err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Errorf("close stream: %v", err)
+	}
+	if !slices.Equal(tenantNames(streamed), []string{"acme/alpha", "acme/bravo"}) {
+		t.Errorf("stream: got %q", tenantNames(streamed))
+	}
+}
+
+func testTenantWrites(t *testing.T, ctx context.Context, repo database.Repository[TenantRecord]) {
+	seedTenants(t, ctx, repo)
+	acme := database.WithTenant(ctx, "acme")
+	cross := database.CrossTenant(ctx)
+
+	err := repo.Update(acme, database.QueryFilter{
+		WhereMap:  map[string]any{"name": "alpha"},
+		UpdateMap: map[string]any{"score": 11},
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	err = repo.Update(acme, database.QueryFilter{
+		Where:     database.Or(database.Eq("name", "charlie"), database.Eq("tenant_id", "globex")),
+		UpdateMap: map[string]any{"score": 0},
+	})
+	if err != nil {
+		t.Fatalf("update of another tenant: %v", err)
+	}
+	expectTenantNames(t, cross, repo, database.QueryFilter{WhereMap: map[string]any{"score": []int{11, 30, 40}}},
+		"acme/alpha", "globex/alpha", "globex/charlie")
+
+	err = repo.Delete(acme, database.QueryFilter{WhereMap: map[string]any{"name": []string{"alpha", "charlie"}}})
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	expectTenantNames(t, cross, repo, database.QueryFilter{}, "acme/bravo", "globex/alpha", "globex/charlie")
+
+	err = repo.Delete(cross, database.QueryFilter{WhereMap: map[string]any{"name": "charlie"}})
+	if err != nil {
+		t.Fatalf("delete across tenants: %v", err)
+	}
+
+	deleted, err := repo.ListDeleted(acme, database.QueryFilter{}, nil)
+	if err != nil || !slices.Equal(tenantNames(deleted), []string{"acme/alpha"}) {
+		t.Errorf("list deleted: got %q, %v", tenantNames(deleted), err)
+	}
+
+	err = repo.Restore(acme, database.QueryFilter{WhereMap: map[string]any{"name": []string{"alpha", "charlie"}}})
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	expectTenantNames(t, cross, repo, database.QueryFilter{}, "acme/alpha", "acme/bravo", "globex/alpha")
+
+	err = repo.Delete(acme, database.QueryFilter{WhereMap: map[string]any{"name": "bravo"}})
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	purged, err := repo.Purge(acme, -time.Second)
+	if err != nil || purged != 1 {
+		t.Errorf("purge: got %d, %v, want 1", purged, err)
+	}
+	deleted, err = repo.ListDeleted(cross, database.QueryFilter{}, nil)
+	if err != nil || !slices.Equal(tenantNames(deleted), []string{"globex/charlie"}) {
+		t.Errorf("list deleted after purge: got %q, %v", tenantNames(deleted), err)
+	}
+}
+
+func testTenantChange(t *testing.T, ctx context.Context, repo database.Repository[TenantRecord]) {
+	seedTenants(t, ctx, repo)
+	acme := database.WithTenant(ctx, "acme")
+
+	err := repo.Update(acme, database.QueryFilter{
+		WhereMap:  map[string]any{"name": "bravo"},
+		UpdateMap: map[string]any{"tenant_id": "globex"},
+	})
+	expectError(t, "move a record to another tenant", err, database.ErrTenantMismatch)
+
+	err = repo.Update(acme, database.QueryFilter{
+		WhereMap:  map[string]any{"name": "bravo"},
+		UpdateMap: map[string]any{"TenantID": "globex"},
+	})
+	expectError(t, "move a record to another tenant by field name", err, database.ErrTenantMismatch)
+
+	err = repo.Update(acme, database.QueryFilter{
+		WhereMap:  map[string]any{"name": "bravo"},
+		UpdateMap: map[string]any{"tenant_id": "acme", "score": 21},
+	})
+	if err != nil {
+		t.Fatalf("update keeping the tenant: %v", err)
+	}
+	expectTenantNames(t, database.CrossTenant(ctx), repo, database.QueryFilter{WhereMap: map[string]any{"name": "bravo"}}, "acme/bravo")
+
+	// Admin jobs may move records
+	err = repo.Update(database.CrossTenant(ctx), database.QueryFilter{
+		WhereMap:  map[string]any{"name": "bravo"},
+		UpdateMap: map[string]any{"tenant_id": "globex"},
+	})
+	if err != nil {
+		t.Fatalf("move a record across tenants: %v", err)
+	}
+	expectTenantNames(t, acme, repo, database.QueryFilter{}, "acme/alpha")
+}
+
+func testTenantUpsert(t *testing.T, ctx context.Context, repo database.Repository[TenantRecord]) {
+	seedTenants(t, ctx, repo)
+	acme := database.WithTenant(ctx, "acme")
+
+	// Conflicting on the name alone could update the record of another tenant
+	_, err := repo.Upsert(acme, []TenantRecord{{Name: "alpha", Score: 0}}, []string{"name"}, []string{"score"})
+	expectError(t, "upsert without the tenant column", err, database.ErrInvalidFilter)
+
+	result, err := repo.Upsert(acme, []TenantRecord{
+		{Name: "alpha", Score: 12},
+		{Name: "charlie", Score: 13},
+	}, []string{"tenant_id", "name"}, []string{"score"})
+	if err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if *result != (database.UpsertResult{Inserted: 1, Updated: 1}) {
+		t.Errorf("upsert: got %+v", result)
+	}
+
+	_, err = repo.Upsert(acme, []TenantRecord{{TenantID: "globex", Name: "alpha", Score: 0}}, []string{"tenant_id", "name"}, []string{"score"})
+	expectError(t, "upsert for another tenant", err, database.ErrTenantMismatch)
+
+	expectTenantNames(t, database.CrossTenant(ctx), repo, database.QueryFilter{WhereMap: map[string]any{"score": []int{12, 13, 30, 40}}},
+		"acme/alpha", "acme/charlie", "globex/alpha", "globex/charlie")
+}
+
+func testCrossTenant(t *testing.T, ctx context.Context, repo database.Repository[TenantRecord]) {
+	seedTenants(t, ctx, repo)
+
+	// CrossTenant takes precedence over the tenant of the context
+	cross := database.CrossTenant(database.WithTenant(ctx, "acme"))
+	expectTenantNames(t, cross, repo, database.QueryFilter{WhereMap: map[string]any{"name": "alpha"}}, "acme/alpha", "globex/alpha")
+
+	count, err := repo.Count(cross, database.QueryFilter{})
+	if err != nil || count != 4 {
+		t.Errorf("count across tenants: got %d, %v, want 4", count, err)
+	}
+
+	err = repo.Create(cross, &TenantRecord{TenantID: "initech", Name: "alpha"})
+	if err != nil {
+		t.Fatalf("create across tenants: %v", err)
+	}
+	expectTenantNames(t, database.WithTenant(ctx, "initech"), repo, database.QueryFilter{}, "initech/alpha")
+}
+
+func testTenantTransactions(t *testing.T, ctx context.Context, repo database.Repository[TenantRecord]) {
+	seedTenants(t, ctx, repo)
+	acme := database.WithTenant(ctx, "acme")
+
+	err := repo.RunInTx(acme, func(tx *database.Tx) error {
+		txRepo := repo.WithTx(tx)
+		err := txRepo.Create(acme, &TenantRecord{Name: "delta"})
+		if err != nil {
+			return err
+		}
+
+		records, err := txRepo.List(acme, database.QueryFilter{Lock: database.RowLock{Mode: database.LockForUpdate}}, nil)
+		if err != nil {
+			return err
+		}
+		if got := tenantNames(records); !slices.Equal(got, []string{"acme/alpha", "acme/bravo", "acme/delta"}) {
+			t.Errorf("read within transaction: got %q", got)
+		}
+
+		// The tenant comes from the context of every statement, not of the transaction
+		_, err = txRepo.List(ctx, database.QueryFilter{}, nil)
+		expectError(t, "list within transaction without tenant", err, database.ErrTenantRequired)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+	expectTenantNames(t, acme, repo, database.QueryFilter{}, "acme/alpha", "acme/bravo", "acme/delta")
+}
@@ -1,18 +1,31 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultConnectAttempts = 5
+	defaultConnectBackoff  = 500 * time.Millisecond
+	maxConnectBackoff      = 30 * time.Second
 )
 
 // sqlDatabase struct has necessary component for GORM configuration
 type sqlDatabase struct {
-	db     *gorm.DB
-	config *Config
+	db       *gorm.DB
+	config   *Config
+	replicas *replicaSet
 }
 
 // SQLDatabase defines an interface to interact with DB
@@ -20,15 +33,34 @@ type SQLDatabase interface {
 	Instance() *gorm.DB
 	Connect() error
 	Disconnect() error
+
+	// RunInTx runs fn inside a transaction which is committed if fn returns nil
+	// and rolled back otherwise. Use TxHandler to obtain tx-bound handlers. With
+	// Config.Retry set, fn is run again when the transaction fails with a transient error.
+	RunInTx(ctx context.Context, fn func(tx *Tx) error, opts ...*sql.TxOptions) error
+
+	// Ping checks that the primary can be reached
+	Ping(ctx context.Context) error
+
+	// Health pings the primary and every read replica
+	Health(ctx context.Context) Health
+
+	// Stats returns the statistics of the connection pools, see PublishStats
+	Stats() Stats
 }
 
 // NewSQLDatabase will init a new instance of GORM based on the
 // given configuration
 func NewSQLDatabase(config *Config) (SQLDatabase, error) {
+	return NewSQLDatabaseContext(context.Background(), config)
+}
+
+// NewSQLDatabaseContext is NewSQLDatabase giving up on the connect attempts once ctx is done
+func NewSQLDatabaseContext(ctx context.Context, config *Config) (SQLDatabase, error) {
 	db := &sqlDatabase{
 		config: config,
 	}
-	err := db.Connect()
+	err := db.connect(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -40,49 +72,164 @@ func (db *sqlDatabase) Instance() *gorm.DB {
 	return db.db
 }
 
-// Connect will connection with the database driver via GORM
+// Connect will connection with the database driver via GORM, retrying with an
+// exponential backoff while the database can not be reached
 func (db *sqlDatabase) Connect() error {
-	var dialector gorm.Dialector
-	var err error
-
-	switch db.config.Driver {
-	case "mysql":
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-			db.config.Username, db.config.Password, db.config.ConnectionString, db.config.Port, db.config.DBName)
-		dialector = mysql.Open(dsn)
-	case "postgres":
-		dsn := fmt.Sprintf("host=%s port=%s user=%s dbname=%s password=%s sslmode=disable",
-			db.config.ConnectionString, db.config.Port, db.config.Username, db.config.DBName, db.config.Password)
-		dialector = postgres.Open(dsn)
-	case "sqlserver":
-		dsn := fmt.Sprintf("sqlserver://%s:%s@%s:%s?database=%s",
-			db.config.Username, db.config.Password, db.config.ConnectionString, db.config.Port, db.config.DBName)
-		dialector = sqlserver.Open(dsn)
-	default:
-		return fmt.Errorf("unsupported database driver: %s", db.config.Driver)
-	}
+	return db.connect(context.Background())
+}
 
-	db.db, err = gorm.Open(dialector, &gorm.Config{})
+// connect implements Connect, the backoff between attempts is cut short when ctx is done
+func (db *sqlDatabase) connect(ctx context.Context) error {
+	dialector, err := newDialector(db.config, db.config.ConnectionString, db.config.Port)
 	if err != nil {
 		return err
 	}
 
+	attempts := db.config.ConnectAttempts
+	if attempts <= 0 {
+		attempts = defaultConnectAttempts
+	}
+	backoff := db.config.ConnectBackoff
+	if backoff <= 0 {
+		backoff = defaultConnectBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		db.db, err = gorm.Open(dialector, &gorm.Config{})
+		if err == nil {
+			break
+		}
+		closeGORM(db.db)
+		if attempt == attempts {
+			return fmt.Errorf("database: connect failed after %d attempts: %w", attempts, err)
+		}
+
+		klog.ErrorS(err, "database: connect failed, retrying", "attempt", attempt, "backoff", backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("database: connect abandoned after %d attempts: %w", attempt, errors.Join(ctx.Err(), err))
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
+
 	sqlDB, err := db.db.DB()
 	if err != nil {
 		return err
 	}
+	configurePool(sqlDB, db.config)
+
+	if db.config.Observability != nil {
+		err = Instrument(db.db, *db.config.Observability)
+		if err != nil {
+			return errors.Join(err, sqlDB.Close())
+		}
+	}
 
-	sqlDB.SetMaxOpenConns(db.config.MaxOpenConnections)
-	sqlDB.SetMaxIdleConns(db.config.MaxIdleConnections)
+	err = RegisterTenancy(db.db)
+	if err != nil {
+		return errors.Join(err, sqlDB.Close())
+	}
+
+	if db.config.Audit {
+		err = RegisterAudit(db.db)
+		if err != nil {
+			return errors.Join(err, sqlDB.Close())
+		}
+	}
+
+	if len(db.config.Replicas) > 0 {
+		db.replicas, err = newReplicaSet(db.config)
+		if err != nil {
+			return errors.Join(err, sqlDB.Close())
+		}
+		err = db.replicas.register(db.db)
+		if err != nil {
+			return errors.Join(err, db.replicas.close(), sqlDB.Close())
+		}
+	}
 
 	return nil
 }
 
+// configurePool applies the pool settings of the config
+func configurePool(sqlDB *sql.DB, config *Config) {
+	sqlDB.SetMaxOpenConns(config.MaxOpenConnections)
+	sqlDB.SetMaxIdleConns(config.MaxIdleConnections)
+	sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+
+	// Every connection to an in-memory SQLite database gets its own empty database,
+	// so the pool is pinned to a single connection which is never recycled
+	if config.Driver == "sqlite" && isSQLiteMemory(config.ConnectionString) {
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+		sqlDB.SetConnMaxIdleTime(0)
+	}
+}
+
+// closeGORM closes the connection pool of a GORM instance that failed to open
+func closeGORM(db *gorm.DB) {
+	if db == nil || db.ConnPool == nil {
+		return
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// newDialector returns the GORM dialector for the driver of the config, connecting
+// to the given host and port with the config's credentials and database
+func newDialector(config *Config, host, port string) (gorm.Dialector, error) {
+	switch config.Driver {
+	case "mysql":
+		dsn, err := mysqlDSN(config, host, port)
+		if err != nil {
+			return nil, err
+		}
+		return mysql.Open(dsn), nil
+	case "postgres", "postgresql":
+		dsn, err := postgresDSN(config, host, port)
+		if err != nil {
+			return nil, err
+		}
+		return postgres.Open(dsn), nil
+	case "sqlserver":
+		dsn, err := sqlserverDSN(config, host, port)
+		if err != nil {
+			return nil, err
+		}
+		return sqlserver.Open(dsn), nil
+	case "sqlite":
+		return sqlite.Open(sqliteDSN(host)), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", config.Driver)
+	}
+}
+
+// RunInTx implements `RunInTx()` from SQLDatabase interface. Errors are classified as the
+// ones of SQLHandler, before the retry policy decides on them.
+func (db *sqlDatabase) RunInTx(ctx context.Context, fn func(tx *Tx) error, opts ...*sql.TxOptions) error {
+	if db.config.Retry == nil {
+		return classifyError(runInTx(ctx, db.db, fn, opts...))
+	}
+	return db.config.Retry.Do(ctx, func(ctx context.Context) error {
+		return classifyError(runInTx(ctx, db.db, fn, opts...))
+	})
+}
+
 // Disconnect will Disconnect from DB instance
 func (db *sqlDatabase) Disconnect() error {
 	sqlDB, err := db.db.DB()
 	if err != nil {
 		return err
 	}
+
+	if db.replicas != nil {
+		return errors.Join(db.replicas.close(), sqlDB.Close())
+	}
 	return sqlDB.Close()
 }
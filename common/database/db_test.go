@@ -0,0 +1,27 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+)
+
+// The errors of database level transactions are classified as the ones of the handlers
+func TestRunInTxClassifiesErrors(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.New(t, &databasetest.Record{})
+
+	err := db.RunInTx(ctx, func(tx *database.Tx) error {
+		records := database.TxHandler[databasetest.Record](tx)
+		if err := records.Create(ctx, &databasetest.Record{Name: "alpha"}); err != nil {
+			return err
+		}
+		return tx.Instance().Create(&databasetest.Record{Name: "alpha"}).Error
+	})
+	if !errors.Is(err, database.ErrUniqueViolation) {
+		t.Errorf("duplicate in a transaction: got %v, want ErrUniqueViolation", err)
+	}
+}
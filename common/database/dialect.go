@@ -0,0 +1,137 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dialect identifies the SQL flavour of the connected driver and translates the
+// filters whose syntax differs between drivers to their native form
+type dialect string
+
+const (
+	dialectMySQL     dialect = "mysql"
+	dialectPostgres  dialect = "postgres"
+	dialectSQLServer dialect = "sqlserver"
+	dialectSQLite    dialect = "sqlite"
+)
+
+// likeEscape is the escape character used in the LIKE patterns built by the dialect,
+// it is not special in string literals of any of the supported drivers
+const likeEscape = "!"
+
+// dialectOf returns the dialect of the given GORM instance
+func dialectOf(db *gorm.DB) dialect {
+	if db.Dialector == nil {
+		return ""
+	}
+	return dialect(db.Dialector.Name())
+}
+
+// unsupported returns the error for a filter the dialect can not express
+func (d dialect) unsupported(filter string) error {
+	return fmt.Errorf("%w: %s is not supported by %q", ErrUnsupportedFilter, filter, string(d))
+}
+
+// regex matches column against a regular expression in the dialect's regex flavour
+func (d dialect) regex(column clause.Column, pattern string, fold bool) (clause.Expression, error) {
+	switch d {
+	case dialectPostgres:
+		if fold {
+			return clause.Expr{SQL: "? ~* ?", Vars: []any{column, pattern}}, nil
+		}
+		return clause.Expr{SQL: "? ~ ?", Vars: []any{column, pattern}}, nil
+	case dialectMySQL:
+		// The match type makes the result independent of the column's collation
+		matchType := "c"
+		if fold {
+			matchType = "i"
+		}
+		return clause.Expr{SQL: "REGEXP_LIKE(?, ?, ?)", Vars: []any{column, pattern, matchType}}, nil
+	case dialectSQLite:
+		// Backed by the regexp function registered on the driver, see sqlite.go
+		if fold {
+			pattern = "(?i)" + pattern
+		}
+		return clause.Expr{SQL: "? REGEXP ?", Vars: []any{column, pattern}}, nil
+	default:
+		// SQL Server has no regex operator
+		return nil, d.unsupported("regex matching")
+	}
+}
+
+// like matches column against a LIKE pattern escaped with likeEscape, either case-sensitively
+// or case-insensitively regardless of the column's collation
+func (d dialect) like(column clause.Column, pattern string, fold bool) (clause.Expression, error) {
+	if fold {
+		if d == dialectPostgres {
+			return clause.Expr{SQL: "? ILIKE ? ESCAPE '" + likeEscape + "'", Vars: []any{column, pattern}}, nil
+		}
+		return clause.Expr{SQL: "LOWER(?) LIKE LOWER(?) ESCAPE '" + likeEscape + "'", Vars: []any{column, pattern}}, nil
+	}
+
+	switch d {
+	case dialectPostgres:
+		return clause.Expr{SQL: "? LIKE ? ESCAPE '" + likeEscape + "'", Vars: []any{column, pattern}}, nil
+	case dialectMySQL:
+		// utf8mb4_bin is only valid for utf8mb4 strings, so the column is converted first
+		return clause.Expr{SQL: "CONVERT(? USING utf8mb4) COLLATE utf8mb4_bin LIKE ? ESCAPE '" + likeEscape + "'", Vars: []any{column, pattern}}, nil
+	case dialectSQLServer:
+		return clause.Expr{SQL: "? COLLATE Latin1_General_CS_AS LIKE ? ESCAPE '" + likeEscape + "'", Vars: []any{column, pattern}}, nil
+	case dialectSQLite:
+		// LIKE is case-insensitive on SQLite, GLOB is its case-sensitive counterpart
+		return clause.Expr{SQL: "? GLOB ?", Vars: []any{column, likeToGlob(pattern)}}, nil
+	default:
+		return nil, d.unsupported("case-sensitive LIKE matching")
+	}
+}
+
+// equalFold matches rows where column equals value ignoring case
+func (d dialect) equalFold(column clause.Column, value string) (clause.Expression, error) {
+	if d == "" {
+		return nil, d.unsupported("case-insensitive equality")
+	}
+	return clause.Expr{SQL: "LOWER(?) = LOWER(?)", Vars: []any{column, value}}, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so that it is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(
+		likeEscape, likeEscape+likeEscape,
+		"%", likeEscape+"%",
+		"_", likeEscape+"_",
+		"[", likeEscape+"[",
+	).Replace(s)
+}
+
+// likeToGlob converts a LIKE pattern escaped with likeEscape to a GLOB pattern
+func likeToGlob(pattern string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+			switch r {
+			case '*', '?', '[':
+				b.WriteString("[" + string(r) + "]")
+			default:
+				b.WriteRune(r)
+			}
+		case string(r) == likeEscape:
+			escaped = true
+		case r == '%':
+			b.WriteByte('*')
+		case r == '_':
+			b.WriteByte('?')
+		case r == '*', r == '?', r == '[':
+			b.WriteString("[" + string(r) + "]")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,246 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TLS modes of Config.SSLMode
+const (
+	sslDisable    = "disable"
+	sslRequire    = "require"
+	sslVerifyCA   = "verify-ca"
+	sslVerifyFull = "verify-full"
+)
+
+// sslMode returns the normalized TLS mode of the config
+func (c *Config) sslMode() (string, error) {
+	switch strings.ToLower(c.SSLMode) {
+	case "":
+		if c.SSLEnabled {
+			return sslVerifyFull, nil
+		}
+		return sslDisable, nil
+	case "disable", "disabled", "false":
+		return sslDisable, nil
+	case sslRequire:
+		return sslRequire, nil
+	case sslVerifyCA:
+		return sslVerifyCA, nil
+	case sslVerifyFull:
+		return sslVerifyFull, nil
+	default:
+		return "", fmt.Errorf("database: invalid ssl mode %q", c.SSLMode)
+	}
+}
+
+// postgresDSN returns the key/value connection string of a postgres server
+func postgresDSN(c *Config, host, port string) (string, error) {
+	mode, err := c.sslMode()
+	if err != nil {
+		return "", err
+	}
+
+	params := [][2]string{
+		{"host", host},
+		{"port", port},
+		{"user", c.Username},
+		{"dbname", c.DBName},
+		{"password", c.Password},
+		{"sslmode", mode},
+	}
+	if mode != sslDisable {
+		params = appendNonEmpty(params, "sslrootcert", c.SSLRootCert)
+		params = appendNonEmpty(params, "sslcert", c.SSLCert)
+		params = appendNonEmpty(params, "sslkey", c.SSLKey)
+	}
+	if c.DialTimeout > 0 {
+		params = append(params, [2]string{"connect_timeout", strconv.Itoa(ceilSeconds(c.DialTimeout))})
+	}
+	if c.StatementTimeout > 0 {
+		// Unknown keys are sent to the server as run-time parameters
+		params = append(params, [2]string{"statement_timeout", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)})
+	}
+
+	parts := make([]string, len(params))
+	for i, param := range params {
+		parts[i] = param[0] + "=" + quotePostgres(param[1])
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// mysqlDSN returns the connection string of a mysql server, TLS configurations are
+// registered with the driver under a name unique to the server
+func mysqlDSN(c *Config, host, port string) (string, error) {
+	mode, err := c.sslMode()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("charset", "utf8mb4")
+	params.Set("parseTime", "True")
+	params.Set("loc", "Local")
+
+	switch mode {
+	case sslDisable:
+		params.Set("tls", "false")
+	default:
+		cfg, err := c.tlsConfig(host, mode)
+		if err != nil {
+			return "", err
+		}
+		name := "database-" + host + "-" + port
+		err = mysql.RegisterTLSConfig(name, cfg)
+		if err != nil {
+			return "", err
+		}
+		params.Set("tls", name)
+	}
+
+	if c.DialTimeout > 0 {
+		params.Set("timeout", c.DialTimeout.String())
+	}
+	if c.StatementTimeout > 0 {
+		// Unknown parameters are set as session variables
+		params.Set("max_execution_time", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10))
+	}
+
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?%s",
+		c.Username, c.Password, host, port, c.DBName, params.Encode()), nil
+}
+
+// sqlserverDSN returns the connection URL of a SQL Server
+func sqlserverDSN(c *Config, host, port string) (string, error) {
+	mode, err := c.sslMode()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("database", c.DBName)
+
+	switch mode {
+	case sslDisable:
+		params.Set("encrypt", "disable")
+	case sslRequire:
+		params.Set("encrypt", "true")
+		params.Set("TrustServerCertificate", "true")
+	case sslVerifyCA:
+		return "", fmt.Errorf("database: ssl mode %s is not supported by sqlserver, use %s", sslVerifyCA, sslVerifyFull)
+	case sslVerifyFull:
+		params.Set("encrypt", "true")
+		if c.SSLRootCert != "" {
+			params.Set("certificate", c.SSLRootCert)
+		}
+	}
+	if mode != sslDisable && (c.SSLCert != "" || c.SSLKey != "") {
+		return "", errors.New("database: client certificates are not supported by sqlserver")
+	}
+
+	if c.DialTimeout > 0 {
+		params.Set("dial timeout", strconv.Itoa(ceilSeconds(c.DialTimeout)))
+	}
+
+	u := url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(c.Username, c.Password),
+		Host:     host + ":" + port,
+		RawQuery: params.Encode(),
+	}
+	return u.String(), nil
+}
+
+// tlsConfig returns the client TLS configuration for the given mode
+func (c *Config) tlsConfig(host, mode string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: host,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if c.SSLRootCert != "" {
+		pem, err := os.ReadFile(c.SSLRootCert)
+		if err != nil {
+			return nil, fmt.Errorf("database: read root certificate: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("database: no certificate found in %s", c.SSLRootCert)
+		}
+	}
+
+	if c.SSLCert != "" || c.SSLKey != "" {
+		cert, err := tls.LoadX509KeyPair(c.SSLCert, c.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("database: load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	switch mode {
+	case sslRequire:
+		cfg.InsecureSkipVerify = true
+	case sslVerifyCA:
+		// The chain is verified by hand, without matching the host name
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, cfg.RootCAs)
+		}
+	}
+
+	return cfg, nil
+}
+
+// verifyChain verifies the certificate chain presented by a server against roots
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("database: server presented no certificate")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
+
+func appendNonEmpty(params [][2]string, key, value string) [][2]string {
+	if value == "" {
+		return params
+	}
+	return append(params, [2]string{key, value})
+}
+
+// quotePostgres quotes a value of a key/value connection string if needed
+func quotePostgres(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// ceilSeconds rounds a duration up to whole seconds, the unit of the drivers' timeouts
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
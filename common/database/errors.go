@@ -0,0 +1,85 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidCursor = errors.New("database: invalid or tampered page cursor")
+	ErrInvalidFilter = errors.New("database: invalid query filter")
+
+	// ErrNoCursorKey is returned by ListPage for repositories created without WithCursorKey
+	ErrNoCursorKey = errors.New("database: no cursor key configured")
+
+	// ErrUnsupportedFilter is returned when the connected driver can not express a filter
+	ErrUnsupportedFilter = errors.New("database: filter not supported by dialect")
+
+	// ErrConcurrentModification is returned by Update when the row was modified since
+	// the caller read it, the caller may reload the row and retry
+	ErrConcurrentModification = errors.New("database: row was concurrently modified")
+
+	// ErrSoftDeleteUnsupported is returned by the soft delete operations for models
+	// without a gorm.DeletedAt field
+	ErrSoftDeleteUnsupported = errors.New("database: model does not support soft delete")
+
+	// ErrRestoreConflict is returned by Restore when a restored entity conflicts with a
+	// live one, the ConstraintError reporting the conflict stays in the chain
+	ErrRestoreConflict = errors.New("database: restored entity conflicts with a live one")
+)
+
+// Errors reported by the database, the driver error they were classified from stays
+// in the chain, see classifyError
+var (
+	// ErrNotFound is returned when no row matches a query expecting one
+	ErrNotFound = errors.New("database: record not found")
+
+	// ErrUniqueViolation is returned, as a ConstraintError, when a write conflicts with
+	// a unique constraint or index
+	ErrUniqueViolation = errors.New("database: unique constraint violated")
+
+	// ErrForeignKeyViolation is returned, as a ConstraintError, when a write references
+	// a missing row or deletes a referenced one
+	ErrForeignKeyViolation = errors.New("database: foreign key constraint violated")
+
+	// ErrDeadlock is returned when the transaction was chosen as a deadlock victim, it
+	// may be retried
+	ErrDeadlock = errors.New("database: deadlock detected")
+
+	// ErrSerialization is returned when a transaction could not be serialized with
+	// concurrent ones, it may be retried
+	ErrSerialization = errors.New("database: serialization failure")
+
+	// ErrLockNotAvailable is returned when a row lock could not be acquired, because the
+	// query was made with LockNoWait or the lock timeout of the session expired. It is not
+	// retried by default, see IsRetryableOrLocked.
+	ErrLockNotAvailable = errors.New("database: lock not available")
+
+	// ErrTimeout is returned when a statement, a lock wait or the context timed out
+	ErrTimeout = errors.New("database: timeout")
+)
+
+// ConstraintError is returned when a write violates a constraint. It matches either
+// ErrUniqueViolation or ErrForeignKeyViolation with errors.Is.
+type ConstraintError struct {
+	// Kind is ErrUniqueViolation or ErrForeignKeyViolation
+	Kind error
+
+	// Constraint is the name of the violated constraint or index, it is empty when
+	// the driver does not report it. SQLite reports the constrained columns instead.
+	Constraint string
+
+	// Err is the error returned by the driver
+	Err error
+}
+
+func (e *ConstraintError) Error() string {
+	if e.Constraint == "" {
+		return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+	}
+	return fmt.Sprintf("%v (%s): %v", e.Kind, e.Constraint, e.Err)
+}
+
+func (e *ConstraintError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
@@ -0,0 +1,330 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// identifierRegex matches the identifiers (tables, columns and aliases) accepted in query filters
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Expr is a node of a composable filter expression tree. Expressions are combined
+// with And, Or and Not and their column names are validated against the GORM schema
+// of the queried model, values are always bound as query arguments.
+type Expr interface {
+	build(b *exprBuilder) (clause.Expression, error)
+}
+
+// exprBuilder translates expressions to GORM clauses for a given model
+type exprBuilder struct {
+	schema  *schema.Schema
+	dialect dialect
+
+	// tables holds the tables (and aliases) joined to the model's table,
+	// qualified columns of these tables are accepted as is
+	tables map[string]bool
+
+	// aliases holds the aliases of the projection, which can be used to order the results,
+	// mapped to the SQL of the time buckets they may be grouped by
+	aliases map[string]string
+}
+
+func newExprBuilder(sch *schema.Schema, d dialect) *exprBuilder {
+	return &exprBuilder{
+		schema:  sch,
+		dialect: d,
+		tables:  make(map[string]bool),
+		aliases: make(map[string]string),
+	}
+}
+
+// column resolves a column reference, either a field (or column) name of the model or a
+// column qualified with the model's table or one of the joined tables
+func (b *exprBuilder) column(name string) (clause.Column, error) {
+	table, column, qualified := strings.Cut(name, ".")
+	if !qualified {
+		table, column = "", name
+	}
+
+	if (qualified && !identifierRegex.MatchString(table)) || !identifierRegex.MatchString(column) {
+		return clause.Column{}, fmt.Errorf("%w: invalid column %q", ErrInvalidFilter, name)
+	}
+
+	if qualified && table != b.schema.Table {
+		if !b.tables[table] {
+			return clause.Column{}, fmt.Errorf("%w: unknown table in column %q", ErrInvalidFilter, name)
+		}
+		return clause.Column{Table: table, Name: column}, nil
+	}
+
+	field := b.schema.LookUpField(column)
+	if field == nil || field.DBName == "" {
+		return clause.Column{}, fmt.Errorf("%w: unknown column %q for %s", ErrInvalidFilter, name, b.schema.Name)
+	}
+	return clause.Column{Table: clause.CurrentTable, Name: field.DBName}, nil
+}
+
+// build translates the expression, a nil expression builds to a nil clause
+func (b *exprBuilder) build(e Expr) (clause.Expression, error) {
+	if e == nil {
+		return nil, nil
+	}
+	return e.build(b)
+}
+
+type groupExpr struct {
+	or    bool
+	exprs []Expr
+}
+
+// And matches when all of the given expressions match
+func And(exprs ...Expr) Expr {
+	return groupExpr{exprs: exprs}
+}
+
+// Or matches when any of the given expressions match
+func Or(exprs ...Expr) Expr {
+	return groupExpr{or: true, exprs: exprs}
+}
+
+func (g groupExpr) build(b *exprBuilder) (clause.Expression, error) {
+	var exprs []clause.Expression
+	for _, e := range g.exprs {
+		expr, err := b.build(e)
+		if err != nil {
+			return nil, err
+		}
+		if expr != nil {
+			exprs = append(exprs, expr)
+		}
+	}
+
+	switch {
+	case len(exprs) == 0:
+		return nil, nil
+	case len(exprs) == 1:
+		return exprs[0], nil
+	case g.or:
+		return clause.OrConditions{Exprs: exprs}, nil
+	default:
+		return clause.AndConditions{Exprs: exprs}, nil
+	}
+}
+
+type notExpr struct {
+	expr Expr
+}
+
+// Not negates the given expression
+func Not(expr Expr) Expr {
+	return notExpr{expr: expr}
+}
+
+func (n notExpr) build(b *exprBuilder) (clause.Expression, error) {
+	expr, err := b.build(n.expr)
+	if err != nil || expr == nil {
+		return nil, err
+	}
+	return notClause{expr: expr}, nil
+}
+
+// notClause negates a whole expression, unlike clause.Not which negates
+// the members of an AND group one by one
+type notClause struct {
+	expr clause.Expression
+}
+
+func (n notClause) Build(builder clause.Builder) {
+	builder.WriteString("NOT (")
+	n.expr.Build(builder)
+	builder.WriteByte(')')
+}
+
+type compareExpr struct {
+	op     string
+	column string
+	values []any
+}
+
+// Eq matches rows where column equals value (or IS NULL for a nil value)
+func Eq(column string, value any) Expr {
+	return compareExpr{op: "eq", column: column, values: []any{value}}
+}
+
+// Ne matches rows where column does not equal value
+func Ne(column string, value any) Expr {
+	return compareExpr{op: "ne", column: column, values: []any{value}}
+}
+
+// Gt matches rows where column is greater than value
+func Gt(column string, value any) Expr {
+	return compareExpr{op: "gt", column: column, values: []any{value}}
+}
+
+// Gte matches rows where column is greater than or equal to value
+func Gte(column string, value any) Expr {
+	return compareExpr{op: "gte", column: column, values: []any{value}}
+}
+
+// Lt matches rows where column is less than value
+func Lt(column string, value any) Expr {
+	return compareExpr{op: "lt", column: column, values: []any{value}}
+}
+
+// Lte matches rows where column is less than or equal to value
+func Lte(column string, value any) Expr {
+	return compareExpr{op: "lte", column: column, values: []any{value}}
+}
+
+// In matches rows where column equals any of the values
+func In(column string, values ...any) Expr {
+	return compareExpr{op: "in", column: column, values: flattenValues(values)}
+}
+
+// NotIn matches rows where column equals none of the values
+func NotIn(column string, values ...any) Expr {
+	return compareExpr{op: "not_in", column: column, values: flattenValues(values)}
+}
+
+// Between matches rows where column is within [from, to]
+func Between(column string, from, to any) Expr {
+	return compareExpr{op: "between", column: column, values: []any{from, to}}
+}
+
+// Like matches rows where column matches the SQL LIKE pattern
+func Like(column string, pattern string) Expr {
+	return compareExpr{op: "like", column: column, values: []any{pattern}}
+}
+
+// IsNull matches rows where column is NULL
+func IsNull(column string) Expr {
+	return compareExpr{op: "null", column: column}
+}
+
+func (c compareExpr) build(b *exprBuilder) (clause.Expression, error) {
+	col, err := b.column(c.column)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.op {
+	case "eq":
+		return clause.Eq{Column: col, Value: c.values[0]}, nil
+	case "ne":
+		return clause.Neq{Column: col, Value: c.values[0]}, nil
+	case "gt":
+		return clause.Gt{Column: col, Value: c.values[0]}, nil
+	case "gte":
+		return clause.Gte{Column: col, Value: c.values[0]}, nil
+	case "lt":
+		return clause.Lt{Column: col, Value: c.values[0]}, nil
+	case "lte":
+		return clause.Lte{Column: col, Value: c.values[0]}, nil
+	case "in":
+		return clause.IN{Column: col, Values: c.values}, nil
+	case "not_in":
+		// An empty IN matches no row (IN (NULL)), so the empty NOT IN must match them all
+		// rather than negating NULL
+		if len(c.values) == 0 {
+			return clause.Expr{SQL: "1=1"}, nil
+		}
+		return notClause{expr: clause.IN{Column: col, Values: c.values}}, nil
+	case "between":
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []any{col, c.values[0], c.values[1]}}, nil
+	case "like":
+		return clause.Like{Column: col, Value: c.values[0]}, nil
+	case "null":
+		return clause.Expr{SQL: "? IS NULL", Vars: []any{col}}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, c.op)
+	}
+}
+
+type matchExpr struct {
+	kind   string
+	column string
+	value  string
+	fold   bool
+}
+
+// Regex matches rows where column matches the regular expression, using the native
+// regex operator of the driver. Drivers without one fail with ErrUnsupportedFilter.
+func Regex(column string, pattern string) Expr {
+	return matchExpr{kind: "regex", column: column, value: pattern}
+}
+
+// IRegex is the case-insensitive variant of Regex
+func IRegex(column string, pattern string) Expr {
+	return matchExpr{kind: "regex", column: column, value: pattern, fold: true}
+}
+
+// ILike matches rows where column matches the SQL LIKE pattern ignoring case
+func ILike(column string, pattern string) Expr {
+	return matchExpr{kind: "like", column: column, value: pattern, fold: true}
+}
+
+// EqualFold matches rows where column equals value ignoring case
+func EqualFold(column string, value string) Expr {
+	return matchExpr{kind: "equal", column: column, value: value, fold: true}
+}
+
+// HasPrefix matches rows where column starts with prefix, wildcards in prefix match literally
+func HasPrefix(column string, prefix string) Expr {
+	return matchExpr{kind: "like", column: column, value: escapeLike(prefix) + "%"}
+}
+
+// IHasPrefix is the case-insensitive variant of HasPrefix
+func IHasPrefix(column string, prefix string) Expr {
+	return matchExpr{kind: "like", column: column, value: escapeLike(prefix) + "%", fold: true}
+}
+
+// Contains matches rows where column contains substr, wildcards in substr match literally
+func Contains(column string, substr string) Expr {
+	return matchExpr{kind: "like", column: column, value: "%" + escapeLike(substr) + "%"}
+}
+
+// IContains is the case-insensitive variant of Contains
+func IContains(column string, substr string) Expr {
+	return matchExpr{kind: "like", column: column, value: "%" + escapeLike(substr) + "%", fold: true}
+}
+
+func (m matchExpr) build(b *exprBuilder) (clause.Expression, error) {
+	col, err := b.column(m.column)
+	if err != nil {
+		return nil, err
+	}
+
+	switch m.kind {
+	case "regex":
+		return b.dialect.regex(col, m.value, m.fold)
+	case "like":
+		return b.dialect.like(col, m.value, m.fold)
+	case "equal":
+		return b.dialect.equalFold(col, m.value)
+	default:
+		return nil, fmt.Errorf("%w: unknown match %q", ErrInvalidFilter, m.kind)
+	}
+}
+
+// flattenValues allows In and NotIn to be called with a single slice of values
+func flattenValues(values []any) []any {
+	if len(values) != 1 {
+		return values
+	}
+
+	rv := reflect.ValueOf(values[0])
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return values
+	}
+
+	flat := make([]any, rv.Len())
+	for i := range flat {
+		flat[i] = rv.Index(i).Interface()
+	}
+	return flat
+}
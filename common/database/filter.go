@@ -6,7 +6,12 @@ type QueryFilter struct {
 	// WhereMap is used for equality conditions on fields.
 	WhereMap map[string]any
 
-	// WhereQuery is a custom WHERE clause with placeholders.
+	// Where is a composable filter expression (see And, Or, Not, Eq, In, ...) whose
+	// column names are validated against the model's schema.
+	Where Expr
+
+	// WhereQuery is a custom WHERE clause with placeholders. It is used as is, so it
+	// must never be built from user input; values go through WhereArgs.
 	WhereQuery string
 
 	// WhereArgs are the arguments for placeholders in WhereQuery.
@@ -36,10 +41,15 @@ type QueryFilter struct {
 	// Offset specifies the number of records to skip before starting to return records.
 	Offset int
 
+	// Cursor is an opaque page token returned by ListPage, it replaces Offset
+	// for keyset pagination and Limit is then used as the page size.
+	Cursor string
+
 	// Joins specifies the tables and conditions for JOIN operations.
 	Joins []Join
 
-	// RegexFilter specifies regex conditions for fields.
+	// RegexFilter specifies regex conditions for fields, translated to the native regex
+	// operator of the driver. Drivers without one fail with ErrUnsupportedFilter.
 	RegexFilter map[string]string
 
 	// Distinct specifies if only distinct records should be returned.
@@ -48,14 +58,23 @@ type QueryFilter struct {
 	// Pluck allows selecting a single column from the results.
 	Pluck string
 
-	// Or specifies OR conditions, allowing for complex query building.
+	// Or specifies alternative filters which are OR-ed with this filter's conditions.
+	// Only their where conditions (WhereMap, WhereQuery, Where, RegexFilter and Or) are used.
 	Or []QueryFilter
+
+	// Preload loads associations of the retrieved entities, with one query per association
+	// whatever the number of entities. It is used by Get, List, ListPage, ListDeleted and ForEach.
+	Preload []Preload
+
+	// Lock locks the retrieved rows until the end of the transaction, see RowLock. It is
+	// used by Get, List, ListPage, ForEach and Stream, which fail outside of a transaction.
+	Lock RowLock
 }
 
 // Join represents a JOIN operation in SQL, specifying the table, condition, and arguments.
 type Join struct {
-	Table     string // The table to join.
-	Condition string // The JOIN condition.
+	Table     string // The table to join, optionally followed by an alias.
+	Condition string // The JOIN condition, a trusted SQL fragment.
 	Args      []any  // Arguments for placeholders in Condition.
 	Type      string // Type of join: INNER, LEFT, RIGHT, OUTER, etc.
 }
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"time"
+)
+
+// Health reports the reachability of the primary and of the read replicas
+type Health struct {
+	// Primary is the error pinging the primary, nil when it is reachable
+	Primary error
+
+	// Replicas holds the error pinging each replica (keyed by host:port), nil when reachable
+	Replicas map[string]error
+}
+
+// Healthy reports if the database can serve queries. Unhealthy replicas do not make the
+// database unhealthy as their reads are served by the primary.
+func (h Health) Healthy() bool {
+	return h.Primary == nil
+}
+
+// PoolStats holds the statistics of a connection pool
+type PoolStats struct {
+	MaxOpenConnections int `json:"max_open_connections"`
+	OpenConnections    int `json:"open_connections"`
+	InUse              int `json:"in_use"`
+	Idle               int `json:"idle"`
+
+	// WaitCount is the number of times a connection had to be waited for, and
+	// WaitDuration the total time spent waiting
+	WaitCount    int64         `json:"wait_count"`
+	WaitDuration time.Duration `json:"wait_duration"`
+
+	// The number of connections closed because of the pool limits
+	MaxIdleClosed     int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64 `json:"max_lifetime_closed"`
+}
+
+// Stats holds the statistics of the connection pools of a database
+type Stats struct {
+	Primary  PoolStats            `json:"primary"`
+	Replicas map[string]PoolStats `json:"replicas,omitempty"`
+}
+
+// Ping implements `Ping()` from SQLDatabase interface
+func (db *sqlDatabase) Ping(ctx context.Context) error {
+	sqlDB, err := db.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Health implements `Health()` from SQLDatabase interface
+func (db *sqlDatabase) Health(ctx context.Context) Health {
+	health := Health{Primary: db.Ping(ctx)}
+	if db.replicas != nil {
+		health.Replicas = db.replicas.pingAll(ctx)
+	}
+	return health
+}
+
+// Stats implements `Stats()` from SQLDatabase interface
+func (db *sqlDatabase) Stats() Stats {
+	var stats Stats
+	if sqlDB, err := db.db.DB(); err == nil {
+		stats.Primary = poolStats(sqlDB)
+	}
+	if db.replicas != nil {
+		stats.Replicas = db.replicas.stats()
+	}
+	return stats
+}
+
+// PublishStats exports the pool statistics of db as the expvar variable database.<name>,
+// served as JSON on /debug/vars by the default HTTP mux. Publishing the same name
+// twice keeps the first database.
+func PublishStats(name string, db SQLDatabase) {
+	name = "database." + name
+	if expvar.Get(name) != nil {
+		return
+	}
+	expvar.Publish(name, expvar.Func(func() any {
+		return db.Stats()
+	}))
+}
+
+// healthReport is the JSON body served by HealthHandler, holding "ok" or the error message of
+// every database
+type healthReport struct {
+	Healthy  bool              `json:"healthy"`
+	Primary  string            `json:"primary"`
+	Replicas map[string]string `json:"replicas,omitempty"`
+}
+
+// HealthHandler serves the Health of db as JSON, with a 503 status when the primary can not
+// be reached. Unreachable replicas are reported without failing the check.
+func HealthHandler(db SQLDatabase) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := db.Health(r.Context())
+
+		report := healthReport{Healthy: health.Healthy(), Primary: "ok"}
+		if health.Primary != nil {
+			report.Primary = health.Primary.Error()
+		}
+		for replica, err := range health.Replicas {
+			if report.Replicas == nil {
+				report.Replicas = make(map[string]string)
+			}
+			report.Replicas[replica] = "ok"
+			if err != nil {
+				report.Replicas[replica] = err.Error()
+			}
+		}
+
+		status := http.StatusOK
+		if !report.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+func poolStats(sqlDB *sql.DB) PoolStats {
+	s := sqlDB.Stats()
+	return PoolStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDuration:       s.WaitDuration,
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
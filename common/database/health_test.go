@@ -0,0 +1,117 @@
+package database_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+)
+
+func TestConnectAttempts(t *testing.T) {
+	unreachable := &database.Config{
+		Driver:           "sqlite",
+		ConnectionString: filepath.Join(t.TempDir(), "missing", "db"),
+		ConnectAttempts:  3,
+		ConnectBackoff:   time.Millisecond,
+	}
+	_, err := database.NewSQLDatabase(unreachable)
+	if err == nil || !strings.Contains(err.Error(), "connect failed after 3 attempts") {
+		t.Errorf("unreachable database: got %v, want a failure after 3 attempts", err)
+	}
+
+	// The backoff is cut short once the context is done
+	unreachable.ConnectBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = database.NewSQLDatabaseContext(ctx, unreachable)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "connect abandoned after 1 attempts") {
+		t.Errorf("connect with a deadline: got %v, want abandoned after 1 attempt", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("connect outlived its deadline by %v", elapsed)
+	}
+
+	_, err = database.NewSQLDatabase(&database.Config{Driver: "oracle"})
+	if err == nil || !strings.Contains(err.Error(), "unsupported database driver") {
+		t.Errorf("unknown driver: got %v", err)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	dir := t.TempDir()
+	primary, missing := filepath.Join(dir, "primary"), filepath.Join(dir, "missing", "replica")
+	sqliteFile(t, primary)
+
+	db, err := database.NewSQLDatabase(&database.Config{
+		Driver:           "sqlite",
+		ConnectionString: primary,
+		Replicas:         []database.Replica{{ConnectionString: missing}},
+	})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	type report struct {
+		Healthy  bool              `json:"healthy"`
+		Primary  string            `json:"primary"`
+		Replicas map[string]string `json:"replicas"`
+	}
+	check := func() (int, report) {
+		rec := httptest.NewRecorder()
+		database.HealthHandler(db).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		var body report
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("content type: got %q", ct)
+		}
+		return rec.Code, body
+	}
+
+	// An unreachable replica is reported without failing the check
+	code, body := check()
+	if code != http.StatusOK || !body.Healthy || body.Primary != "ok" || body.Replicas[missing+":"] == "" || body.Replicas[missing+":"] == "ok" {
+		t.Errorf("unreachable replica: got %d %+v", code, body)
+	}
+
+	if err := db.Disconnect(); err != nil {
+		t.Fatalf("disconnect: %v", err)
+	}
+	code, body = check()
+	if code != http.StatusServiceUnavailable || body.Healthy || body.Primary == "ok" {
+		t.Errorf("disconnected primary: got %d %+v", code, body)
+	}
+}
+
+func TestPublishStats(t *testing.T) {
+	db := databasetest.New(t, &databasetest.Record{})
+	database.PublishStats("health_test", db)
+	database.PublishStats("health_test", databasetest.New(t))
+
+	published := expvar.Get("database.health_test")
+	if published == nil {
+		t.Fatal("stats not published")
+	}
+
+	var stats database.Stats
+	if err := json.Unmarshal([]byte(published.String()), &stats); err != nil {
+		t.Fatalf("decode %s: %v", published, err)
+	}
+
+	// In-memory SQLite databases are pinned to a single connection, kept open by the migration
+	if stats.Primary.MaxOpenConnections != 1 || stats.Primary.OpenConnections != 1 || stats.Replicas != nil {
+		t.Errorf("stats: got %+v", stats)
+	}
+}
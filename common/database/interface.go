@@ -1,30 +1,91 @@
 package database
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Repository represents a generic interface for CRUD operations on a database entity.
 // It defines methods to Create, Update, Delete, and Retrieve entities from the database.
+// Errors reported by the database are classified as ErrNotFound, ErrUniqueViolation,
+// ErrForeignKeyViolation, ErrDeadlock, ErrSerialization, ErrLockNotAvailable or ErrTimeout
+// when possible.
 type Repository[T any] interface {
 	// Create inserts a new entity into the database.
 	// The operation is performed within the context's scope and may return an error.
 	Create(ctx context.Context, entity *T) error
 
+	// CreateBatch inserts the entities using multi-row INSERTs of batchSize rows each
+	// (a default size is used when batchSize <= 0), all of them within one transaction.
+	// Generated primary keys are set on the entities.
+	CreateBatch(ctx context.Context, entities []T, batchSize int) error
+
+	// Upsert inserts the entities, updating updateColumns of the existing rows that conflict on
+	// conflictColumns (which must be covered by a unique index) or leaving them as is when no
+	// update columns are given. Updated rows which were soft deleted are restored, unless the
+	// index is partial: only the rows matching its condition conflict then. It uses the
+	// native ON CONFLICT, ON DUPLICATE KEY UPDATE or MERGE of the driver and returns how many
+	// entities were inserted, updated or left unchanged, as reported by the driver. Of the
+	// entities with the same conflict key only the last one is written. Hooks are not called
+	// and associations are not saved. Generated primary keys set on the entities are only
+	// reliable when none of them was left unchanged. Updates of tenant scoped models must
+	// conflict on TenantColumn, and on MySQL every unique key of the model must include it.
+	Upsert(ctx context.Context, entities []T, conflictColumns, updateColumns []string) (*UpsertResult, error)
+
 	// Update modifies an existing entity based on set of conditions defined as query filter.
+	// For models with an integer Version field the version is incremented on every update, and
+	// when UpdateMap carries the version the caller read, only rows still at that version are
+	// updated; ErrConcurrentModification is returned if the matching rows have moved on.
 	// It returns an error if the update operation fails.
 	Update(ctx context.Context, qf QueryFilter) error
 
 	// Delete removes an entity from the database based on where conditions.
+	// Models with a gorm.DeletedAt field are soft deleted: the rows are only marked as
+	// deleted and are excluded from every other query until restored or purged.
 	// It returns an error if the deletion fails.
 	Delete(ctx context.Context, qf QueryFilter) error
 
+	// Restore brings back the soft deleted entities matching the query filter.
+	// It returns ErrSoftDeleteUnsupported if the model can not be soft deleted, and
+	// ErrRestoreConflict if a restored entity has the unique key of a live one, as
+	// when a unique index is restricted to the live rows and the key was reused
+	// since the entity was deleted. No entity is restored then.
+	Restore(ctx context.Context, qf QueryFilter) error
+
+	// ListDeleted retrieves the soft deleted entities matching the query filter and projection.
+	// It returns ErrSoftDeleteUnsupported if the model can not be soft deleted.
+	ListDeleted(ctx context.Context, qf QueryFilter, p *Projection) ([]T, error)
+
+	// Purge permanently removes the entities soft deleted more than olderThan ago.
+	// It returns the number of purged entities, or ErrSoftDeleteUnsupported if the
+	// model can not be soft deleted.
+	Purge(ctx context.Context, olderThan time.Duration) (int64, error)
+
 	// Get retrieves a single entity from the database that matches the provided query filters and projection.
-	// It returns the found entity or an error if the retrieval fails.
+	// It returns the found entity, ErrNotFound if there is none or an error if the retrieval fails.
 	Get(ctx context.Context, qf QueryFilter, p *Projection) (*T, error)
 
 	// List retrieves multiple entities from the database that match the provided query filters and projection.
 	// It returns a slice of entities or an error if the retrieval fails.
 	List(ctx context.Context, qf QueryFilter, p *Projection) ([]T, error)
 
+	// ListPage retrieves a single page of entities using keyset pagination over the OrderBy columns
+	// (with the primary key appended as a tiebreak). qf.Cursor selects the page and qf.Limit its size.
+	// It returns the page with the cursors of its neighbouring pages or an error if the retrieval fails.
+	ListPage(ctx context.Context, qf QueryFilter, p *Projection) (*Page[T], error)
+
+	// ForEach calls fn for every entity matching the query filter, reading them in keyset paginated
+	// batches of batchSize entities (see ListPage) so that only one batch is held in memory at a time.
+	// qf.Limit, if set, caps the number of visited entities. Unlike ListPage it needs no cursor
+	// key, unless qf.Cursor is set to start from a page handed out by ListPage. Iteration stops
+	// at the first error returned by fn or when the context is done, and that error is returned.
+	ForEach(ctx context.Context, qf QueryFilter, batchSize int, fn func(entity *T) error) error
+
+	// Stream runs a single query and returns an iterator reading its rows one at a time as the
+	// driver receives them. The stream holds a connection until it is closed, so no other query
+	// should be issued on the same transaction while iterating. Associations can not be preloaded.
+	Stream(ctx context.Context, qf QueryFilter, p *Projection) (*Stream[T], error)
+
 	// Batch retrieves a batch of entities from the database based on the provided column name and IDs.
 	// It's upto clients to correctly define the column which has IDs (such as the column that has primary keys).
 	// It returns a slice of entities or an error if the retrieval fails.
@@ -41,4 +102,14 @@ type Repository[T any] interface {
 	// All returns all the entities from the database without any filters.
 	// It returns slice of entities or an error if the retrieval fails.
 	All(ctx context.Context) ([]T, error)
+
+	// RunInTx runs fn inside a transaction, or inside a savepoint if the repository is
+	// already bound to one. All the writes made through tx-bound handlers either fully
+	// commit or fully roll back. With a retry policy (see WithRetryPolicy) a new transaction
+	// failing with a transient error is run again, so fn must be safe to repeat.
+	RunInTx(ctx context.Context, fn func(tx *Tx) error) error
+
+	// WithTx returns a copy of the repository which executes all of its operations
+	// within the given transaction.
+	WithTx(tx *Tx) Repository[T]
 }
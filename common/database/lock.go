@@ -0,0 +1,116 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LockMode is the strength of the row locks taken by a query
+type LockMode string
+
+const (
+	// LockForUpdate locks the rows exclusively, as if they were about to be updated
+	LockForUpdate LockMode = "UPDATE"
+
+	// LockForShare locks the rows against concurrent updates, other readers may share the lock
+	LockForShare LockMode = "SHARE"
+)
+
+// LockWait defines what a locking query does with rows locked by another transaction
+type LockWait string
+
+const (
+	// LockBlock waits for the locks to be released, it is the default
+	LockBlock LockWait = ""
+
+	// LockNoWait fails right away with ErrLockNotAvailable when a row is already locked
+	LockNoWait LockWait = "NOWAIT"
+
+	// LockSkipLocked skips the rows that are already locked, to consume a table as a queue
+	LockSkipLocked LockWait = "SKIP LOCKED"
+)
+
+// RowLock locks the rows read by a query until the end of its transaction. It translates
+// to FOR UPDATE / FOR SHARE on postgres and mysql and to table hints on sqlserver. SQLite
+// locks the whole database on write, so row locks are a no-op there.
+type RowLock struct {
+	Mode LockMode
+	Wait LockWait
+}
+
+// applyLock adds the row lock to a query, it must run within a transaction as the locks
+// would be released right away otherwise
+func applyLock(query *gorm.DB, lock RowLock) *gorm.DB {
+	if lock == (RowLock{}) {
+		return query
+	}
+
+	err := validateLock(lock, inTransaction(query.Statement.ConnPool))
+	if err != nil {
+		query.AddError(err)
+		return query
+	}
+
+	switch d := dialectOf(query); d {
+	case dialectPostgres, dialectMySQL:
+		return query.Clauses(clause.Locking{Strength: string(lock.Mode), Options: string(lock.Wait)})
+	case dialectSQLServer:
+		return sqlserverLockHints(query, lock)
+	case dialectSQLite:
+		return query
+	default:
+		query.AddError(d.unsupported("row locks"))
+		return query
+	}
+}
+
+// validateLock checks the mode and wait policy of a row lock taken within a transaction or not
+func validateLock(lock RowLock, inTx bool) error {
+	switch lock.Mode {
+	case LockForUpdate, LockForShare:
+	default:
+		return fmt.Errorf("%w: invalid lock mode %q", ErrInvalidFilter, lock.Mode)
+	}
+	switch lock.Wait {
+	case LockBlock, LockNoWait, LockSkipLocked:
+	default:
+		return fmt.Errorf("%w: invalid lock wait %q", ErrInvalidFilter, lock.Wait)
+	}
+
+	if !inTx {
+		return fmt.Errorf("%w: rows can only be locked within a transaction", ErrInvalidFilter)
+	}
+	return nil
+}
+
+// sqlserverLockHints locks the rows with table hints, as SQL Server has no FOR clause
+func sqlserverLockHints(query *gorm.DB, lock RowLock) *gorm.DB {
+	hints := "UPDLOCK, ROWLOCK"
+	if lock.Mode == LockForShare {
+		hints = "REPEATABLEREAD, ROWLOCK"
+	}
+	switch lock.Wait {
+	case LockNoWait:
+		hints += ", NOWAIT"
+	case LockSkipLocked:
+		hints += ", READPAST"
+	}
+
+	if query.Statement.Schema == nil {
+		err := query.Statement.Parse(query.Statement.Model)
+		if err != nil {
+			query.AddError(err)
+			return query
+		}
+	}
+
+	table := query.Statement.Schema.Table
+	query.Statement.TableExpr = &clause.Expr{
+		SQL:  "? WITH (" + hints + ")",
+		Vars: []any{clause.Table{Name: table}},
+	}
+	query.Statement.Table = table
+	return query
+}
@@ -0,0 +1,1178 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var _ Repository[any] = &MemoryRepository[any]{}
+
+// errNotMemoryTx is returned by in-memory repositories bound to a transaction of another database
+var errNotMemoryTx = errors.New("database: transaction does not belong to the memory database")
+
+// MemoryDatabase holds the tables of in-memory repositories (see MemoryRepository), so that
+// code built on Repository can be unit tested without a database. As on SQLite, writes are
+// serialized: a transaction holds the write lock of the whole database until it ends, and
+// reads made outside of it see the last committed state.
+type MemoryDatabase struct {
+	writer  sync.Mutex
+	mu      sync.RWMutex
+	tables  map[string]any
+	schemas sync.Map
+}
+
+// NewMemoryDatabase returns an empty in-memory database
+func NewMemoryDatabase() *MemoryDatabase {
+	return &MemoryDatabase{tables: make(map[string]any)}
+}
+
+// memoryTable holds the rows of a table in insertion order. Tables are copied on write,
+// so that readers can keep using the version they got.
+type memoryTable[T any] struct {
+	rows []T
+
+	// seq is the last generated primary key
+	seq int64
+}
+
+// tableOf returns the table of the given name, which is empty if it was never written to
+func tableOf[T any](tables map[string]any, name string) *memoryTable[T] {
+	if t, ok := tables[name].(*memoryTable[T]); ok {
+		return t
+	}
+	return &memoryTable[T]{}
+}
+
+func (t *memoryTable[T]) clone() *memoryTable[T] {
+	return &memoryTable[T]{rows: slices.Clone(t.rows), seq: t.seq}
+}
+
+// memoryTx is a transaction of a MemoryDatabase, it works on its own version of the
+// tables which replaces the committed one on commit
+type memoryTx struct {
+	db     *MemoryDatabase
+	mu     sync.Mutex
+	tables map[string]any
+	done   bool
+}
+
+// runInTx runs fn in a new transaction, which is committed when fn returns nil
+func (db *MemoryDatabase) runInTx(ctx context.Context, fn func(tx *Tx) error) error {
+	err := ctx.Err()
+	if err != nil {
+		return classifyError(err)
+	}
+
+	db.writer.Lock()
+	defer db.writer.Unlock()
+
+	db.mu.RLock()
+	m := &memoryTx{db: db, tables: maps.Clone(db.tables)}
+	db.mu.RUnlock()
+
+	// Rolling back is only a matter of dropping the transaction's tables
+	defer m.end(false)
+
+	err = fn(&Tx{memory: m})
+	if err != nil {
+		return err
+	}
+	m.end(true)
+	return nil
+}
+
+// end commits or rolls back the transaction, it is a no-op once the transaction ended
+func (m *memoryTx) end(commit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.done {
+		return
+	}
+	if commit {
+		m.db.mu.Lock()
+		m.db.tables = m.tables
+		m.db.mu.Unlock()
+	}
+	m.done, m.tables = true, nil
+}
+
+// runInSavepoint runs fn in a nested unit of work, the tables are restored to their
+// state before fn if it fails
+func (m *memoryTx) runInSavepoint(tx *Tx, fn func(tx *Tx) error) (err error) {
+	m.mu.Lock()
+	if m.done {
+		m.mu.Unlock()
+		return sql.ErrTxDone
+	}
+	saved := maps.Clone(m.tables)
+	m.mu.Unlock()
+
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			m.mu.Lock()
+			if !m.done {
+				m.tables = saved
+			}
+			m.mu.Unlock()
+		}
+	}()
+
+	err = fn(&Tx{memory: m, depth: tx.depth + 1})
+	panicked = false
+	return err
+}
+
+// memoryScope selects the rows of a soft deletable model a query applies to
+type memoryScope int
+
+const (
+	scopeLive memoryScope = iota
+	scopeDeleted
+	scopeAll
+)
+
+// uniqueKey is a set of columns whose values must be unique across the rows of a table
+type uniqueKey struct {
+	name    string
+	fields  []*schema.Field
+	primary bool
+
+	// live is the deleted_at field of a key only enforced between live rows
+	live *schema.Field
+}
+
+// uniqueKeys returns the primary key, unique indexes and unique columns of the model.
+// Partial indexes are left out as their condition is SQL, except the ones restricted
+// to the live rows with a "deleted_at IS NULL" condition.
+func uniqueKeys(sch *schema.Schema) []uniqueKey {
+	var keys []uniqueKey
+	deletedAt := deletedAtField(sch)
+	if len(sch.PrimaryFields) > 0 {
+		keys = append(keys, uniqueKey{name: sch.Table + "_pkey", fields: sch.PrimaryFields, primary: true})
+	}
+
+	indexes := sch.ParseIndexes()
+	for _, name := range sortedKeys(indexes) {
+		index := indexes[name]
+		if index.Class != "UNIQUE" {
+			continue
+		}
+
+		key := uniqueKey{name: name}
+		if index.Where != "" {
+			if deletedAt == nil || !strings.EqualFold(strings.Join(strings.Fields(index.Where), " "), deletedAt.DBName+" IS NULL") {
+				continue
+			}
+			key.live = deletedAt
+		}
+		for _, option := range index.Fields {
+			key.fields = append(key.fields, option.Field)
+		}
+		keys = append(keys, key)
+	}
+
+	for _, field := range sch.Fields {
+		if field.Unique && field.DBName != "" {
+			keys = append(keys, uniqueKey{name: "uni_" + sch.Table + "_" + field.DBName, fields: []*schema.Field{field}})
+		}
+	}
+	return keys
+}
+
+// MemoryRepository is a Repository keeping its entities in a MemoryDatabase. It evaluates
+// query filters, orderings and projections against the entities with the semantics they
+// have with a SQLHandler on SQLite, which databasetest.RunConformance checks. Filters that
+// need a database (custom where clauses, joins, grouping, distinct, preloads and computed
+// projections) fail with ErrUnsupportedFilter. Associations are neither saved nor loaded,
+// foreign keys are not enforced and hooks are not called.
+type MemoryRepository[T any] struct {
+	db     *MemoryDatabase
+	tx     *Tx
+	schema *schema.Schema
+	unique []uniqueKey
+	err    error
+	opts   options
+}
+
+// NewMemoryRepository returns an in-memory repository of the entities of type T stored in db.
+// Retry policies are ignored as there are no transient errors in memory.
+func NewMemoryRepository[T any](db *MemoryDatabase, opts ...Option) *MemoryRepository[T] {
+	r := &MemoryRepository[T]{db: db, opts: newOptions(opts)}
+	r.schema, r.err = schema.Parse(new(T), &db.schemas, schema.NamingStrategy{})
+	if r.err == nil {
+		r.unique = uniqueKeys(r.schema)
+	}
+	return r
+}
+
+// MemoryTxRepository returns an in-memory repository of the entities of type T bound to the
+// given transaction of a MemoryDatabase, it is the in-memory counterpart of TxHandler
+func MemoryTxRepository[T any](tx *Tx, opts ...Option) *MemoryRepository[T] {
+	if tx.memory == nil {
+		return &MemoryRepository[T]{err: errNotMemoryTx}
+	}
+
+	r := NewMemoryRepository[T](tx.memory.db, opts...)
+	r.tx = tx
+	return r
+}
+
+// WithTx implements `WithTx()` from Repository interface
+func (r *MemoryRepository[T]) WithTx(tx *Tx) Repository[T] {
+	if tx.memory == nil || tx.memory.db != r.db {
+		return &MemoryRepository[T]{err: errNotMemoryTx}
+	}
+
+	bound := *r
+	bound.tx = tx
+	return &bound
+}
+
+// RunInTx implements `RunInTx()` from Repository interface. Writes made outside of the
+// transaction while it runs wait for it to end, so they must not be made by fn.
+func (r *MemoryRepository[T]) RunInTx(ctx context.Context, fn func(tx *Tx) error) error {
+	if r.err != nil {
+		return r.err
+	}
+	if r.tx != nil {
+		return r.tx.RunInTx(ctx, fn)
+	}
+	return r.db.runInTx(ctx, fn)
+}
+
+// read calls fn with the rows of the table, as committed or as seen by the transaction of
+// the repository. The rows must not be modified.
+func (r *MemoryRepository[T]) read(ctx context.Context, fn func(rows []T) error) error {
+	err := r.check(ctx)
+	if err != nil {
+		return err
+	}
+
+	if r.tx != nil {
+		m := r.tx.memory
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if m.done {
+			return sql.ErrTxDone
+		}
+		return fn(tableOf[T](m.tables, r.schema.Table).rows)
+	}
+
+	r.db.mu.RLock()
+	t := tableOf[T](r.db.tables, r.schema.Table)
+	r.db.mu.RUnlock()
+	return fn(t.rows)
+}
+
+// write calls fn with a copy of the table, which replaces the table if fn succeeds so
+// that every statement is atomic. Outside of a transaction the write is committed right away.
+func (r *MemoryRepository[T]) write(ctx context.Context, fn func(t *memoryTable[T]) error) error {
+	err := r.check(ctx)
+	if err != nil {
+		return err
+	}
+
+	if r.tx != nil {
+		m := r.tx.memory
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if m.done {
+			return sql.ErrTxDone
+		}
+		t := tableOf[T](m.tables, r.schema.Table).clone()
+		err = fn(t)
+		if err != nil {
+			return err
+		}
+		m.tables[r.schema.Table] = t
+		return nil
+	}
+
+	r.db.writer.Lock()
+	defer r.db.writer.Unlock()
+
+	r.db.mu.RLock()
+	t := tableOf[T](r.db.tables, r.schema.Table).clone()
+	r.db.mu.RUnlock()
+
+	err = fn(t)
+	if err != nil {
+		return err
+	}
+
+	r.db.mu.Lock()
+	r.db.tables[r.schema.Table] = t
+	r.db.mu.Unlock()
+	return nil
+}
+
+// check returns the error of the repository or of the context
+func (r *MemoryRepository[T]) check(ctx context.Context) error {
+	if r.err != nil {
+		return r.err
+	}
+	return classifyError(ctx.Err())
+}
+
+// lock validates the row lock of a query. Rows are not locked in memory, as transactions
+// are serialized anyway.
+func (r *MemoryRepository[T]) lock(lock RowLock) error {
+	if lock == (RowLock{}) {
+		return nil
+	}
+	return validateLock(lock, r.tx != nil)
+}
+
+// match returns the indexes of the rows in scope matching the where conditions of the filter
+func (r *MemoryRepository[T]) match(f *memoryFilter, rows []T, qf QueryFilter, scope memoryScope) ([]int, error) {
+	deletedAt := deletedAtField(r.schema)
+	tenant, scoped, err := r.tenant(f.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []int
+	for i := range rows {
+		rv := reflect.ValueOf(&rows[i]).Elem()
+		if scoped != nil && equal(f.value(scoped, rv), tenant) != sqlTrue {
+			continue
+		}
+		if deletedAt != nil && scope != scopeAll {
+			deleted := f.value(deletedAt, rv) != nil
+			if deleted != (scope == scopeDeleted) {
+				continue
+			}
+		}
+
+		v, ok, err := f.where(qf, rv)
+		if err != nil {
+			return nil, err
+		}
+		if ok && v != sqlTrue {
+			continue
+		}
+		matched = append(matched, i)
+	}
+	return matched, nil
+}
+
+// tenant returns the tenant field of T and the tenant of ctx the rows are scoped to, the
+// field is nil when T is not tenant scoped or ctx is CrossTenant
+func (r *MemoryRepository[T]) tenant(ctx context.Context) (string, *schema.Field, error) {
+	field := tenantField(r.schema)
+	if field == nil {
+		return "", nil, nil
+	}
+	tenant, all, err := tenantScope(ctx)
+	if err != nil || all {
+		return "", nil, err
+	}
+	return tenant, field, nil
+}
+
+// find returns copies of the rows in scope matching the filter, ordered, limited and
+// projected as requested
+func (r *MemoryRepository[T]) find(ctx context.Context, qf QueryFilter, p *Projection, scope memoryScope) ([]T, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	f := newMemoryFilter(ctx, r.schema)
+	err := f.supported(qf, p)
+	if err != nil {
+		return nil, err
+	}
+	order, err := f.order(qf.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := f.projection(qf.Pluck, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var entities []T
+	err = r.read(ctx, func(rows []T) error {
+		matched, err := r.match(f, rows, qf, scope)
+		if err != nil {
+			return err
+		}
+
+		entities = make([]T, len(matched))
+		for i, j := range matched {
+			entities[i] = rows[j]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.sort(f, entities, order)
+
+	if qf.Offset > 0 {
+		entities = entities[min(qf.Offset, len(entities)):]
+	}
+	if qf.Limit > 0 && qf.Limit < len(entities) {
+		entities = entities[:qf.Limit]
+	}
+
+	return r.project(f, entities, columns), nil
+}
+
+func (r *MemoryRepository[T]) sort(f *memoryFilter, entities []T, order []memoryOrder) {
+	if len(order) == 0 {
+		return
+	}
+	slices.SortStableFunc(entities, func(a, b T) int {
+		return f.compareRows(reflect.ValueOf(&a).Elem(), reflect.ValueOf(&b).Elem(), order)
+	})
+}
+
+// project keeps the given columns of the entities only, all of them are kept when columns is nil
+func (r *MemoryRepository[T]) project(f *memoryFilter, entities []T, columns []*schema.Field) []T {
+	if columns == nil {
+		return entities
+	}
+
+	projected := make([]T, len(entities))
+	for i := range entities {
+		src := reflect.ValueOf(&entities[i]).Elem()
+		dst := reflect.ValueOf(&projected[i]).Elem()
+		for _, field := range columns {
+			field.ReflectValueOf(f.ctx, dst).Set(field.ReflectValueOf(f.ctx, src))
+		}
+	}
+	return projected
+}
+
+// insert adds a copy of the entity to the table, after setting its generated primary key,
+// timestamps and default values the way GORM does on create
+func (r *MemoryRepository[T]) insert(f *memoryFilter, t *memoryTable[T], entity *T, now time.Time) error {
+	rv := reflect.ValueOf(entity).Elem()
+	if field := tenantField(r.schema); field != nil {
+		err := stampTenant(f.ctx, field, rv)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, field := range r.schema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		if _, zero := field.ValueOf(f.ctx, rv); !zero {
+			continue
+		}
+
+		var err error
+		switch {
+		case field.AutoIncrement && field.PrimaryKey:
+			t.seq++
+			err = field.Set(f.ctx, rv, t.seq)
+		case field.AutoCreateTime > 0 || field.AutoUpdateTime > 0:
+			err = field.Set(f.ctx, rv, now)
+		case field.HasDefaultValue && field.DefaultValueInterface != nil:
+			err = field.Set(f.ctx, rv, field.DefaultValueInterface)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Explicit keys move the sequence forward, as SQLite picks the next key after the largest one
+	if field := r.schema.PrioritizedPrimaryField; field != nil && field.AutoIncrement {
+		switch id := f.value(field, rv).(type) {
+		case int64:
+			t.seq = max(t.seq, id)
+		case uint64:
+			t.seq = max(t.seq, int64(id))
+		}
+	}
+
+	row := *entity
+	stored := reflect.ValueOf(&row).Elem()
+	for _, rel := range r.schema.Relationships.Relations {
+		rel.Field.ReflectValueOf(f.ctx, stored).SetZero()
+	}
+
+	err := r.checkUnique(f, t.rows, stored, -1)
+	if err != nil {
+		return err
+	}
+	t.rows = append(t.rows, row)
+	return nil
+}
+
+// checkUnique returns a ConstraintError if the row has the same unique key as any of the rows
+// but the one at index skip. As in SQL, keys with a NULL column never conflict.
+func (r *MemoryRepository[T]) checkUnique(f *memoryFilter, rows []T, row reflect.Value, skip int) error {
+	for _, key := range r.unique {
+		if key.live != nil && f.value(key.live, row) != nil {
+			continue
+		}
+
+		values := make([]any, len(key.fields))
+		null := false
+		for i, field := range key.fields {
+			values[i] = f.value(field, row)
+			null = null || values[i] == nil
+		}
+		if null {
+			continue
+		}
+
+		for i := range rows {
+			if i == skip {
+				continue
+			}
+
+			other := reflect.ValueOf(&rows[i]).Elem()
+			if key.live != nil && f.value(key.live, other) != nil {
+				continue
+			}
+
+			duplicate := true
+			for j, field := range key.fields {
+				if equal(f.value(field, other), values[j]) != sqlTrue {
+					duplicate = false
+					break
+				}
+			}
+			if duplicate {
+				return &ConstraintError{
+					Kind:       ErrUniqueViolation,
+					Constraint: key.name,
+					Err:        fmt.Errorf("duplicate key value violates unique constraint %q", key.name),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// memoryAssignment is a column set by an update
+type memoryAssignment struct {
+	field *schema.Field
+	value any
+}
+
+// assignments resolves the columns of an update map, the way GORM does
+func (r *MemoryRepository[T]) assignments(updates map[string]any) ([]memoryAssignment, error) {
+	var assignments []memoryAssignment
+	for _, key := range sortedKeys(updates) {
+		field := r.schema.LookUpField(key)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("%w: unknown column %q for %s", ErrInvalidFilter, key, r.schema.Name)
+		}
+
+		switch updates[key].(type) {
+		case clause.Expression, *gorm.DB:
+			return nil, memoryUnsupported("updating columns to SQL expressions")
+		}
+		assignments = append(assignments, memoryAssignment{field: field, value: updates[key]})
+	}
+	return assignments, nil
+}
+
+// assign sets the columns of the row, refreshes its update timestamps and increments its
+// version if the model is versioned
+func (r *MemoryRepository[T]) assign(f *memoryFilter, row reflect.Value, assignments []memoryAssignment, version *schema.Field, now time.Time) error {
+	assigned := make(map[*schema.Field]bool, len(assignments))
+	for _, a := range assignments {
+		err := a.field.Set(f.ctx, row, a.value)
+		if err != nil {
+			return err
+		}
+		assigned[a.field] = true
+	}
+
+	for _, field := range r.schema.Fields {
+		if field.AutoUpdateTime > 0 && field.DBName != "" && !assigned[field] {
+			err := field.Set(f.ctx, row, now)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if version != nil && !assigned[version] {
+		v := reflect.Indirect(version.ReflectValueOf(f.ctx, row))
+		switch {
+		case !v.IsValid():
+		case v.CanInt():
+			v.SetInt(v.Int() + 1)
+		default:
+			v.SetUint(v.Uint() + 1)
+		}
+	}
+	return nil
+}
+
+// hasConditions reports whether the filter restricts the rows, GORM refuses to update or
+// delete all the rows of a table otherwise
+func hasConditions(qf QueryFilter) bool {
+	return len(qf.WhereMap) > 0 || qf.WhereQuery != "" || len(qf.RegexFilter) > 0 || qf.Where != nil || len(qf.Or) > 0
+}
+
+// Create implements `Create()` from Repository interface
+func (r *MemoryRepository[T]) Create(ctx context.Context, entity *T) error {
+	return r.write(ctx, func(t *memoryTable[T]) error {
+		return r.insert(newMemoryFilter(ctx, r.schema), t, entity, time.Now())
+	})
+}
+
+// CreateBatch implements `CreateBatch()` from Repository interface
+func (r *MemoryRepository[T]) CreateBatch(ctx context.Context, entities []T, batchSize int) error {
+	if len(entities) == 0 {
+		return nil
+	}
+
+	return r.write(ctx, func(t *memoryTable[T]) error {
+		f := newMemoryFilter(ctx, r.schema)
+		now := time.Now()
+		for i := range entities {
+			err := r.insert(f, t, &entities[i], now)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Upsert implements `Upsert()` from Repository interface
+func (r *MemoryRepository[T]) Upsert(ctx context.Context, entities []T, conflictColumns, updateColumns []string) (*UpsertResult, error) {
+	result := &UpsertResult{}
+	if len(entities) == 0 {
+		return result, nil
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	conflictFields, err := lookUpFields(r.schema, conflictColumns)
+	if err != nil {
+		return nil, err
+	}
+	if len(conflictFields) == 0 {
+		return nil, fmt.Errorf("%w: upsert requires conflict columns", ErrInvalidFilter)
+	}
+	updateFields, err := lookUpFields(r.schema, updateColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []memoryAssignment
+	restore := true
+	deletedAt := deletedAtField(r.schema)
+	for _, field := range updateFields {
+		updates = append(updates, memoryAssignment{field: field})
+		restore = restore && field != deletedAt
+	}
+	version := versionField(r.schema)
+
+	// As in SQL, the soft deleted rows do not conflict on a key only enforced between live rows
+	var live *schema.Field
+	if conflictCondition(r.schema, conflictFields) != "" {
+		for _, key := range r.unique {
+			if key.live != nil && sameColumns(key.fields, conflictFields) {
+				live = key.live
+			}
+		}
+	}
+
+	// The tenant is stamped before the entities are deduplicated on their conflict key,
+	// as on create
+	if tenant := tenantField(r.schema); tenant != nil {
+		if len(updates) > 0 {
+			err := checkTenantConflict(fieldColumns(conflictFields))
+			if err != nil {
+				return nil, err
+			}
+		}
+		for i := range entities {
+			err := stampTenant(ctx, tenant, reflect.ValueOf(&entities[i]).Elem())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	keep := lastByKey(ctx, conflictFields, entities)
+
+	err = r.write(ctx, func(t *memoryTable[T]) error {
+		*result = UpsertResult{}
+		f := newMemoryFilter(ctx, r.schema)
+		now := time.Now()
+
+		for _, i := range keep {
+			entity := reflect.ValueOf(&entities[i]).Elem()
+
+			// Soft deleted rows conflict too, the update restores them
+			existing := -1
+			for j := range t.rows {
+				row := reflect.ValueOf(&t.rows[j]).Elem()
+				if live != nil && f.value(live, row) != nil {
+					continue
+				}
+				conflict := true
+				for _, field := range conflictFields {
+					if equal(f.value(field, row), f.value(field, entity)) != sqlTrue {
+						conflict = false
+						break
+					}
+				}
+				if conflict {
+					existing = j
+					break
+				}
+			}
+
+			switch {
+			case existing < 0:
+				err := r.insert(f, t, &entities[i], now)
+				if err != nil {
+					return err
+				}
+				result.Inserted++
+			case len(updates) == 0:
+				result.Unchanged++
+			default:
+				row := reflect.ValueOf(&t.rows[existing]).Elem()
+				for k := range updates {
+					updates[k].value = updates[k].field.ReflectValueOf(f.ctx, entity).Interface()
+				}
+				assignments := updates
+				if deletedAt != nil && restore {
+					assignments = append(slices.Clip(updates), memoryAssignment{field: deletedAt})
+				}
+				err := r.assign(f, row, assignments, version, now)
+				if err != nil {
+					return err
+				}
+				err = r.checkUnique(f, t.rows, row, existing)
+				if err != nil {
+					return err
+				}
+
+				// The entity gets the primary key of the updated row, as returned by the databases
+				for _, field := range r.schema.PrimaryFields {
+					err := field.Set(f.ctx, entity, field.ReflectValueOf(f.ctx, row).Interface())
+					if err != nil {
+						return err
+					}
+				}
+				result.Updated++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Update implements `Update()` from Repository interface
+func (r *MemoryRepository[T]) Update(ctx context.Context, qf QueryFilter) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	f := newMemoryFilter(ctx, r.schema)
+	err := f.supported(qf, nil)
+	if err != nil {
+		return err
+	}
+	if !hasConditions(qf) {
+		return classifyError(gorm.ErrMissingWhereClause)
+	}
+
+	assignments, err := r.assignments(qf.UpdateMap)
+	if err != nil {
+		return err
+	}
+	for _, a := range assignments {
+		if a.field == tenantField(r.schema) {
+			err := checkTenantAssignment(ctx, a.value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// A version given in the update map is the one the caller read, see versionedUpdates
+	version := versionField(r.schema)
+	var expected any
+	checked := false
+	if version != nil {
+		kept := assignments[:0]
+		for _, a := range assignments {
+			if a.field != version {
+				kept = append(kept, a)
+				continue
+			}
+			if checked {
+				return fmt.Errorf("%w: version given more than once", ErrInvalidFilter)
+			}
+			expected, checked = a.value, true
+		}
+		assignments = kept
+	}
+
+	return r.write(ctx, func(t *memoryTable[T]) error {
+		matched, err := r.match(f, t.rows, qf, scopeLive)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		updated := 0
+		for _, i := range matched {
+			row := reflect.ValueOf(&t.rows[i]).Elem()
+			if checked && equal(f.value(version, row), expected) != sqlTrue {
+				continue
+			}
+
+			err := r.assign(f, row, assignments, version, now)
+			if err != nil {
+				return err
+			}
+			err = r.checkUnique(f, t.rows, row, i)
+			if err != nil {
+				return err
+			}
+			updated++
+		}
+
+		if checked && updated == 0 && len(matched) > 0 {
+			return ErrConcurrentModification
+		}
+		return nil
+	})
+}
+
+// Delete implements `Delete()` from Repository interface
+func (r *MemoryRepository[T]) Delete(ctx context.Context, qf QueryFilter) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	f := newMemoryFilter(ctx, r.schema)
+	err := f.supported(qf, nil)
+	if err != nil {
+		return err
+	}
+	if !hasConditions(qf) {
+		return classifyError(gorm.ErrMissingWhereClause)
+	}
+
+	deletedAt := deletedAtField(r.schema)
+	return r.write(ctx, func(t *memoryTable[T]) error {
+		matched, err := r.match(f, t.rows, qf, scopeLive)
+		if err != nil {
+			return err
+		}
+
+		if deletedAt != nil {
+			now := time.Now()
+			for _, i := range matched {
+				err := deletedAt.Set(f.ctx, reflect.ValueOf(&t.rows[i]).Elem(), now)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		t.rows = removeRows(t.rows, matched)
+		return nil
+	})
+}
+
+// removeRows removes the rows at the given (ascending) indexes
+func removeRows[T any](rows []T, indexes []int) []T {
+	kept := rows[:0]
+	next := 0
+	for i := range rows {
+		if next < len(indexes) && indexes[next] == i {
+			next++
+			continue
+		}
+		kept = append(kept, rows[i])
+	}
+	return kept
+}
+
+// softDeleteField returns the gorm.DeletedAt field of T or ErrSoftDeleteUnsupported
+func (r *MemoryRepository[T]) softDeleteField() (*schema.Field, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	field := deletedAtField(r.schema)
+	if field == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSoftDeleteUnsupported, r.schema.Name)
+	}
+	return field, nil
+}
+
+// Restore implements `Restore()` from Repository interface
+func (r *MemoryRepository[T]) Restore(ctx context.Context, qf QueryFilter) error {
+	deletedAt, err := r.softDeleteField()
+	if err != nil {
+		return err
+	}
+
+	f := newMemoryFilter(ctx, r.schema)
+	err = f.supported(qf, nil)
+	if err != nil {
+		return err
+	}
+
+	restore := []memoryAssignment{{field: deletedAt}}
+	return r.write(ctx, func(t *memoryTable[T]) error {
+		matched, err := r.match(f, t.rows, qf, scopeDeleted)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, i := range matched {
+			row := reflect.ValueOf(&t.rows[i]).Elem()
+			err := r.assign(f, row, restore, nil, now)
+			if err != nil {
+				return err
+			}
+			err = r.checkUnique(f, t.rows, row, i)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrRestoreConflict, err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListDeleted implements `ListDeleted()` from Repository interface
+func (r *MemoryRepository[T]) ListDeleted(ctx context.Context, qf QueryFilter, p *Projection) ([]T, error) {
+	_, err := r.softDeleteField()
+	if err != nil {
+		return nil, err
+	}
+	return r.find(ctx, qf, p, scopeDeleted)
+}
+
+// Purge implements `Purge()` from Repository interface
+func (r *MemoryRepository[T]) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	deletedAt, err := r.softDeleteField()
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	cutoff := time.Now().Add(-olderThan)
+	tenant, scoped, err := r.tenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	err = r.write(ctx, func(t *memoryTable[T]) error {
+		f := newMemoryFilter(ctx, r.schema)
+		var expired []int
+		for i := range t.rows {
+			row := reflect.ValueOf(&t.rows[i]).Elem()
+			if scoped != nil && equal(f.value(scoped, row), tenant) != sqlTrue {
+				continue
+			}
+			deleted := f.value(deletedAt, row)
+			if compareWith(deleted, cutoff, func(c int) bool { return c < 0 }) == sqlTrue {
+				expired = append(expired, i)
+			}
+		}
+
+		t.rows = removeRows(t.rows, expired)
+		purged = int64(len(expired))
+		return nil
+	})
+	return purged, err
+}
+
+// Get implements `Get()` from Repository interface
+func (r *MemoryRepository[T]) Get(ctx context.Context, qf QueryFilter, p *Projection) (*T, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	err := r.lock(qf.Lock)
+	if err != nil {
+		return nil, err
+	}
+
+	// Like GORM's First, the primary key breaks ties
+	terms := []string{qf.OrderBy}
+	for _, field := range r.schema.PrimaryFields {
+		terms = append(terms, field.DBName)
+	}
+	qf.OrderBy, qf.Limit = strings.Join(terms, ","), 1
+
+	entities, err := r.find(ctx, qf, p, scopeLive)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return new(T), classifyError(gorm.ErrRecordNotFound)
+	}
+	return &entities[0], nil
+}
+
+// List implements `List()` from Repository interface
+func (r *MemoryRepository[T]) List(ctx context.Context, qf QueryFilter, p *Projection) ([]T, error) {
+	err := r.lock(qf.Lock)
+	if err != nil {
+		return nil, err
+	}
+	return r.find(ctx, qf, p, scopeLive)
+}
+
+// ListPage implements `ListPage()` from Repository interface
+func (r *MemoryRepository[T]) ListPage(ctx context.Context, qf QueryFilter, p *Projection) (*Page[T], error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	req, err := newPageRequest(r.schema, qf, r.opts.cursorKey)
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := r.readKeyset(ctx, qf, p, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(ctx, r.opts.cursorKey, req, entities)
+}
+
+// readKeyset reads the entities of a keyset request, sorted in its direction and over-fetched
+// by one to tell whether there are more
+func (r *MemoryRepository[T]) readKeyset(ctx context.Context, qf QueryFilter, p *Projection, req *pageRequest) ([]T, error) {
+	err := r.lock(qf.Lock)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ordering, limits and offsets are owned by the keyset
+	qf.OrderBy, qf.Limit, qf.Cursor = "", 0, ""
+
+	f := newMemoryFilter(ctx, r.schema)
+	err = f.supported(qf, p)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := f.projection(qf.Pluck, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var entities []T
+	err = r.read(ctx, func(rows []T) error {
+		matched, err := r.match(f, rows, qf, scopeLive)
+		if err != nil {
+			return err
+		}
+
+		for _, i := range matched {
+			if req.after == nil || f.keyset(reflect.ValueOf(&rows[i]).Elem(), req) == sqlTrue {
+				entities = append(entities, rows[i])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]memoryOrder, len(req.keys))
+	for i, key := range req.keys {
+		order[i] = memoryOrder{field: key.field, desc: key.desc != req.backward}
+	}
+	r.sort(f, entities, order)
+	if len(entities) > req.size+1 {
+		entities = entities[:req.size+1]
+	}
+
+	return r.project(f, entities, columns), nil
+}
+
+// ForEach implements `ForEach()` from Repository interface
+func (r *MemoryRepository[T]) ForEach(ctx context.Context, qf QueryFilter, batchSize int, fn func(entity *T) error) error {
+	if r.err != nil {
+		return r.err
+	}
+	return forEach(ctx, r.schema, r.opts.cursorKey, r.readKeyset, qf, batchSize, fn)
+}
+
+// Stream implements `Stream()` from Repository interface, the entities are read up front
+func (r *MemoryRepository[T]) Stream(ctx context.Context, qf QueryFilter, p *Projection) (*Stream[T], error) {
+	if len(qf.Preload) > 0 {
+		return nil, fmt.Errorf("%w: associations can not be preloaded while streaming", ErrInvalidFilter)
+	}
+
+	entities, err := r.List(ctx, qf, p)
+	if err != nil {
+		return nil, err
+	}
+	return &Stream[T]{ctx: ctx, items: entities}, nil
+}
+
+// Batch implements `Batch()` from Repository interface
+func (r *MemoryRepository[T]) Batch(ctx context.Context, columnName string, ids []any) ([]T, error) {
+	return r.find(ctx, QueryFilter{Where: compareExpr{op: "in", column: columnName, values: ids}}, nil, scopeLive)
+}
+
+// Count implements `Count()` from Repository interface
+func (r *MemoryRepository[T]) Count(ctx context.Context, qf QueryFilter) (int64, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	f := newMemoryFilter(ctx, r.schema)
+	err := f.supported(qf, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = r.read(ctx, func(rows []T) error {
+		matched, err := r.match(f, rows, qf, scopeLive)
+		count = int64(len(matched))
+		return err
+	})
+	return count, err
+}
+
+// Exists implements `Exists()` from Repository interface
+func (r *MemoryRepository[T]) Exists(ctx context.Context, qf QueryFilter) (bool, error) {
+	count, err := r.Count(ctx, qf)
+	return count > 0, err
+}
+
+// All implements `All()` from Repository interface
+func (r *MemoryRepository[T]) All(ctx context.Context) ([]T, error) {
+	return r.find(ctx, QueryFilter{}, nil, scopeLive)
+}
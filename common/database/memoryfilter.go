@@ -0,0 +1,634 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// sqlBool is a truth value of SQL's three-valued logic, comparisons involving NULL are unknown
+type sqlBool int8
+
+const (
+	sqlFalse sqlBool = iota
+	sqlTrue
+	sqlUnknown
+)
+
+func boolOf(b bool) sqlBool {
+	if b {
+		return sqlTrue
+	}
+	return sqlFalse
+}
+
+func (a sqlBool) and(b sqlBool) sqlBool {
+	switch {
+	case a == sqlFalse || b == sqlFalse:
+		return sqlFalse
+	case a == sqlUnknown || b == sqlUnknown:
+		return sqlUnknown
+	default:
+		return sqlTrue
+	}
+}
+
+func (a sqlBool) or(b sqlBool) sqlBool {
+	switch {
+	case a == sqlTrue || b == sqlTrue:
+		return sqlTrue
+	case a == sqlUnknown || b == sqlUnknown:
+		return sqlUnknown
+	default:
+		return sqlFalse
+	}
+}
+
+func (a sqlBool) not() sqlBool {
+	switch a {
+	case sqlTrue:
+		return sqlFalse
+	case sqlFalse:
+		return sqlTrue
+	default:
+		return sqlUnknown
+	}
+}
+
+// memoryUnsupported returns the error for a filter that can only be run by a database
+func memoryUnsupported(filter string) error {
+	return fmt.Errorf("%w: %s is not supported in memory", ErrUnsupportedFilter, filter)
+}
+
+// memoryFilter evaluates query filters, orderings and projections against entities held
+// in memory, with the semantics they have on SQLite
+type memoryFilter struct {
+	ctx     context.Context
+	b       *exprBuilder
+	regexps map[string]*regexp.Regexp
+}
+
+func newMemoryFilter(ctx context.Context, sch *schema.Schema) *memoryFilter {
+	return &memoryFilter{
+		ctx:     ctx,
+		b:       newExprBuilder(sch, ""),
+		regexps: make(map[string]*regexp.Regexp),
+	}
+}
+
+// supported rejects the parts of a query filter or projection that need a database
+func (f *memoryFilter) supported(qf QueryFilter, p *Projection) error {
+	switch {
+	case len(qf.Joins) > 0:
+		return memoryUnsupported("joining tables")
+	case qf.GroupBy != "" || len(qf.HavingMap) > 0 || qf.HavingQuery != "":
+		return memoryUnsupported("grouping")
+	case qf.Distinct:
+		return memoryUnsupported("distinct")
+	case len(qf.Preload) > 0:
+		return memoryUnsupported("preloading associations")
+	case p != nil && (len(p.Aggregates) > 0 || len(p.Buckets) > 0 || len(p.Conditionals) > 0 || len(p.Subqueries) > 0 || len(p.Ranks) > 0):
+		return memoryUnsupported("computed projections")
+	}
+
+	// Validate the where conditions against a zero entity, so that invalid filters
+	// fail whether or not there are entities to match
+	_, _, err := f.where(qf, reflect.New(f.b.schema.ModelType).Elem())
+	return err
+}
+
+// field resolves a column reference the way the filters of SQLHandler do
+func (f *memoryFilter) field(name string) (*schema.Field, error) {
+	column, err := f.b.column(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.b.schema.LookUpField(column.Name), nil
+}
+
+// value returns the value of the field of the entity as it would be stored, nil for NULL
+func (f *memoryFilter) value(field *schema.Field, rv reflect.Value) any {
+	value, _ := field.ValueOf(f.ctx, rv)
+	return sqlValue(value)
+}
+
+// where evaluates the where conditions of a query filter, the same way whereExpression
+// builds them. It returns false when the filter has no conditions.
+func (f *memoryFilter) where(qf QueryFilter, rv reflect.Value) (sqlBool, bool, error) {
+	if qf.WhereQuery != "" {
+		return sqlFalse, false, memoryUnsupported("custom where clauses")
+	}
+
+	result, present := sqlTrue, false
+	add := func(v sqlBool) {
+		result, present = result.and(v), true
+	}
+
+	for _, key := range sortedKeys(qf.WhereMap) {
+		v, _, err := f.eval(Eq(key, qf.WhereMap[key]), rv)
+		if err != nil {
+			return sqlFalse, false, err
+		}
+		add(v)
+	}
+
+	for _, key := range sortedKeys(qf.RegexFilter) {
+		v, _, err := f.eval(Regex(key, qf.RegexFilter[key]), rv)
+		if err != nil {
+			return sqlFalse, false, err
+		}
+		add(v)
+	}
+
+	v, ok, err := f.eval(qf.Where, rv)
+	if err != nil {
+		return sqlFalse, false, err
+	}
+	if ok {
+		add(v)
+	}
+
+	for _, or := range qf.Or {
+		v, ok, err := f.where(or, rv)
+		if err != nil {
+			return sqlFalse, false, err
+		}
+		if !ok {
+			continue
+		}
+		if present {
+			result = result.or(v)
+		} else {
+			result, present = v, true
+		}
+	}
+
+	return result, present, nil
+}
+
+// eval evaluates a filter expression, it returns false for expressions without
+// conditions, which are left out of the query
+func (f *memoryFilter) eval(e Expr, rv reflect.Value) (sqlBool, bool, error) {
+	switch e := e.(type) {
+	case nil:
+		return sqlFalse, false, nil
+	case groupExpr:
+		result, present := sqlFalse, false
+		for _, expr := range e.exprs {
+			v, ok, err := f.eval(expr, rv)
+			if err != nil {
+				return sqlFalse, false, err
+			}
+			switch {
+			case !ok:
+			case !present:
+				result, present = v, true
+			case e.or:
+				result = result.or(v)
+			default:
+				result = result.and(v)
+			}
+		}
+		return result, present, nil
+	case notExpr:
+		v, ok, err := f.eval(e.expr, rv)
+		return v.not(), ok, err
+	case compareExpr:
+		v, err := f.compare(e, rv)
+		return v, err == nil, err
+	case matchExpr:
+		v, err := f.match(e, rv)
+		return v, err == nil, err
+	case searchExpr:
+		v, err := f.search(e, rv)
+		return v, err == nil, err
+	default:
+		return sqlFalse, false, memoryUnsupported(fmt.Sprintf("expression %T", e))
+	}
+}
+
+func (f *memoryFilter) compare(c compareExpr, rv reflect.Value) (sqlBool, error) {
+	field, err := f.field(c.column)
+	if err != nil {
+		return sqlFalse, err
+	}
+	v := f.value(field, rv)
+
+	switch c.op {
+	case "eq":
+		return equal(v, c.values[0]), nil
+	case "ne":
+		return equal(v, c.values[0]).not(), nil
+	case "gt":
+		return compareWith(v, c.values[0], func(c int) bool { return c > 0 }), nil
+	case "gte":
+		return compareWith(v, c.values[0], func(c int) bool { return c >= 0 }), nil
+	case "lt":
+		return compareWith(v, c.values[0], func(c int) bool { return c < 0 }), nil
+	case "lte":
+		return compareWith(v, c.values[0], func(c int) bool { return c <= 0 }), nil
+	case "in":
+		return in(v, c.values), nil
+	case "not_in":
+		if len(c.values) == 0 {
+			return sqlTrue, nil
+		}
+		return in(v, c.values).not(), nil
+	case "between":
+		return compareWith(v, c.values[0], func(c int) bool { return c >= 0 }).
+			and(compareWith(v, c.values[1], func(c int) bool { return c <= 0 })), nil
+	case "like":
+		// A plain LIKE ignores the case of ASCII letters on SQLite
+		pattern, _ := c.values[0].(string)
+		return f.like(v, pattern, 0, true)
+	case "null":
+		return boolOf(v == nil), nil
+	default:
+		return sqlFalse, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, c.op)
+	}
+}
+
+func (f *memoryFilter) match(m matchExpr, rv reflect.Value) (sqlBool, error) {
+	field, err := f.field(m.column)
+	if err != nil {
+		return sqlFalse, err
+	}
+	v := f.value(field, rv)
+
+	switch m.kind {
+	case "regex":
+		pattern := m.value
+		if m.fold {
+			pattern = "(?i)" + pattern
+		}
+		re, err := f.regexp(pattern)
+		if err != nil || v == nil {
+			return sqlUnknown, err
+		}
+		return boolOf(re.MatchString(text(v))), nil
+	case "like":
+		return f.like(v, m.value, []rune(likeEscape)[0], m.fold)
+	case "equal":
+		if v == nil {
+			return sqlUnknown, nil
+		}
+		return boolOf(strings.ToLower(text(v)) == strings.ToLower(m.value)), nil
+	default:
+		return sqlFalse, fmt.Errorf("%w: unknown match %q", ErrInvalidFilter, m.kind)
+	}
+}
+
+// search evaluates a search the way the LIKE fallback of the dialects does
+func (f *memoryFilter) search(s searchExpr, rv reflect.Value) (sqlBool, error) {
+	columns, terms, err := f.b.search(s.query, s.columns)
+	if err != nil {
+		return sqlFalse, err
+	}
+
+	result := sqlTrue
+	for _, term := range terms {
+		found := sqlFalse
+		for _, column := range columns {
+			v := f.value(f.b.schema.LookUpField(column.Name), rv)
+			match, err := f.like(v, "%"+escapeLike(term)+"%", []rune(likeEscape)[0], true)
+			if err != nil {
+				return sqlFalse, err
+			}
+			found = found.or(match)
+		}
+		result = result.and(found)
+	}
+	return result, nil
+}
+
+// like matches v against a LIKE pattern, whose wildcards can be escaped with escape (if not 0)
+func (f *memoryFilter) like(v any, pattern string, escape rune, fold bool) (sqlBool, error) {
+	var b strings.Builder
+	b.WriteString("(?s)")
+	if fold {
+		b.WriteString("(?i)")
+	}
+	b.WriteByte('^')
+
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		case escape != 0 && r == escape:
+			escaped = true
+		case r == '%':
+			b.WriteString(".*")
+		case r == '_':
+			b.WriteByte('.')
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteByte('$')
+
+	re, err := f.regexp(b.String())
+	if err != nil || v == nil {
+		return sqlUnknown, err
+	}
+	return boolOf(re.MatchString(text(v))), nil
+}
+
+// regexp compiles the pattern once per filter
+func (f *memoryFilter) regexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := f.regexps[pattern]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	f.regexps[pattern] = re
+	return re, nil
+}
+
+// keyset evaluates the keyset condition of a page request, see keysetCondition
+func (f *memoryFilter) keyset(rv reflect.Value, req *pageRequest) sqlBool {
+	result := sqlFalse
+	for i, key := range req.keys {
+		term := sqlTrue
+		for j := 0; j < i; j++ {
+			term = term.and(equal(f.value(req.keys[j].field, rv), req.after[j]))
+		}
+
+		v := f.value(key.field, rv)
+		if key.desc != req.backward {
+			term = term.and(compareWith(v, req.after[i], func(c int) bool { return c < 0 }))
+		} else {
+			term = term.and(compareWith(v, req.after[i], func(c int) bool { return c > 0 }))
+		}
+		result = result.or(term)
+	}
+	return result
+}
+
+// memoryOrder is a column of an ordering
+type memoryOrder struct {
+	field *schema.Field
+	desc  bool
+}
+
+// order resolves an ORDER BY expression the way applyOrderBy does
+func (f *memoryFilter) order(orderBy string) ([]memoryOrder, error) {
+	columns, err := orderByColumns(f.b, orderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]memoryOrder, len(columns))
+	for i, column := range columns {
+		order[i] = memoryOrder{field: f.b.schema.LookUpField(column.Column.Name), desc: column.Desc}
+	}
+	return order, nil
+}
+
+// compareRows compares two entities by the columns of an ordering, NULLs come first
+// in ascending order as on SQLite
+func (f *memoryFilter) compareRows(a, b reflect.Value, order []memoryOrder) int {
+	for _, o := range order {
+		va, vb := f.value(o.field, a), f.value(o.field, b)
+
+		var c int
+		switch {
+		case va == nil && vb == nil:
+		case va == nil:
+			c = -1
+		case vb == nil:
+			c = 1
+		default:
+			c = compareValues(va, vb)
+		}
+
+		if c != 0 {
+			if o.desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+// projection resolves the columns read by a query, as selected by its projection or
+// plucked column, it returns nil when all of them are read
+func (f *memoryFilter) projection(pluck string, p *Projection) ([]*schema.Field, error) {
+	var names []string
+	if pluck != "" {
+		names = []string{pluck}
+	}
+	if p != nil && len(p.Fields) > 0 {
+		names = p.Fields
+	}
+
+	var fields []*schema.Field
+	for _, name := range names {
+		field, err := f.field(name)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+
+	if p == nil || len(p.Exclude) == 0 {
+		return fields, nil
+	}
+
+	if fields == nil {
+		for _, field := range f.b.schema.Fields {
+			if field.DBName != "" {
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	// Like GORM, excluded names that are not fields of the model are ignored
+	excluded := make(map[*schema.Field]bool)
+	for _, name := range p.Exclude {
+		if field := f.b.schema.LookUpField(name); field != nil {
+			excluded[field] = true
+		}
+	}
+
+	selected := make([]*schema.Field, 0, len(fields))
+	for _, field := range fields {
+		if !excluded[field] {
+			selected = append(selected, field)
+		}
+	}
+	return selected, nil
+}
+
+// sqlValue returns a value the way it is stored by a database: NULL (nil) for nil pointers,
+// the value of driver.Valuer implementations, and a single type per kind of scalar
+// (int64, uint64, float64, string and time.Time) with booleans stored as integers
+func sqlValue(value any) any {
+	for {
+		switch v := value.(type) {
+		case nil:
+			return nil
+		case time.Time:
+			return v
+		case []byte:
+			return string(v)
+		case clause.Expression:
+			return v
+		case driver.Valuer:
+			rv := reflect.ValueOf(v)
+			if rv.Kind() == reflect.Pointer && rv.IsNil() {
+				return nil
+			}
+			dv, err := v.Value()
+			if err != nil {
+				return nil
+			}
+			value = dv
+			continue
+		}
+
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Pointer:
+			if rv.IsNil() {
+				return nil
+			}
+			value = rv.Elem().Interface()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return rv.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return rv.Uint()
+		case reflect.Float32, reflect.Float64:
+			return rv.Float()
+		case reflect.Bool:
+			if rv.Bool() {
+				return int64(1)
+			}
+			return int64(0)
+		case reflect.String:
+			return rv.String()
+		default:
+			return value
+		}
+	}
+}
+
+// equal evaluates column = value, which is IS NULL for a nil value and IN for a slice
+// of values, as in clause.Eq
+func equal(v, value any) sqlBool {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		return in(v, flattenValues([]any{value}))
+	}
+
+	value = sqlValue(value)
+	if value == nil {
+		return boolOf(v == nil)
+	}
+	return compareWith(v, value, func(c int) bool { return c == 0 })
+}
+
+// in evaluates column IN (values...)
+func in(v any, values []any) sqlBool {
+	result := sqlFalse
+	if len(values) == 0 {
+		// An empty list is written IN (NULL)
+		result = sqlUnknown
+	}
+	for _, value := range values {
+		result = result.or(compareWith(v, value, func(c int) bool { return c == 0 }))
+	}
+	return result
+}
+
+// compareWith compares a stored value to a query argument, it is unknown if either is NULL
+func compareWith(v, value any, pred func(c int) bool) sqlBool {
+	value = sqlValue(value)
+	if v == nil || value == nil {
+		return sqlUnknown
+	}
+	return boolOf(pred(compareValues(v, value)))
+}
+
+// compareValues orders two non NULL values returned by sqlValue. Numbers of any type are
+// compared by value, values of different kinds are ordered by kind as on SQLite.
+func compareValues(a, b any) int {
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return cmp.Compare(x, y)
+		case uint64:
+			if x < 0 {
+				return -1
+			}
+			return cmp.Compare(uint64(x), y)
+		case float64:
+			return cmp.Compare(float64(x), y)
+		}
+	case uint64:
+		switch y := b.(type) {
+		case int64:
+			return -compareValues(y, x)
+		case uint64:
+			return cmp.Compare(x, y)
+		case float64:
+			return cmp.Compare(float64(x), y)
+		}
+	case float64:
+		switch y := b.(type) {
+		case int64, uint64:
+			return -compareValues(y, x)
+		case float64:
+			return cmp.Compare(x, y)
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	}
+
+	if c := cmp.Compare(valueClass(a), valueClass(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(text(a), text(b))
+}
+
+// valueClass ranks the kinds of values, numbers sort before text
+func valueClass(v any) int {
+	switch v.(type) {
+	case int64, uint64, float64:
+		return 0
+	case string:
+		return 1
+	case time.Time:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// text returns the textual form of a value matched against a pattern
+func text(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,133 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+)
+
+var ErrUsage = errors.New("usage: migrate up [N] | down [N] | status | redo | create NAME")
+
+// Command runs a migrate subcommand as exposed by the service binaries:
+//
+//	up [N]       apply all (or the next N) pending migrations
+//	down [N]     roll back the last (or the last N) applied migrations
+//	status       list the migrations and whether they are applied
+//	redo         roll back and re-apply the last applied migration
+//	create NAME  write the scripts of a new migration in dir
+//
+// source holds the migrations to apply, usually embedded in the binary, while dir is
+// the directory new migrations are created in. create does not connect to the database.
+func Command(ctx context.Context, args []string, source fs.FS, dir string, connect func() (database.SQLDatabase, error), out io.Writer) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return ErrUsage
+		}
+		paths, err := Create(dir, args[1])
+		for _, path := range paths {
+			fmt.Fprintf(out, "created %s\n", path)
+		}
+		return err
+	}
+
+	n, err := countArg(args)
+	if err != nil {
+		return err
+	}
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Disconnect(); err != nil {
+			fmt.Fprintf(out, "failed to disconnect: %v\n", err)
+		}
+	}()
+
+	m, err := New(db.Instance(), source)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx, n)
+		printMigrations(out, "applied", applied)
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return err
+	case "down":
+		reverted, err := m.Down(ctx, n)
+		printMigrations(out, "reverted", reverted)
+		return err
+	case "redo":
+		redone, err := m.Redo(ctx)
+		if redone != nil {
+			printMigrations(out, "redone", []Migration{*redone})
+		}
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(out, statuses)
+		return nil
+	default:
+		return ErrUsage
+	}
+}
+
+// countArg parses the optional migration count of up and down
+func countArg(args []string) (int, error) {
+	switch {
+	case len(args) == 1:
+		return 0, nil
+	case len(args) == 2 && (args[0] == "up" || args[0] == "down"):
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("%w: invalid count %q", ErrUsage, args[1])
+		}
+		return n, nil
+	default:
+		return 0, ErrUsage
+	}
+}
+
+func printMigrations(out io.Writer, action string, migrations []Migration) {
+	for _, m := range migrations {
+		fmt.Fprintf(out, "%s %s\n", action, m)
+	}
+}
+
+func printStatus(out io.Writer, statuses []Status) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		state, appliedAt := "pending", ""
+		if s.Applied {
+			state, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+		}
+		switch {
+		case s.Missing:
+			state = "missing"
+		case s.Modified:
+			state = "modified"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Migration, state, appliedAt)
+	}
+	w.Flush()
+}
@@ -0,0 +1,62 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// nameRegex matches the characters that are not allowed in migration names
+var nameRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Create writes an empty up and down script for a new migration in dir, numbered
+// after the highest version found there. It returns the paths of the created files.
+func Create(dir, name string) ([]string, error) {
+	name = strings.Trim(nameRegex.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, fmt.Errorf("migrate: invalid migration name")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read %q: %w", dir, err)
+	}
+
+	var last uint64
+	for _, entry := range entries {
+		match := fileRegex.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err == nil && version > last {
+			last = version
+		}
+	}
+
+	migration := Migration{Version: last + 1, Name: name}
+	var paths []string
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, fmt.Sprintf("%s.%s.sql", migration, direction))
+		content := fmt.Sprintf("-- %s: %s\n", direction, migration)
+
+		// O_EXCL keeps concurrent invocations from overwriting each other
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return paths, fmt.Errorf("migrate: create %q: %w", path, err)
+		}
+		_, err = file.WriteString(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return paths, fmt.Errorf("migrate: write %q: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
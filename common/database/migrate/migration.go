@@ -0,0 +1,268 @@
+// Package migrate applies versioned SQL schema migrations. Migrations are read from
+// files named <version>_<name>.up.sql and <version>_<name>.down.sql, optionally
+// suffixed with a dialect (<version>_<name>.up.postgres.sql) to override the generic
+// file on that driver. Applied migrations are recorded, with the checksum of their up
+// script, in the schema_migrations table.
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// fileRegex matches migration file names, e.g. 0001_create_users.up.sql or 0001_create_users.up.mysql.sql
+var fileRegex = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)(?:\.([a-z]+))?\.sql$`)
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version  uint64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Load reads the migrations in the root of source, preferring the files written for
+// the given dialect over the generic ones. Migrations are returned ordered by version.
+// It fails with ErrUnsupportedDialect if a migration only has scripts for other dialects.
+func Load(source fs.FS, dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read source: %w", err)
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	specific := make(map[string]bool)
+
+	// other holds the migrations written for other dialects only, which can not be applied
+	other := make(map[uint64]Migration)
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		match := fileRegex.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrate: invalid migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: invalid version in %q: %w", entry.Name(), err)
+		}
+
+		fileDialect := match[4]
+		if fileDialect != "" && fileDialect != dialect {
+			if _, ok := other[version]; !ok {
+				other[version] = Migration{Version: version, Name: match[2]}
+			}
+			continue
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d is used by both %q and %q", version, m.Name, match[2])
+		}
+
+		// A dialect specific script always wins over the generic one
+		key := fmt.Sprintf("%d.%s", version, match[3])
+		if fileDialect == "" && specific[key] {
+			continue
+		}
+		if fileDialect != "" {
+			specific[key] = true
+		}
+
+		content, err := fs.ReadFile(source, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrate: read %q: %w", entry.Name(), err)
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	var unsupported []Migration
+	for version, m := range other {
+		if _, ok := byVersion[version]; !ok {
+			unsupported = append(unsupported, m)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Slice(unsupported, func(i, j int) bool {
+			return unsupported[i].Version < unsupported[j].Version
+		})
+		return nil, fmt.Errorf("%w: %s has no script for %q", ErrUnsupportedDialect, unsupported[0], dialect)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("migrate: migration %d_%s has no up script", m.Version, m.Name)
+		}
+		m.Checksum = checksum(m.Up)
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// String returns the file name prefix of the migration
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// checksum returns the hex encoded SHA-256 of a script
+func checksum(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitStatements splits a script in its statements on the semicolons ending them. The
+// semicolons within string literals, quoted identifiers, comments, dollar quoted bodies
+// (of postgres functions and DO blocks) and BEGIN ... END blocks are kept in their statement.
+func splitStatements(script string) []string {
+	var statements []string
+	start, depth := 0, 0
+	flush := func(end int) {
+		statement := strings.TrimSpace(script[start:end])
+		if statement != "" && !isComment(statement) {
+			statements = append(statements, statement)
+		}
+	}
+
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(script, i)
+		case strings.HasPrefix(script[i:], "--"):
+			i = skipPast(script, i, "\n")
+		case strings.HasPrefix(script[i:], "/*"):
+			i = skipPast(script, i+2, "*/")
+		case c == '$' && dollarTag(script[i:]) != "":
+			tag := dollarTag(script[i:])
+			i = skipPast(script, i+len(tag), tag)
+		case isWordByte(c):
+			end := i
+			for end < len(script) && isWordByte(script[end]) {
+				end++
+			}
+			next := strings.ToUpper(nextWord(script[end:]))
+			switch word := strings.ToUpper(script[i:end]); {
+			case word == "BEGIN" && !beginsTransaction[next]:
+				depth++
+			case word == "CASE":
+				depth++
+			case word == "END" && depth > 0 && !endsControlBlock[next]:
+				depth--
+			}
+			i = end
+		case c == ';' && depth == 0:
+			flush(i)
+			i++
+			start = i
+		default:
+			i++
+		}
+	}
+	flush(len(script))
+
+	return statements
+}
+
+// beginsTransaction holds the words after a BEGIN starting a transaction rather than a
+// block, the empty word being the end of the statement
+var beginsTransaction = map[string]bool{
+	"": true, "TRANSACTION": true, "TRAN": true, "WORK": true, "ISOLATION": true,
+	"DEFERRED": true, "IMMEDIATE": true, "EXCLUSIVE": true,
+}
+
+// endsControlBlock holds the words after an END closing a control block of MySQL, whose
+// start is not counted as a block
+var endsControlBlock = map[string]bool{"IF": true, "LOOP": true, "WHILE": true, "REPEAT": true}
+
+// skipQuoted returns the index after the quoted string or identifier starting at i, a
+// doubled quote being an escaped one
+func skipQuoted(script string, i int) int {
+	quote := script[i]
+	for i++; i < len(script); i++ {
+		if script[i] != quote {
+			continue
+		}
+		if i+1 < len(script) && script[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return i
+}
+
+// skipPast returns the index after the first end found from i, the end of the script
+// when there is none
+func skipPast(script string, i int, end string) int {
+	n := strings.Index(script[i:], end)
+	if n < 0 {
+		return len(script)
+	}
+	return i + n + len(end)
+}
+
+// dollarTag returns the postgres dollar quote tag, such as $$ or $body$, s starts with
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$':
+			return s[:i+1]
+		case c == '_' || unicode.IsLetter(rune(c)) || i > 1 && unicode.IsDigit(rune(c)):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// nextWord returns the word s starts with after spaces, empty when s continues with
+// anything else
+func nextWord(s string) string {
+	s = strings.TrimLeftFunc(s, unicode.IsSpace)
+	end := 0
+	for end < len(s) && isWordByte(s[end]) {
+		end++
+	}
+	return s[:end]
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// isComment reports if the statement only consists of line comments
+func isComment(statement string) bool {
+	for _, line := range strings.Split(statement, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,438 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"k8s.io/klog/v2"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("migrate: applied migration was modified")
+	ErrMissingMigration = errors.New("migrate: applied migration is missing from source")
+	ErrIrreversible     = errors.New("migrate: migration has no down script")
+	ErrLockTimeout      = errors.New("migrate: timed out waiting for the migration lock")
+
+	// ErrLockLost is returned when the lease of the migration lock could not be kept, the
+	// migrations being applied are then cancelled as another replica may have taken over
+	ErrLockLost = errors.New("migrate: lost the migration lock")
+
+	// ErrUnsupportedDialect is returned when a migration has no script for the dialect of the database
+	ErrUnsupportedDialect = errors.New("migrate: migration not available for dialect")
+)
+
+const (
+	lockID = 1
+
+	defaultLockTimeout  = 5 * time.Minute
+	defaultLeaseTimeout = 15 * time.Minute
+	lockPollInterval    = time.Second
+)
+
+// schemaMigration is a row of the migrations table
+type schemaMigration struct {
+	Version   uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// migrationLock is the single row lock serializing migrations of concurrent replicas.
+// LockedAt is NULL while the lock is free, as MySQL rejects zero dates in strict mode.
+type migrationLock struct {
+	ID       uint `gorm:"primaryKey;autoIncrement:false"`
+	LockedBy string
+	LockedAt *time.Time
+}
+
+func (migrationLock) TableName() string {
+	return "schema_migrations_lock"
+}
+
+// Status describes the state of a single migration
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+
+	// Modified is set when the applied checksum differs from the source
+	Modified bool
+
+	// Missing is set when the migration is applied but no longer in the source
+	Missing bool
+}
+
+// Migrator applies the migrations of a source onto a database
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+	owner      string
+
+	// LockTimeout bounds the time spent waiting for another replica's migration
+	LockTimeout time.Duration
+
+	// LeaseTimeout is the age after which a lock is considered abandoned (e.g. by
+	// a crashed replica) and taken over. The holder renews the lock every third of
+	// it, so that long migrations keep it.
+	LeaseTimeout time.Duration
+}
+
+// New returns a Migrator for the migrations in source, loaded for the dialect of db
+func New(db *gorm.DB, source fs.FS) (*Migrator, error) {
+	migrations, err := Load(source, db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	return &Migrator{
+		db:           db,
+		migrations:   migrations,
+		owner:        fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano()),
+		LockTimeout:  defaultLockTimeout,
+		LeaseTimeout: defaultLeaseTimeout,
+	}, nil
+}
+
+// Up applies up to n pending migrations (all of them when n <= 0) and returns the applied ones
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		var err error
+		applied, err = m.up(ctx, n)
+		return err
+	})
+	return applied, err
+}
+
+// Down rolls back the last n applied migrations (the last one when n <= 0) and returns them
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		var err error
+		reverted, err = m.down(ctx, n)
+		return err
+	})
+	return reverted, err
+}
+
+// Redo rolls back the last applied migration and applies it again
+func (m *Migrator) Redo(ctx context.Context) (*Migration, error) {
+	var redone *Migration
+	err := m.withLock(ctx, func(ctx context.Context) error {
+		reverted, err := m.down(ctx, 1)
+		if err != nil || len(reverted) == 0 {
+			return err
+		}
+
+		_, err = m.up(ctx, 1)
+		redone = &reverted[0]
+		return err
+	})
+	return redone, err
+}
+
+// Status returns the state of every known migration, ordered by version
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	err := m.ensureTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+			status.Modified = record.Checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, record := range applied {
+		statuses = append(statuses, Status{
+			Migration: Migration{Version: record.Version, Name: record.Name, Checksum: record.Checksum},
+			Applied:   true,
+			AppliedAt: record.AppliedAt,
+			Missing:   true,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+func (m *Migrator) up(ctx context.Context, n int) ([]Migration, error) {
+	applied, err := m.verified(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if n > 0 && len(done) == n {
+			break
+		}
+
+		err := m.conn(ctx).Transaction(func(tx *gorm.DB) error {
+			err := exec(tx, migration.Up)
+			if err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Checksum:  migration.Checksum,
+				AppliedAt: time.Now().UTC(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migrate: up %s: %w", migration, err)
+		}
+
+		klog.InfoS("migrate: applied", "migration", migration.String())
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+func (m *Migrator) down(ctx context.Context, n int) ([]Migration, error) {
+	if n <= 0 {
+		n = 1
+	}
+
+	applied, err := m.verified(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < n; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == "" {
+			return done, fmt.Errorf("%w: %s", ErrIrreversible, migration)
+		}
+
+		err := m.conn(ctx).Transaction(func(tx *gorm.DB) error {
+			err := exec(tx, migration.Down)
+			if err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migrate: down %s: %w", migration, err)
+		}
+
+		klog.InfoS("migrate: reverted", "migration", migration.String())
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// verified returns the applied migrations after making sure they match the source
+func (m *Migrator) verified(ctx context.Context) (map[uint64]schemaMigration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[uint64]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	for version, record := range applied {
+		migration, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %04d_%s", ErrMissingMigration, record.Version, record.Name)
+		}
+		if migration.Checksum != record.Checksum {
+			return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, migration)
+		}
+	}
+
+	return applied, nil
+}
+
+// applied returns the applied migrations keyed by version
+func (m *Migrator) applied(ctx context.Context) (map[uint64]schemaMigration, error) {
+	var records []schemaMigration
+	err := m.conn(ctx).Order("version").Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read applied migrations: %w", err)
+	}
+
+	applied := make(map[uint64]schemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// ensureTables creates the migrations and lock tables if they do not exist yet
+func (m *Migrator) ensureTables(ctx context.Context) error {
+	db := m.conn(ctx)
+
+	err := db.AutoMigrate(&schemaMigration{}, &migrationLock{})
+	if err != nil {
+		return fmt.Errorf("migrate: create migrations tables: %w", err)
+	}
+
+	err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&migrationLock{ID: lockID}).Error
+	if err != nil {
+		return fmt.Errorf("migrate: create migrations lock: %w", err)
+	}
+	return nil
+}
+
+// withLock runs fn while holding the migration lock, so that replicas starting at the
+// same time apply the migrations one after the other. The context of fn is cancelled when
+// the lease of the lock is lost, withLock then fails with ErrLockLost.
+func (m *Migrator) withLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := m.ensureTables(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = m.lock(ctx)
+	if err != nil {
+		return err
+	}
+
+	fnCtx, lose := context.WithCancelCause(ctx)
+	defer lose(nil)
+
+	renewCtx, stopRenewing := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		if err := m.renew(renewCtx); err != nil {
+			lose(err)
+		}
+	}()
+
+	defer func() {
+		stopRenewing()
+		<-renewed
+
+		// The lock is released even if ctx got cancelled in the meantime
+		err := m.conn(context.Background()).Model(&migrationLock{}).
+			Where("id = ? AND locked_by = ?", lockID, m.owner).
+			Updates(map[string]any{"locked_by": "", "locked_at": nil}).Error
+		if err != nil {
+			klog.ErrorS(err, "migrate: failed to release the migration lock")
+		}
+	}()
+
+	err = fn(fnCtx)
+	if cause := context.Cause(fnCtx); errors.Is(cause, ErrLockLost) {
+		return errors.Join(cause, err)
+	}
+	return err
+}
+
+// renew extends the lease of the held lock every third of LeaseTimeout until ctx is done.
+// It fails with ErrLockLost once another replica took the lock over, or when the lease
+// could not be renewed before it expired.
+func (m *Migrator) renew(ctx context.Context) error {
+	ticker := time.NewTicker(m.LeaseTimeout / 3)
+	defer ticker.Stop()
+
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		result := m.conn(ctx).Model(&migrationLock{}).
+			Where("id = ? AND locked_by = ?", lockID, m.owner).
+			Update("locked_at", now.UTC())
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case result.Error != nil && now.Sub(renewedAt) >= m.LeaseTimeout:
+			return fmt.Errorf("%w: lease expired: %w", ErrLockLost, result.Error)
+		case result.Error != nil:
+			klog.ErrorS(result.Error, "migrate: failed to renew the migration lock")
+		case result.RowsAffected == 0:
+			return fmt.Errorf("%w: taken over by another replica", ErrLockLost)
+		default:
+			renewedAt = now
+		}
+	}
+}
+
+func (m *Migrator) lock(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.LockTimeout)
+	defer cancel()
+
+	for {
+		now := time.Now().UTC()
+		result := m.conn(ctx).Model(&migrationLock{}).
+			Where("id = ? AND (locked_by = ? OR locked_at IS NULL OR locked_at < ?)", lockID, "", now.Add(-m.LeaseTimeout)).
+			Updates(map[string]any{"locked_by": m.owner, "locked_at": now})
+		if result.Error != nil && ctx.Err() == nil {
+			return fmt.Errorf("migrate: acquire migration lock: %w", result.Error)
+		}
+		if result.Error == nil && result.RowsAffected == 1 {
+			return nil
+		}
+
+		klog.InfoS("migrate: waiting for the migration lock")
+		select {
+		case <-ctx.Done():
+			return ErrLockTimeout
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// conn returns the database bound to ctx, schema changes and their bookkeeping
+// are always read from the primary
+func (m *Migrator) conn(ctx context.Context) *gorm.DB {
+	return m.db.WithContext(database.ReadYourWrites(ctx))
+}
+
+// exec runs every statement of the script
+func exec(tx *gorm.DB, script string) error {
+	for _, statement := range splitStatements(script) {
+		err := tx.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+)
+
+var testSource = fstest.MapFS{
+	"0001_create_things.up.sql":          {Data: []byte("CREATE TABLE things (id INTEGER PRIMARY KEY);")},
+	"0001_create_things.down.sql":        {Data: []byte("DROP TABLE things;")},
+	"0002_add_name.up.sql":               {Data: []byte("ALTER TABLE things ADD COLUMN name TEXT;")},
+	"0002_add_name.up.postgres.sql":      {Data: []byte("ALTER TABLE things ADD COLUMN name TEXT NOT NULL DEFAULT '';")},
+	"0002_add_name.down.sql":             {Data: []byte("ALTER TABLE things DROP COLUMN name;")},
+	"0003_index_name.up.postgres.sql":    {Data: []byte("CREATE INDEX CONCURRENTLY idx_things_name ON things (name);")},
+	"0003_index_name.down.postgres.sql":  {Data: []byte("DROP INDEX idx_things_name;")},
+	"0003_index_name.up.sqlserver.sql":   {Data: []byte("CREATE INDEX idx_things_name ON things (name);")},
+	"0003_index_name.down.sqlserver.sql": {Data: []byte("DROP INDEX idx_things_name ON things;")},
+}
+
+func TestLoadDialects(t *testing.T) {
+	migrations, err := Load(testSource, "postgres")
+	if err != nil {
+		t.Fatalf("load postgres: %v", err)
+	}
+	if len(migrations) != 3 || migrations[1].Up != string(testSource["0002_add_name.up.postgres.sql"].Data) {
+		t.Errorf("load postgres: got %+v", migrations)
+	}
+
+	_, err = Load(testSource, "mysql")
+	if !errors.Is(err, ErrUnsupportedDialect) {
+		t.Errorf("load mysql: got %v, want ErrUnsupportedDialect", err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "statements",
+			script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT); -- done\n",
+			want:   []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name:   "literals and comments",
+			script: "INSERT INTO a VALUES ('x;'';y', \"c;d\"); /* e; */ -- f;\nSELECT 1;",
+			want:   []string{"INSERT INTO a VALUES ('x;'';y', \"c;d\")", "/* e; */ -- f;\nSELECT 1"},
+		},
+		{
+			name: "dollar quoted function",
+			script: "CREATE FUNCTION f() RETURNS trigger AS $body$\nBEGIN\n  RAISE EXCEPTION 'no';\n  RETURN NULL;\nEND;\n$body$ LANGUAGE plpgsql;\n" +
+				"DO $$ BEGIN PERFORM 1; END $$;",
+			want: []string{
+				"CREATE FUNCTION f() RETURNS trigger AS $body$\nBEGIN\n  RAISE EXCEPTION 'no';\n  RETURN NULL;\nEND;\n$body$ LANGUAGE plpgsql",
+				"DO $$ BEGIN PERFORM 1; END $$",
+			},
+		},
+		{
+			name: "compound statement",
+			script: "CREATE TRIGGER t BEFORE UPDATE ON a FOR EACH ROW\nBEGIN\n  IF NEW.id < 0 THEN\n    SET NEW.id = CASE WHEN OLD.id > 0 THEN OLD.id ELSE 0 END;\n  END IF;\nEND;\n" +
+				"BEGIN;\nSELECT 1;",
+			want: []string{
+				"CREATE TRIGGER t BEFORE UPDATE ON a FOR EACH ROW\nBEGIN\n  IF NEW.id < 0 THEN\n    SET NEW.id = CASE WHEN OLD.id > 0 THEN OLD.id ELSE 0 END;\n  END IF;\nEND",
+				"BEGIN",
+				"SELECT 1",
+			},
+		},
+		{
+			name:   "positional parameters and comments only",
+			script: "-- nothing\n;\nPREPARE p AS SELECT $1;",
+			want:   []string{"PREPARE p AS SELECT $1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.New(t).Instance()
+
+	source := fstest.MapFS{}
+	for name, file := range testSource {
+		if name[:4] != "0003" {
+			source[name] = file
+		}
+	}
+	m, err := New(db, source)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	applied, err := m.Up(ctx, 0)
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("up: got %d migrations, %v", len(applied), err)
+	}
+	if err := db.Exec("INSERT INTO things (id, name) VALUES (1, 'a')").Error; err != nil {
+		t.Errorf("migrated table: %v", err)
+	}
+
+	var lock migrationLock
+	if err := db.First(&lock, lockID).Error; err != nil {
+		t.Fatalf("read lock: %v", err)
+	}
+	if lock.LockedBy != "" || lock.LockedAt != nil {
+		t.Errorf("released lock: got %q at %v", lock.LockedBy, lock.LockedAt)
+	}
+
+	reverted, err := m.Down(ctx, 2)
+	if err != nil || len(reverted) != 2 {
+		t.Fatalf("down: got %d migrations, %v", len(reverted), err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Applied {
+			t.Errorf("status after down: %s is applied", status.Migration)
+		}
+	}
+}
+
+func TestLockRenewal(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.New(t).Instance()
+
+	m, err := New(db, fstest.MapFS{})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	m.LeaseTimeout = 150 * time.Millisecond
+
+	lockedAt := func() time.Time {
+		var lock migrationLock
+		if err := db.First(&lock, lockID).Error; err != nil || lock.LockedAt == nil {
+			t.Fatalf("read held lock: %+v, %v", lock, err)
+		}
+		return *lock.LockedAt
+	}
+
+	err = m.withLock(ctx, func(ctx context.Context) error {
+		acquired := lockedAt()
+		time.Sleep(2 * m.LeaseTimeout)
+		if renewed := lockedAt(); !renewed.After(acquired) {
+			t.Errorf("lock acquired at %v was not renewed", acquired)
+		}
+
+		// A second replica must not take over a lock that is being renewed
+		other, err := New(db, fstest.MapFS{})
+		if err != nil {
+			return err
+		}
+		other.LeaseTimeout, other.LockTimeout = m.LeaseTimeout, 50*time.Millisecond
+		if err := other.lock(ctx); !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("lock held by another replica: got %v, want ErrLockTimeout", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("with lock: %v", err)
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.New(t).Instance()
+
+	m, err := New(db, fstest.MapFS{})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	m.LeaseTimeout = 150 * time.Millisecond
+
+	err = m.withLock(ctx, func(ctx context.Context) error {
+		// Another replica takes the lock over, as if this one had stalled past its lease
+		err := db.Model(&migrationLock{}).Where("id = ?", lockID).Update("locked_by", "other").Error
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * m.LeaseTimeout):
+			t.Error("migrations kept running after the lock was taken over")
+			return nil
+		}
+	})
+	if !errors.Is(err, ErrLockLost) {
+		t.Errorf("with a lost lock: got %v, want ErrLockLost", err)
+	}
+
+	var lock migrationLock
+	if err := db.First(&lock, lockID).Error; err != nil || lock.LockedBy != "other" {
+		t.Errorf("lock of the other replica: got %+v, %v", lock, err)
+	}
+}
@@ -0,0 +1,258 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+const (
+	instrumentationName = "github.com/swarit-pandey/e-commerce/common/database"
+
+	// observationKey holds the observation of a statement between its callbacks
+	observationKey = "database:observation"
+)
+
+// entityKey is the attribute holding the Go type of the model of a statement
+var entityKey = attribute.Key("db.entity")
+
+// Observability configures the tracing, metrics and slow statement log of a database,
+// see Instrument
+type Observability struct {
+	// TracerProvider and MeterProvider default to the global providers of otel
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+
+	// SlowThreshold logs the statements running for longer, zero disables the log.
+	// Arguments are redacted to their types, as they may hold personal data.
+	SlowThreshold time.Duration
+}
+
+// observer holds the instruments of an instrumented database
+type observer struct {
+	system        attribute.KeyValue
+	tracer        trace.Tracer
+	duration      metric.Float64Histogram
+	slowThreshold time.Duration
+}
+
+// observation is a statement being executed
+type observation struct {
+	start  time.Time
+	span   trace.Span
+	parent context.Context
+}
+
+// Instrument registers the callbacks of db observing its statements. Every statement gets
+// an OpenTelemetry client span holding its SQL (with placeholders, never arguments), table,
+// rows affected and error class, and its latency is recorded in the
+// db.client.operation.duration histogram per entity type and operation. Statements slower
+// than the SlowThreshold are logged. Connect instruments the database when
+// Config.Observability is set.
+func Instrument(db *gorm.DB, config Observability) error {
+	tracerProvider := config.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+	meterProvider := config.MeterProvider
+	if meterProvider == nil {
+		meterProvider = otel.GetMeterProvider()
+	}
+
+	duration, err := meterProvider.Meter(instrumentationName).Float64Histogram(
+		"db.client.operation.duration",
+		metric.WithDescription("Duration of database statements"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+	)
+	if err != nil {
+		return fmt.Errorf("database: create duration histogram: %w", err)
+	}
+
+	o := &observer{
+		system:        dbSystem(db.Dialector.Name()),
+		tracer:        tracerProvider.Tracer(instrumentationName),
+		duration:      duration,
+		slowThreshold: config.SlowThreshold,
+	}
+
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("*").Register("database:observe_start", o.start("create")),
+		cb.Create().After("*").Register("database:observe_end", o.end("create")),
+		cb.Query().Before("*").Register("database:observe_start", o.start("query")),
+		cb.Query().After("*").Register("database:observe_end", o.end("query")),
+		cb.Update().Before("*").Register("database:observe_start", o.start("update")),
+		cb.Update().After("*").Register("database:observe_end", o.end("update")),
+		cb.Delete().Before("*").Register("database:observe_start", o.start("delete")),
+		cb.Delete().After("*").Register("database:observe_end", o.end("delete")),
+		cb.Row().Before("*").Register("database:observe_start", o.start("row")),
+		cb.Row().After("*").Register("database:observe_end", o.end("row")),
+		cb.Raw().Before("*").Register("database:observe_start", o.start("raw")),
+		cb.Raw().After("*").Register("database:observe_end", o.end("raw")),
+	)
+}
+
+// dbSystem maps the name of a GORM dialector to the db.system attribute
+func dbSystem(dialector string) attribute.KeyValue {
+	switch dialector {
+	case "postgres":
+		return semconv.DBSystemPostgreSQL
+	case "mysql":
+		return semconv.DBSystemMySQL
+	case "sqlserver":
+		return semconv.DBSystemMSSQL
+	case "sqlite":
+		return semconv.DBSystemSqlite
+	default:
+		return semconv.DBSystemOtherSQL
+	}
+}
+
+func (o *observer) start(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		stmt := db.Statement
+		if stmt.DryRun {
+			return
+		}
+
+		parent := stmt.Context
+		if parent == nil {
+			parent = context.Background()
+		}
+		ctx, span := o.tracer.Start(parent, operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(o.system, semconv.DBOperationKey.String(operation)),
+		)
+
+		// The driver runs the statement under the span, the context is restored once
+		// it ended as GORM may reuse the statement for the next one
+		stmt.Context = ctx
+		stmt.Settings.Store(observationKey, &observation{start: time.Now(), span: span, parent: parent})
+	}
+}
+
+func (o *observer) end(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		stmt := db.Statement
+		value, ok := stmt.Settings.LoadAndDelete(observationKey)
+		if !ok {
+			return
+		}
+		obs := value.(*observation)
+		elapsed := time.Since(obs.start)
+		stmt.Context = obs.parent
+
+		entity := entityName(stmt)
+		class := errorClass(db.Error)
+		sql := stmt.SQL.String()
+
+		span := obs.span
+		if span.IsRecording() {
+			if stmt.Table != "" {
+				span.SetName(operation + " " + stmt.Table)
+			}
+			span.SetAttributes(
+				semconv.DBStatementKey.String(sql),
+				semconv.DBSQLTableKey.String(stmt.Table),
+				entityKey.String(entity),
+				attribute.Int64("db.rows_affected", db.RowsAffected),
+			)
+			if class != "" {
+				span.SetAttributes(semconv.ErrorTypeKey.String(class))
+				// Missing rows are a result rather than a failure of the statement
+				if class != "not_found" {
+					span.RecordError(db.Error)
+					span.SetStatus(codes.Error, class)
+				}
+			}
+		}
+		span.End()
+
+		attrs := []attribute.KeyValue{o.system, semconv.DBOperationKey.String(operation), entityKey.String(entity)}
+		if class != "" {
+			attrs = append(attrs, semconv.ErrorTypeKey.String(class))
+		}
+		o.duration.Record(obs.parent, elapsed.Seconds(), metric.WithAttributes(attrs...))
+
+		if o.slowThreshold > 0 && elapsed >= o.slowThreshold {
+			klog.InfoS("database: slow statement",
+				"operation", operation,
+				"entity", entity,
+				"table", stmt.Table,
+				"duration", elapsed,
+				"rows", db.RowsAffected,
+				"statement", sql,
+				"args", redactArgs(stmt.Vars),
+				"error", class,
+			)
+		}
+	}
+}
+
+// entityName returns the type of the model of a statement, or its table for statements
+// without a model
+func entityName(stmt *gorm.Statement) string {
+	if stmt.Schema != nil {
+		return stmt.Schema.Name
+	}
+	if stmt.Table != "" {
+		return stmt.Table
+	}
+	return "none"
+}
+
+// errorClass returns a low-cardinality name of the error of a statement, empty when the
+// statement succeeded
+func errorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	err = classifyError(err)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrUniqueViolation):
+		return "unique_violation"
+	case errors.Is(err, ErrForeignKeyViolation):
+		return "foreign_key_violation"
+	case errors.Is(err, ErrDeadlock):
+		return "deadlock"
+	case errors.Is(err, ErrSerialization):
+		return "serialization"
+	case errors.Is(err, ErrLockNotAvailable):
+		return "lock_not_available"
+	case errors.Is(err, ErrTimeout):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, gorm.ErrMissingWhereClause):
+		return "missing_where"
+	default:
+		return "other"
+	}
+}
+
+// redactArgs replaces the arguments of a statement by their types
+func redactArgs(vars []any) []string {
+	redacted := make([]string, len(vars))
+	for i, v := range vars {
+		if v == nil {
+			redacted[i] = "NULL"
+			continue
+		}
+		redacted[i] = fmt.Sprintf("%T", v)
+	}
+	return redacted
+}
@@ -0,0 +1,201 @@
+package database_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// observed returns a handler of records on a database instrumented with in-memory
+// exporters, and the recorded spans and metrics
+func observed(t *testing.T, slowThreshold time.Duration) (*database.SQLHandler[databasetest.Record], *gorm.DB, *tracetest.SpanRecorder, *sdkmetric.ManualReader) {
+	t.Helper()
+
+	spans := tracetest.NewSpanRecorder()
+	metrics := sdkmetric.NewManualReader()
+	db := databasetest.New(t, &databasetest.Record{}).Instance()
+	err := database.Instrument(db, database.Observability{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(metrics)),
+		SlowThreshold:  slowThreshold,
+	})
+	if err != nil {
+		t.Fatalf("instrument: %v", err)
+	}
+	return database.NewSQLHandler[databasetest.Record](db), db, spans, metrics
+}
+
+// slowLog captures the slow statements logged until the end of the test
+func slowLog(t *testing.T) *[]string {
+	var lines []string
+	klog.SetLogger(funcr.New(func(prefix, args string) {
+		if strings.Contains(args, "database: slow statement") {
+			lines = append(lines, args)
+		}
+	}, funcr.Options{}))
+	t.Cleanup(klog.ClearLogger)
+	return &lines
+}
+
+func attributes(kvs []attribute.KeyValue) map[attribute.Key]string {
+	m := make(map[attribute.Key]string, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value.Emit()
+	}
+	return m
+}
+
+func TestObservabilitySpans(t *testing.T) {
+	records, _, spans, _ := observed(t, 0)
+	ctx := context.Background()
+
+	if err := records.Create(ctx, &databasetest.Record{Name: "alpha"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	records.Create(ctx, &databasetest.Record{Name: "alpha"})
+	records.Get(ctx, database.QueryFilter{WhereMap: map[string]any{"name": "missing"}}, nil)
+
+	ended := spans.Ended()
+	if len(ended) != 3 {
+		t.Fatalf("got %d spans, want 3", len(ended))
+	}
+
+	created := ended[0]
+	attrs := attributes(created.Attributes())
+	switch {
+	case created.Name() != "create records":
+		t.Errorf("created span name: got %q", created.Name())
+	case attrs["db.system"] != "sqlite" || attrs["db.operation"] != "create" || attrs["db.entity"] != "Record":
+		t.Errorf("created span attributes: got %v", attrs)
+	case attrs["db.sql.table"] != "records" || attrs["db.rows_affected"] != "1":
+		t.Errorf("created span attributes: got %v", attrs)
+	case !strings.Contains(attrs["db.statement"], "INSERT INTO") || strings.Contains(attrs["db.statement"], "alpha"):
+		t.Errorf("created span statement: got %q, want the SQL without its arguments", attrs["db.statement"])
+	case created.Status().Code != codes.Unset || attrs["error.type"] != "":
+		t.Errorf("created span status: got %v, %q", created.Status(), attrs["error.type"])
+	}
+
+	duplicate := ended[1]
+	if attrs := attributes(duplicate.Attributes()); attrs["error.type"] != "unique_violation" || duplicate.Status().Code != codes.Error {
+		t.Errorf("duplicate span: got %v with status %v", attrs, duplicate.Status())
+	}
+
+	// Missing rows are not failures of the statement
+	missing := ended[2]
+	if attrs := attributes(missing.Attributes()); attrs["error.type"] != "not_found" || missing.Status().Code != codes.Unset || missing.Name() != "query records" {
+		t.Errorf("missing span %q: got %v with status %v", missing.Name(), attrs, missing.Status())
+	}
+}
+
+func TestObservabilityParentSpan(t *testing.T) {
+	records, _, spans, _ := observed(t, 0)
+
+	parentProvider := sdktrace.NewTracerProvider()
+	ctx, parent := parentProvider.Tracer("test").Start(context.Background(), "request")
+	if err := records.Create(ctx, &databasetest.Record{Name: "alpha"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	parent.End()
+
+	ended := spans.Ended()
+	if len(ended) != 1 || ended[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("got spans %v, want one child of the request span", ended)
+	}
+}
+
+func TestObservabilityMetrics(t *testing.T) {
+	records, _, _, metrics := observed(t, 0)
+	ctx := context.Background()
+
+	for _, name := range []string{"alpha", "bravo", "alpha"} {
+		records.Create(ctx, &databasetest.Record{Name: name})
+	}
+	records.Count(ctx, database.QueryFilter{})
+
+	var rm metricdata.ResourceMetrics
+	if err := metrics.Collect(ctx, &rm); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+
+	counts := make(map[string]uint64)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name != "db.client.operation.duration" || m.Unit != "s" {
+				continue
+			}
+			for _, point := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+				attrs := attributes(point.Attributes.ToSlice())
+				counts[attrs["db.operation"]+" "+attrs["db.entity"]+" "+attrs["error.type"]] += point.Count
+			}
+		}
+	}
+
+	want := map[string]uint64{
+		"create Record ":                 2,
+		"create Record unique_violation": 1,
+		"query Record ":                  1,
+	}
+	if len(counts) != len(want) {
+		t.Errorf("got durations %v, want %v", counts, want)
+	}
+	for key, n := range want {
+		if counts[key] != n {
+			t.Errorf("durations of %q: got %d, want %d", key, counts[key], n)
+		}
+	}
+}
+
+func TestObservabilitySlowThreshold(t *testing.T) {
+	lines := slowLog(t)
+	ctx := context.Background()
+
+	records, _, _, _ := observed(t, time.Hour)
+	if err := records.Create(ctx, &databasetest.Record{Name: "alpha"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if len(*lines) != 0 {
+		t.Fatalf("statements under the threshold logged: %q", *lines)
+	}
+
+	records, _, _, _ = observed(t, time.Nanosecond)
+	if err := records.Create(ctx, &databasetest.Record{Name: "alpha", Score: 10}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if len(*lines) != 1 {
+		t.Fatalf("got %d slow statements logged, want 1: %q", len(*lines), *lines)
+	}
+
+	// Arguments are redacted to their types
+	line := (*lines)[0]
+	for _, want := range []string{`"operation"="create"`, `"entity"="Record"`, `"table"="records"`, `"string"`, `"int"`} {
+		if !strings.Contains(line, want) {
+			t.Errorf("slow statement: %s is missing %s", line, want)
+		}
+	}
+	if strings.Contains(line, "alpha") {
+		t.Errorf("slow statement: %s logs the arguments", line)
+	}
+}
+
+// Statements of dry runs are not executed, they are not observed either
+func TestObservabilityDryRun(t *testing.T) {
+	_, db, spans, _ := observed(t, 0)
+
+	db.Session(&gorm.Session{DryRun: true}).Create(&databasetest.Record{Name: "alpha"})
+	if ended := spans.Ended(); len(ended) != 0 {
+		t.Errorf("got %d spans of a dry run", len(ended))
+	}
+}
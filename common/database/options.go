@@ -0,0 +1,39 @@
+package database
+
+// Option configures optional behaviour of a SQLHandler
+type Option func(*options)
+
+// options holds the optional configuration shared by SQLHandler instances
+type options struct {
+	// cursorKey signs and verifies the page tokens handed out by ListPage
+	cursorKey []byte
+
+	// retry retries the operations of handlers which are not bound to a transaction
+	retry *RetryPolicy
+}
+
+// WithCursorKey sets the key used to sign ListPage cursors, ListPage fails with
+// ErrNoCursorKey without one. All the replicas of a service must share the same key,
+// otherwise cursors issued by one replica are rejected by another.
+func WithCursorKey(key []byte) Option {
+	return func(o *options) {
+		o.cursorKey = key
+	}
+}
+
+// WithRetryPolicy retries operations failing with transient errors under the given policy.
+// Handlers bound to a transaction never retry single statements, as the failure aborts
+// the whole transaction, which is retried by RunInTx instead.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = &policy
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
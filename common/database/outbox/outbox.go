@@ -0,0 +1,99 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+)
+
+// ErrInvalidEvent is returned by Enqueue for events missing their aggregate or type
+var ErrInvalidEvent = errors.New("outbox: event requires an aggregate type, aggregate id and type")
+
+// Message is a row of the outbox table, an event waiting to be (or already) published
+type Message struct {
+	ID            uint64     `gorm:"primaryKey"`
+	AggregateType string     `gorm:"size:64;not null;index:idx_outbox_messages_aggregate,priority:1"`
+	AggregateID   string     `gorm:"size:64;not null;index:idx_outbox_messages_aggregate,priority:2"`
+	Type          string     `gorm:"size:128;not null"`
+	Payload       []byte     `gorm:"not null"`
+	CreatedAt     time.Time  `gorm:"not null"`
+	Attempts      int        `gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `gorm:"not null"`
+	LastError     string     `gorm:"not null;default:''"`
+	DeliveredAt   *time.Time `gorm:"index"`
+}
+
+// TableName returns the name of the outbox table
+func (Message) TableName() string {
+	return "outbox_messages"
+}
+
+// Event is a domain event about an aggregate, such as a user or an order. Events of the
+// same aggregate are published in the order they were enqueued.
+type Event struct {
+	AggregateType string
+	AggregateID   string
+	Type          string
+
+	// Payload is marshalled to JSON
+	Payload any
+}
+
+// Envelope is the message published for an event. Its ID is unique per event, so that
+// consumers can discard the duplicates of an at-least-once delivery.
+type Envelope struct {
+	ID            uint64          `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"payload"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+}
+
+// Enqueue stores events in the outbox within tx, so that they are published if and only
+// if the transaction commits
+func Enqueue(ctx context.Context, tx *database.Tx, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	messages := make([]Message, len(events))
+	for i, event := range events {
+		if event.AggregateType == "" || event.AggregateID == "" || event.Type == "" {
+			return ErrInvalidEvent
+		}
+
+		payload, err := json.Marshal(event.Payload)
+		if err != nil {
+			return fmt.Errorf("outbox: marshal %s payload: %w", event.Type, err)
+		}
+
+		messages[i] = Message{
+			AggregateType: event.AggregateType,
+			AggregateID:   event.AggregateID,
+			Type:          event.Type,
+			Payload:       payload,
+			CreatedAt:     now,
+			NextAttemptAt: now,
+		}
+	}
+
+	return database.TxHandler[Message](tx).CreateBatch(ctx, messages, 0)
+}
+
+// envelope returns the published form of the message
+func (m *Message) envelope() ([]byte, error) {
+	return json.Marshal(Envelope{
+		ID:            m.ID,
+		AggregateType: m.AggregateType,
+		AggregateID:   m.AggregateID,
+		Type:          m.Type,
+		Payload:       m.Payload,
+		OccurredAt:    m.CreatedAt,
+	})
+}
@@ -0,0 +1,223 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/rabbitmq"
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// headOfAggregate restricts the relayed messages to the oldest undelivered message of each
+// aggregate, so that a message is never published before the ones enqueued ahead of it
+const headOfAggregate = "id IN (SELECT MIN(id) FROM outbox_messages WHERE delivered_at IS NULL GROUP BY aggregate_type, aggregate_id)"
+
+// maxErrorLength caps the length of the publishing error stored with a message
+const maxErrorLength = 1024
+
+// RelayConfig configures a Relay, zero values are replaced by their defaults
+type RelayConfig struct {
+	// PollInterval is how long the relay waits for new messages once the outbox is drained (1s)
+	PollInterval time.Duration
+
+	// BatchSize is the maximum number of messages relayed per transaction (100)
+	BatchSize int
+
+	// MaxAttempts is the number of publishing attempts of a message (10). Past it the message is
+	// parked, and the later messages of its aggregate are held back until it is fixed by hand.
+	MaxAttempts int
+
+	// Backoff is the delay before the second attempt, doubled after every failure (1s)
+	// and capped at MaxBackoff (5m)
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Retention is how long delivered messages are kept (24h)
+	Retention time.Duration
+
+	// CleanupInterval is how often the delivered messages past their retention are deleted (10m)
+	CleanupInterval time.Duration
+}
+
+func (c RelayConfig) withDefaults() RelayConfig {
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 10
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 5 * time.Minute
+	}
+	if c.Retention <= 0 {
+		c.Retention = 24 * time.Hour
+	}
+	if c.CleanupInterval <= 0 {
+		c.CleanupInterval = 10 * time.Minute
+	}
+	return c
+}
+
+// Relay publishes the messages of the outbox to RabbitMQ. Delivery is at-least-once: a message
+// published right before its transaction fails is published again. Several relays can run
+// against the same outbox, the rows they are relaying are locked and skipped by the others.
+type Relay struct {
+	db        *gorm.DB
+	messages  *database.SQLHandler[Message]
+	publisher rabbitmq.RabbitMQ
+	config    RelayConfig
+}
+
+// NewRelay returns a relay of the outbox stored in db
+func NewRelay(db *gorm.DB, publisher rabbitmq.RabbitMQ, config RelayConfig) *Relay {
+	return &Relay{
+		db:        db,
+		messages:  database.NewSQLHandler[Message](db, database.WithRetryPolicy(database.DefaultRetryPolicy())),
+		publisher: publisher,
+		config:    config.withDefaults(),
+	}
+}
+
+// Run relays the messages and deletes the delivered ones past their retention until ctx is done
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+
+	var lastCleanup time.Time
+	for {
+		// Relay without waiting for the next tick as long as messages are being delivered
+		for {
+			delivered, err := r.RelayOnce(ctx)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				klog.ErrorS(err, "outbox: failed to relay messages")
+				break
+			}
+			if delivered == 0 {
+				break
+			}
+		}
+
+		if time.Since(lastCleanup) >= r.config.CleanupInterval {
+			deleted, err := r.Cleanup(ctx)
+			if err != nil {
+				klog.ErrorS(err, "outbox: failed to delete delivered messages")
+			} else {
+				klog.V(4).InfoS("outbox: deleted delivered messages", "count", deleted)
+				lastCleanup = time.Now()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce publishes a batch of due messages, at most one per aggregate, and records the
+// outcome of every attempt. It returns the number of delivered messages.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	var delivered int
+	err := r.messages.RunInTx(ctx, func(tx *database.Tx) error {
+		delivered = 0
+		messages := database.TxHandler[Message](tx)
+
+		now := time.Now()
+		pending, err := messages.List(ctx, database.QueryFilter{
+			Where: database.And(
+				database.IsNull("delivered_at"),
+				database.Lt("attempts", r.config.MaxAttempts),
+				database.Lte("next_attempt_at", now),
+			),
+			WhereQuery: headOfAggregate,
+			OrderBy:    "id",
+			Limit:      r.config.BatchSize,
+			Lock:       database.RowLock{Mode: database.LockForUpdate, Wait: database.LockSkipLocked},
+		}, nil)
+		if err != nil {
+			return err
+		}
+
+		for i := range pending {
+			update, err := r.publish(ctx, &pending[i], now)
+			if ctx.Err() != nil {
+				// Do not count an attempt cut short by the caller
+				return ctx.Err()
+			}
+			if err == nil {
+				delivered++
+			}
+
+			err = messages.Update(ctx, database.QueryFilter{
+				WhereMap:  map[string]any{"id": pending[i].ID},
+				UpdateMap: update,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return delivered, err
+}
+
+// publish publishes the message and returns the columns recording the outcome, along
+// with the publishing error
+func (r *Relay) publish(ctx context.Context, m *Message, now time.Time) (map[string]any, error) {
+	body, err := m.envelope()
+	if err == nil {
+		err = r.publisher.Publish(ctx, body)
+	}
+	if err == nil {
+		return map[string]any{"delivered_at": now}, nil
+	}
+
+	attempts := m.Attempts + 1
+	if attempts >= r.config.MaxAttempts {
+		klog.ErrorS(err, "outbox: giving up on message, later messages of its aggregate are held back",
+			"id", m.ID, "aggregateType", m.AggregateType, "aggregateID", m.AggregateID, "type", m.Type)
+	} else {
+		klog.V(2).InfoS("outbox: failed to publish message", "id", m.ID, "type", m.Type, "attempts", attempts, "err", err)
+	}
+
+	lastError := err.Error()
+	if len(lastError) > maxErrorLength {
+		lastError = lastError[:maxErrorLength]
+	}
+
+	return map[string]any{
+		"attempts":        attempts,
+		"next_attempt_at": now.Add(r.backoff(attempts)),
+		"last_error":      lastError,
+	}, err
+}
+
+// backoff returns the delay before the next attempt of a message that failed attempts times
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.config.Backoff
+	for i := 1; i < attempts && delay < r.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.config.MaxBackoff)
+}
+
+// Cleanup deletes the messages delivered more than the retention ago and returns their number
+func (r *Relay) Cleanup(ctx context.Context) (int64, error) {
+	cutoff := time.Now().Add(-r.config.Retention)
+	result := r.db.WithContext(ctx).Where("delivered_at < ?", cutoff).Delete(&Message{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,291 @@
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+	"github.com/swarit-pandey/e-commerce/common/database/outbox"
+	"gorm.io/gorm"
+)
+
+// publisher records the published envelopes, failing while err is set
+type publisher struct {
+	mu        sync.Mutex
+	err       error
+	published []outbox.Envelope
+}
+
+func (p *publisher) Publish(ctx context.Context, message []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	var envelope outbox.Envelope
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return err
+	}
+	p.published = append(p.published, envelope)
+	return nil
+}
+
+func (p *publisher) Consume(ctx context.Context, handler func(message []byte) error) error {
+	return errors.New("not implemented")
+}
+
+func (p *publisher) Close() error {
+	return nil
+}
+
+func (p *publisher) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// types returns the aggregate IDs and types of the published envelopes, such as "a:created"
+func (p *publisher) types() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var types []string
+	for _, envelope := range p.published {
+		types = append(types, envelope.AggregateID+":"+envelope.Type)
+	}
+	return types
+}
+
+func enqueue(t *testing.T, db database.SQLDatabase, events ...outbox.Event) {
+	t.Helper()
+
+	err := db.RunInTx(context.Background(), func(tx *database.Tx) error {
+		return outbox.Enqueue(context.Background(), tx, events...)
+	})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+}
+
+func event(id, typ string) outbox.Event {
+	return outbox.Event{AggregateType: "order", AggregateID: id, Type: typ, Payload: map[string]string{"id": id}}
+}
+
+func relayOnce(t *testing.T, relay *outbox.Relay, want int) {
+	t.Helper()
+
+	delivered, err := relay.RelayOnce(context.Background())
+	if err != nil || delivered != want {
+		t.Fatalf("relay: got %d delivered, %v, want %d", delivered, err, want)
+	}
+}
+
+func message(t *testing.T, db *gorm.DB, id, typ string) outbox.Message {
+	t.Helper()
+
+	var m outbox.Message
+	if err := db.Where("aggregate_id = ? AND type = ?", id, typ).First(&m).Error; err != nil {
+		t.Fatalf("message %s:%s: %v", id, typ, err)
+	}
+	return m
+}
+
+func TestEnqueue(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.New(t, &outbox.Message{})
+
+	err := db.RunInTx(ctx, func(tx *database.Tx) error {
+		return outbox.Enqueue(ctx, tx, event("a", "created"), outbox.Event{AggregateType: "order", Type: "created"})
+	})
+	if !errors.Is(err, outbox.ErrInvalidEvent) {
+		t.Errorf("event without aggregate id: got %v, want ErrInvalidEvent", err)
+	}
+
+	// Events are only stored when their transaction commits
+	errAbort := errors.New("abort")
+	err = db.RunInTx(ctx, func(tx *database.Tx) error {
+		if err := outbox.Enqueue(ctx, tx, event("a", "created")); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("rolled back enqueue: got %v", err)
+	}
+	var count int64
+	if db.Instance().Model(&outbox.Message{}).Count(&count); count != 0 {
+		t.Errorf("messages of a rolled back transaction: got %d", count)
+	}
+
+	enqueue(t, db, event("a", "created"))
+	m := message(t, db.Instance(), "a", "created")
+	if string(m.Payload) != `{"id":"a"}` || m.Attempts != 0 || m.DeliveredAt != nil || m.NextAttemptAt.After(time.Now()) {
+		t.Errorf("enqueued message: got %+v", m)
+	}
+}
+
+// Messages are published in order per aggregate, the aggregates being relayed side by side
+func TestRelayOrder(t *testing.T) {
+	db := databasetest.New(t, &outbox.Message{})
+	p := &publisher{}
+	relay := outbox.NewRelay(db.Instance(), p, outbox.RelayConfig{})
+
+	enqueue(t, db, event("a", "created"), event("a", "paid"), event("b", "created"))
+	enqueue(t, db, event("a", "shipped"))
+
+	relayOnce(t, relay, 2)
+	relayOnce(t, relay, 1)
+	relayOnce(t, relay, 1)
+	relayOnce(t, relay, 0)
+
+	if got, want := p.types(), []string{"a:created", "b:created", "a:paid", "a:shipped"}; !slices.Equal(got, want) {
+		t.Errorf("published: got %v, want %v", got, want)
+	}
+
+	envelope := p.published[0]
+	m := message(t, db.Instance(), "a", "created")
+	if envelope.ID != m.ID || envelope.AggregateType != "order" || string(envelope.Payload) != `{"id":"a"}` || !envelope.OccurredAt.Equal(m.CreatedAt) {
+		t.Errorf("envelope: got %+v for %+v", envelope, m)
+	}
+	if m.DeliveredAt == nil || m.Attempts != 0 {
+		t.Errorf("delivered message: got %+v", m)
+	}
+}
+
+func TestRelayBatchSize(t *testing.T) {
+	db := databasetest.New(t, &outbox.Message{})
+	p := &publisher{}
+	relay := outbox.NewRelay(db.Instance(), p, outbox.RelayConfig{BatchSize: 2})
+
+	enqueue(t, db, event("a", "created"), event("b", "created"), event("c", "created"))
+	relayOnce(t, relay, 2)
+	relayOnce(t, relay, 1)
+
+	if got, want := p.types(), []string{"a:created", "b:created", "c:created"}; !slices.Equal(got, want) {
+		t.Errorf("published: got %v, want %v", got, want)
+	}
+}
+
+func TestRelayFailures(t *testing.T) {
+	db := databasetest.New(t, &outbox.Message{})
+	p := &publisher{}
+	relay := outbox.NewRelay(db.Instance(), p, outbox.RelayConfig{MaxAttempts: 3, Backoff: time.Hour, MaxBackoff: 90 * time.Minute})
+
+	enqueue(t, db, event("a", "created"), event("a", "paid"))
+	p.fail(errors.New("broker unavailable " + strings.Repeat("!", 2000)))
+
+	// A failed message is retried after its backoff, holding back the later ones of its aggregate
+	start := time.Now()
+	relayOnce(t, relay, 0)
+	m := message(t, db.Instance(), "a", "created")
+	if m.Attempts != 1 || m.DeliveredAt != nil || !strings.HasPrefix(m.LastError, "broker unavailable") || len(m.LastError) != 1024 {
+		t.Errorf("failed message: got %d attempts, delivered at %v, error %q", m.Attempts, m.DeliveredAt, m.LastError)
+	}
+	if backoff := m.NextAttemptAt.Sub(start); backoff < time.Hour || backoff > time.Hour+time.Minute {
+		t.Errorf("first backoff: got %v, want 1h", backoff)
+	}
+
+	relayOnce(t, relay, 0)
+	if m := message(t, db.Instance(), "a", "created"); m.Attempts != 1 {
+		t.Errorf("message retried before its backoff: got %d attempts", m.Attempts)
+	}
+
+	// The doubled backoff is capped
+	due := func() {
+		t.Helper()
+		if err := db.Instance().Model(&outbox.Message{}).Where("delivered_at IS NULL").Update("next_attempt_at", time.Now()).Error; err != nil {
+			t.Fatalf("make due: %v", err)
+		}
+	}
+	due()
+	start = time.Now()
+	relayOnce(t, relay, 0)
+	m = message(t, db.Instance(), "a", "created")
+	if backoff := m.NextAttemptAt.Sub(start); m.Attempts != 2 || backoff < 90*time.Minute || backoff > 91*time.Minute {
+		t.Errorf("second backoff: got %v after %d attempts, want 1h30m", backoff, m.Attempts)
+	}
+
+	// Past MaxAttempts the message is parked, the other aggregates are still relayed
+	due()
+	relayOnce(t, relay, 0)
+	p.fail(nil)
+	enqueue(t, db, event("b", "created"))
+	due()
+	relayOnce(t, relay, 1)
+	relayOnce(t, relay, 0)
+
+	if got, want := p.types(), []string{"b:created"}; !slices.Equal(got, want) {
+		t.Errorf("published: got %v, want %v", got, want)
+	}
+	if m := message(t, db.Instance(), "a", "created"); m.Attempts != 3 || m.DeliveredAt != nil {
+		t.Errorf("parked message: got %+v", m)
+	}
+}
+
+func TestRelayCleanup(t *testing.T) {
+	db := databasetest.New(t, &outbox.Message{})
+	relay := outbox.NewRelay(db.Instance(), &publisher{}, outbox.RelayConfig{Retention: time.Hour})
+
+	enqueue(t, db, event("a", "created"), event("b", "created"), event("c", "created"))
+	relayOnce(t, relay, 3)
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := db.Instance().Model(&outbox.Message{}).Where("aggregate_id = ?", "a").Update("delivered_at", old).Error; err != nil {
+		t.Fatalf("age message: %v", err)
+	}
+	enqueue(t, db, event("d", "created"))
+
+	deleted, err := relay.Cleanup(context.Background())
+	if err != nil || deleted != 1 {
+		t.Fatalf("cleanup: got %d deleted, %v, want 1", deleted, err)
+	}
+	var count int64
+	if db.Instance().Model(&outbox.Message{}).Count(&count); count != 3 {
+		t.Errorf("messages after cleanup: got %d, want 3", count)
+	}
+}
+
+// Run drains the outbox, polls for new messages and stops with its context
+func TestRelayRun(t *testing.T) {
+	db := databasetest.New(t, &outbox.Message{})
+	p := &publisher{}
+	relay := outbox.NewRelay(db.Instance(), p, outbox.RelayConfig{PollInterval: time.Millisecond})
+
+	enqueue(t, db, event("a", "created"), event("a", "paid"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- relay.Run(ctx)
+	}()
+
+	waitFor := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for len(p.types()) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("published: got %v, want %d messages", p.types(), n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitFor(2)
+	enqueue(t, db, event("a", "shipped"))
+	waitFor(3)
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("run: got %v, want context.Canceled", err)
+	}
+	if got, want := p.types(), []string{"a:created", "a:paid", "a:shipped"}; !slices.Equal(got, want) {
+		t.Errorf("published: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,400 @@
+package database
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// defaultPageSize is used by ListPage when the query filter has no limit
+const defaultPageSize = 20
+
+// Page holds a single page of a keyset paginated result set. The cursors are
+// empty when there is no page in that direction.
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+	PrevCursor string
+}
+
+// sortKey is a single column of the keyset
+type sortKey struct {
+	field *schema.Field
+	desc  bool
+}
+
+// cursor is the payload carried by a page token
+type cursor struct {
+	Keys     string            `json:"k"`
+	Values   []json.RawMessage `json:"v"`
+	Backward bool              `json:"b,omitempty"`
+}
+
+// ListPage implements `ListPage()` from Repository interface
+func (r *SQLHandler[T]) ListPage(ctx context.Context, qf QueryFilter, p *Projection) (*Page[T], error) {
+	sch, err := parseSchema(r.db, new(T))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := newPageRequest(sch, qf, r.opts.cursorKey)
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := r.readKeyset(ctx, qf, p, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPage(ctx, r.opts.cursorKey, req, entities)
+}
+
+// readKeyset reads the entities of a keyset request, sorted in its direction and over-fetched
+// by one to tell whether there are more
+func (r *SQLHandler[T]) readKeyset(ctx context.Context, qf QueryFilter, p *Projection, req *pageRequest) ([]T, error) {
+	// Ordering, limits and offsets are owned by the keyset
+	qf.OrderBy, qf.Limit, qf.Cursor = "", 0, ""
+
+	db := r.db.WithContext(ctx).Model(new(T))
+	db = applyProjections(db, p)
+	db = applyQueryFilters(db, qf)
+	db = applyPreloads(db, qf.Preload)
+	db = applyLock(db, qf.Lock)
+
+	if req.after != nil {
+		db = db.Where(keysetCondition(req.keys, req.after, req.backward))
+	}
+
+	for _, key := range req.keys {
+		db = db.Order(clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: key.field.DBName},
+			Desc:   key.desc != req.backward,
+		})
+	}
+
+	var entities []T
+	err := r.retry(ctx, func(ctx context.Context) error {
+		return classifyError(db.WithContext(ctx).Limit(req.size + 1).Find(&entities).Error)
+	})
+	return entities, err
+}
+
+// pageRequest is a ListPage request resolved against the model
+type pageRequest struct {
+	keys      []sortKey
+	signature string
+	size      int
+
+	// after holds the key values of the cursor, the page starts right after (or right
+	// before when going backward) the entity they were taken from. It is nil for the first page.
+	after    []any
+	backward bool
+}
+
+// newPageRequest validates the ordering, cursor and page size of a ListPage request
+func newPageRequest(sch *schema.Schema, qf QueryFilter, cursorKey []byte) (*pageRequest, error) {
+	if len(cursorKey) == 0 {
+		return nil, ErrNoCursorKey
+	}
+
+	req, err := newKeysetRequest(sch, qf)
+	if err != nil {
+		return nil, err
+	}
+
+	if qf.Cursor != "" {
+		cur, err := decodeCursor(cursorKey, qf.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cur.Keys != req.signature || len(cur.Values) != len(req.keys) {
+			return nil, fmt.Errorf("%w: cursor was issued for a different ordering", ErrInvalidCursor)
+		}
+
+		req.after, err = cursorValues(req.keys, cur.Values)
+		if err != nil {
+			return nil, err
+		}
+		req.backward = cur.Backward
+	}
+
+	return req, nil
+}
+
+// newKeysetRequest validates the ordering and page size of a keyset read starting at the
+// first entity. It needs no cursor key, see ForEach.
+func newKeysetRequest(sch *schema.Schema, qf QueryFilter) (*pageRequest, error) {
+	if qf.Offset > 0 {
+		return nil, fmt.Errorf("%w: offset can not be combined with keyset pagination", ErrInvalidFilter)
+	}
+
+	keys, err := parseSortKeys(sch, qf.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &pageRequest{keys: keys, signature: keysSignature(keys), size: qf.Limit}
+	if req.size <= 0 {
+		req.size = defaultPageSize
+	}
+	return req, nil
+}
+
+// newPage builds the page of a request out of the entities read for it, which are sorted
+// in the direction of the request and over-fetched by one to tell whether there are more
+func newPage[T any](ctx context.Context, cursorKey []byte, req *pageRequest, entities []T) (*Page[T], error) {
+	hasMore := len(entities) > req.size
+	if hasMore {
+		entities = entities[:req.size]
+	}
+	if req.backward {
+		for i, j := 0, len(entities)-1; i < j; i, j = i+1, j-1 {
+			entities[i], entities[j] = entities[j], entities[i]
+		}
+	}
+
+	page := &Page[T]{Items: entities}
+	if len(entities) == 0 {
+		return page, nil
+	}
+
+	// Going forward there is a previous page whenever we started from a cursor and a
+	// next page when the query over-fetched, going backward it is the other way around.
+	hasNext, hasPrev := hasMore, req.after != nil
+	if req.backward {
+		hasNext, hasPrev = true, hasMore
+	}
+
+	var err error
+	if hasNext {
+		page.NextCursor, err = encodeCursor(ctx, cursorKey, req.signature, req.keys, &entities[len(entities)-1], false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hasPrev {
+		page.PrevCursor, err = encodeCursor(ctx, cursorKey, req.signature, req.keys, &entities[0], true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+// parseSchema parses the GORM schema of the given model
+func parseSchema(db *gorm.DB, model any) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	err := stmt.Parse(model)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// parseSortKeys resolves an ORDER BY expression such as "created_at desc, id" to
+// the schema fields of the model and appends the primary key as a tiebreak
+func parseSortKeys(sch *schema.Schema, orderBy string) ([]sortKey, error) {
+	var keys []sortKey
+	seen := make(map[string]bool)
+
+	for _, term := range strings.Split(orderBy, ",") {
+		parts := strings.Fields(term)
+		if len(parts) == 0 {
+			continue
+		}
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("%w: invalid order by term %q", ErrInvalidFilter, strings.TrimSpace(term))
+		}
+
+		desc := false
+		if len(parts) == 2 {
+			switch strings.ToLower(parts[1]) {
+			case "asc":
+			case "desc":
+				desc = true
+			default:
+				return nil, fmt.Errorf("%w: invalid sort direction %q", ErrInvalidFilter, parts[1])
+			}
+		}
+
+		name := strings.TrimPrefix(parts[0], sch.Table+".")
+		field := sch.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("%w: unknown sort column %q", ErrInvalidFilter, parts[0])
+		}
+		if seen[field.DBName] {
+			continue
+		}
+		// NULLs do not compare, rows holding one would be skipped or repeated across pages
+		if nullable(field) {
+			return nil, fmt.Errorf("%w: can not paginate on nullable column %q", ErrInvalidFilter, parts[0])
+		}
+
+		seen[field.DBName] = true
+		keys = append(keys, sortKey{field: field, desc: desc})
+	}
+
+	if len(sch.PrimaryFields) == 0 {
+		return nil, fmt.Errorf("%w: %s has no primary key to paginate on", ErrInvalidFilter, sch.Name)
+	}
+
+	// The tiebreak follows the direction of the last sort column
+	desc := len(keys) > 0 && keys[len(keys)-1].desc
+	for _, field := range sch.PrimaryFields {
+		if !seen[field.DBName] {
+			keys = append(keys, sortKey{field: field, desc: desc})
+		}
+	}
+
+	return keys, nil
+}
+
+// nullable tells whether a field may hold NULL, that is a pointer or a sql.Null* like
+// type, unless it is declared NOT NULL
+func nullable(field *schema.Field) bool {
+	if field.NotNull || field.PrimaryKey {
+		return false
+	}
+	if field.FieldType.Kind() == reflect.Ptr {
+		return true
+	}
+	if field.FieldType.Kind() != reflect.Struct {
+		return false
+	}
+	if _, ok := reflect.New(field.FieldType).Interface().(sql.Scanner); !ok {
+		return false
+	}
+	valid, ok := field.FieldType.FieldByName("Valid")
+	return ok && valid.Type.Kind() == reflect.Bool
+}
+
+// keysSignature identifies the ordering a cursor was issued for
+func keysSignature(keys []sortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		direction := "asc"
+		if key.desc {
+			direction = "desc"
+		}
+		parts[i] = key.field.DBName + ":" + direction
+	}
+	return strings.Join(parts, ",")
+}
+
+// keysetCondition builds the row comparison (k1, k2, ...) > (v1, v2, ...) honouring the
+// direction of every key, expanded as k1 > v1 OR (k1 = v1 AND k2 > v2) OR ...
+func keysetCondition(keys []sortKey, values []any, backward bool) clause.Expression {
+	var ors []clause.Expression
+	for i, key := range keys {
+		var ands []clause.Expression
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: keyColumn(keys[j]), Value: values[j]})
+		}
+
+		if key.desc != backward {
+			ands = append(ands, clause.Lt{Column: keyColumn(key), Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: keyColumn(key), Value: values[i]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+
+	if len(ors) == 1 {
+		return ors[0]
+	}
+	return clause.Or(ors...)
+}
+
+func keyColumn(key sortKey) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: key.field.DBName}
+}
+
+// cursorValues decodes the raw cursor values into the types of the key fields
+func cursorValues(keys []sortKey, raw []json.RawMessage) ([]any, error) {
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		value := reflect.New(key.field.FieldType)
+		err := json.Unmarshal(raw[i], value.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+		values[i] = value.Elem().Interface()
+	}
+	return values, nil
+}
+
+// encodeCursor builds a signed page token pointing at the given entity
+func encodeCursor(ctx context.Context, key []byte, signature string, keys []sortKey, entity any, backward bool) (string, error) {
+	cur := cursor{Keys: signature, Backward: backward}
+	for _, value := range keyValues(ctx, keys, entity) {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		cur.Values = append(cur.Values, raw)
+	}
+
+	payload, err := json.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(signCursor(key, payload)), nil
+}
+
+// keyValues returns the values of the keys of the given entity
+func keyValues(ctx context.Context, keys []sortKey, entity any) []any {
+	rv := reflect.ValueOf(entity).Elem()
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		values[i], _ = k.field.ValueOf(ctx, rv)
+	}
+	return values
+}
+
+// decodeCursor verifies the signature of a page token and decodes its payload
+func decodeCursor(key []byte, token string) (*cursor, error) {
+	encPayload, encMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	enc := base64.RawURLEncoding
+	payload, err := enc.DecodeString(encPayload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	mac, err := enc.DecodeString(encMAC)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if !hmac.Equal(mac, signCursor(key, payload)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var cur cursor
+	err = json.Unmarshal(payload, &cur)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cur, nil
+}
+
+func signCursor(key, payload []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
@@ -0,0 +1,57 @@
+package database_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+)
+
+// ListPage builds its filters on the aliases of the projection, as List does
+func TestListPageProjectionAliases(t *testing.T) {
+	ctx := context.Background()
+	repo := databasetest.SQLiteRecords(t)
+
+	for _, record := range []databasetest.Record{
+		{Name: "alpha", Category: "fruit"},
+		{Name: "bravo", Category: "fruit"},
+		{Name: "charlie", Category: "veggie"},
+	} {
+		if err := repo.Create(ctx, &record); err != nil {
+			t.Fatalf("create %s: %v", record.Name, err)
+		}
+	}
+
+	qf := database.QueryFilter{GroupBy: "category, day", Limit: 10}
+	p := &database.Projection{
+		Fields:  []string{"category"},
+		Buckets: []database.TimeBucket{{Field: "created_at", Unit: "day", Alias: "day"}},
+	}
+
+	list, err := repo.List(ctx, qf, p)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	page, err := repo.ListPage(ctx, qf, p)
+	if err != nil {
+		t.Fatalf("list page: %v", err)
+	}
+
+	categories := func(records []databasetest.Record) []string {
+		var got []string
+		for _, r := range records {
+			got = append(got, r.Category)
+		}
+		slices.Sort(got)
+		return got
+	}
+	want := []string{"fruit", "veggie"}
+	if got := categories(list); !slices.Equal(got, want) {
+		t.Errorf("list: got %v, want %v", got, want)
+	}
+	if got := categories(page.Items); !slices.Equal(got, want) {
+		t.Errorf("list page: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Preload describes an association loaded alongside the retrieved entities
+type Preload struct {
+	// Association is the name of the association field. Nested associations are separated
+	// by dots (e.g. "Items.Product"), their parents are loaded as well.
+	Association string
+
+	// Where filters the associated entities, its columns are those of the associated model
+	Where Expr
+
+	// OrderBy orders the associated entities, in the format of QueryFilter.OrderBy
+	OrderBy string
+
+	// Limit caps the number of associated entities loaded per entity. It is only supported
+	// by has-one and has-many associations, as it ranks them by their foreign key.
+	Limit int
+}
+
+// applyPreloads validates the preloads against the model of the query and adds them to it.
+// Invalid preloads are added to the query's errors and surface when the query is executed.
+func applyPreloads(query *gorm.DB, preloads []Preload) *gorm.DB {
+	if len(preloads) == 0 {
+		return query
+	}
+
+	if query.Statement.Schema == nil {
+		err := query.Statement.Parse(query.Statement.Model)
+		if err != nil {
+			query.AddError(err)
+			return query
+		}
+	}
+
+	seen := make(map[string]bool, len(preloads))
+	for _, p := range preloads {
+		if seen[p.Association] {
+			query.AddError(fmt.Errorf("%w: association %q preloaded more than once", ErrInvalidFilter, p.Association))
+			return query
+		}
+		seen[p.Association] = true
+
+		rel, err := lookUpRelationship(query.Statement.Schema, p.Association)
+		if err != nil {
+			query.AddError(err)
+			return query
+		}
+
+		scope, err := preloadScope(dialectOf(query), rel, p)
+		if err != nil {
+			query.AddError(err)
+			return query
+		}
+		query = query.Preload(p.Association, scope)
+	}
+	return query
+}
+
+// lookUpRelationship resolves a dot separated association path from the model
+func lookUpRelationship(sch *schema.Schema, path string) (*schema.Relationship, error) {
+	var rel *schema.Relationship
+	for _, name := range strings.Split(path, ".") {
+		if !identifierRegex.MatchString(name) {
+			return nil, fmt.Errorf("%w: invalid association %q", ErrInvalidFilter, path)
+		}
+
+		rel = sch.Relationships.Relations[name]
+		if rel == nil {
+			return nil, fmt.Errorf("%w: unknown association %q for %s", ErrInvalidFilter, name, sch.Name)
+		}
+		sch = rel.FieldSchema
+	}
+	return rel, nil
+}
+
+// preloadScope builds the conditions of the query loading an association
+func preloadScope(d dialect, rel *schema.Relationship, p Preload) (func(*gorm.DB) *gorm.DB, error) {
+	b := newExprBuilder(rel.FieldSchema, d)
+
+	where, err := b.build(p.Where)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := orderByColumns(b, p.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.Limit < 0:
+		return nil, fmt.Errorf("%w: negative limit for association %q", ErrInvalidFilter, p.Association)
+	case p.Limit > 0 && rel.Type != schema.HasOne && rel.Type != schema.HasMany:
+		return nil, fmt.Errorf("%w: limit on %s association %q", ErrUnsupportedFilter, rel.Type, p.Association)
+	case p.Limit > 0 && rel.FieldSchema.PrioritizedPrimaryField == nil:
+		return nil, fmt.Errorf("%w: limit on association %q without a primary key", ErrUnsupportedFilter, p.Association)
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		if where != nil {
+			db = db.Where(where)
+		}
+		for _, order := range orders {
+			db = db.Order(order)
+		}
+		if p.Limit > 0 {
+			db = db.Where(limitPerEntity(rel, where, orders, p.Limit, !db.Statement.Unscoped))
+		}
+		return db
+	}, nil
+}
+
+// limitPerEntity restricts the associated entities to the first limit ones of every
+// entity, ranked with a window function partitioned by their foreign key
+func limitPerEntity(rel *schema.Relationship, where clause.Expression, orders []clause.OrderByColumn, limit int, scoped bool) clause.Expression {
+	sch := rel.FieldSchema
+	pk := clause.Column{Name: sch.PrioritizedPrimaryField.DBName}
+
+	var partition []clause.Expression
+	for _, ref := range rel.References {
+		partition = append(partition, clause.Expr{SQL: "?", Vars: []any{clause.Column{Name: ref.ForeignKey.DBName}}})
+	}
+	if len(orders) == 0 {
+		orders = []clause.OrderByColumn{{Column: pk}}
+	}
+	ordering := make([]clause.Expression, len(orders))
+	for i, order := range orders {
+		ordering[i] = clause.Expr{SQL: "?", Vars: []any{order.Column}}
+		if order.Desc {
+			ordering[i] = clause.Expr{SQL: "? DESC", Vars: []any{order.Column}}
+		}
+	}
+
+	// The ranking query sees the same rows as the preload query
+	var conditions []clause.Expression
+	if where != nil {
+		conditions = append(conditions, where)
+	}
+	if field := deletedAtField(sch); field != nil && scoped {
+		conditions = append(conditions, clause.Expr{SQL: "? IS NULL", Vars: []any{clause.Column{Name: field.DBName}}})
+	}
+	filter := clause.Expression(clause.Expr{SQL: "1 = 1"})
+	if len(conditions) > 0 {
+		filter = joinExpressions(conditions, false)
+	}
+
+	return clause.Expr{
+		SQL: "? IN (SELECT ? FROM (SELECT ?, ROW_NUMBER() OVER (PARTITION BY ? ORDER BY ?) AS preload_rank " +
+			"FROM ? WHERE ?) preload_ranked WHERE preload_rank <= ?)",
+		Vars: []any{
+			clause.Column{Table: clause.CurrentTable, Name: pk.Name},
+			pk,
+			pk,
+			clause.CommaExpression{Exprs: partition},
+			clause.CommaExpression{Exprs: ordering},
+			clause.Table{Name: sch.Table},
+			filter,
+			limit,
+		},
+	}
+}
@@ -0,0 +1,148 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+	"gorm.io/gorm"
+)
+
+type author struct {
+	ID    uint `gorm:"primaryKey"`
+	Name  string
+	Books []book
+}
+
+type book struct {
+	ID        uint `gorm:"primaryKey"`
+	AuthorID  uint
+	Author    author
+	Title     string
+	Pages     int
+	DeletedAt gorm.DeletedAt
+	Reviews   []review
+}
+
+type review struct {
+	ID     uint `gorm:"primaryKey"`
+	BookID uint
+	Stars  int
+}
+
+// seedAuthors creates two authors, with the books and reviews of the first one
+func seedAuthors(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	authors := []author{
+		{Name: "ada", Books: []book{
+			{Title: "a1", Pages: 50, Reviews: []review{{Stars: 3}, {Stars: 5}}},
+			{Title: "a2", Pages: 300},
+			{Title: "a3", Pages: 200},
+			{Title: "a4", Pages: 400},
+		}},
+		{Name: "grace", Books: []book{
+			{Title: "g1", Pages: 150},
+		}},
+	}
+	if err := db.Create(&authors).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+}
+
+func titles(books []book) []string {
+	var got []string
+	for _, b := range books {
+		got = append(got, b.Title)
+	}
+	return got
+}
+
+func TestPreload(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.New(t, &author{}, &book{}, &review{}).Instance()
+	seedAuthors(t, db)
+	authors := database.NewSQLHandler[author](db)
+
+	list := func(preloads ...database.Preload) []author {
+		t.Helper()
+		got, err := authors.List(ctx, database.QueryFilter{OrderBy: "id", Preload: preloads}, nil)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		return got
+	}
+
+	got := list(database.Preload{Association: "Books", Where: database.Gt("pages", 100), OrderBy: "pages DESC"})
+	if !slices.Equal(titles(got[0].Books), []string{"a4", "a2", "a3"}) || !slices.Equal(titles(got[1].Books), []string{"g1"}) {
+		t.Errorf("filtered and ordered books: got %v and %v", titles(got[0].Books), titles(got[1].Books))
+	}
+
+	// Limits apply per author, to the books that are not soft deleted
+	if err := db.Delete(&book{}, "title = ?", "a4").Error; err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	got = list(database.Preload{Association: "Books", OrderBy: "pages DESC", Limit: 2})
+	if !slices.Equal(titles(got[0].Books), []string{"a2", "a3"}) || !slices.Equal(titles(got[1].Books), []string{"g1"}) {
+		t.Errorf("limited books: got %v and %v", titles(got[0].Books), titles(got[1].Books))
+	}
+
+	got = list(database.Preload{Association: "Books.Reviews", OrderBy: "stars DESC"})
+	if len(got[0].Books) != 3 || got[0].Books[0].Title != "a1" || len(got[0].Books[0].Reviews) != 2 || got[0].Books[0].Reviews[0].Stars != 5 {
+		t.Errorf("nested reviews: got %+v", got[0].Books)
+	}
+
+	// Associations are only loaded when asked for
+	if got = list(); got[0].Books != nil {
+		t.Errorf("books without preload: got %+v", got[0].Books)
+	}
+}
+
+func TestPreloadInvalid(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.New(t, &author{}, &book{}, &review{}).Instance()
+	authors := database.NewSQLHandler[author](db)
+	books := database.NewSQLHandler[book](db)
+	memory := database.NewMemoryRepository[author](database.NewMemoryDatabase())
+
+	listAuthors := func(preloads []database.Preload) error {
+		_, err := authors.List(ctx, database.QueryFilter{Preload: preloads}, nil)
+		return err
+	}
+	listBooks := func(preloads []database.Preload) error {
+		_, err := books.List(ctx, database.QueryFilter{Preload: preloads}, nil)
+		return err
+	}
+	listMemory := func(preloads []database.Preload) error {
+		_, err := memory.List(ctx, database.QueryFilter{Preload: preloads}, nil)
+		return err
+	}
+
+	tests := []struct {
+		name     string
+		list     func(preloads []database.Preload) error
+		preloads []database.Preload
+		want     error
+	}{
+		{"unknown association", listAuthors, []database.Preload{{Association: "Articles"}}, database.ErrInvalidFilter},
+		{"unknown nested association", listAuthors, []database.Preload{{Association: "Books.Chapters"}}, database.ErrInvalidFilter},
+		{"invalid association", listAuthors, []database.Preload{{Association: "Books;--"}}, database.ErrInvalidFilter},
+		{"preloaded twice", listAuthors, []database.Preload{{Association: "Books"}, {Association: "Books"}}, database.ErrInvalidFilter},
+		{"unknown column", listAuthors, []database.Preload{{Association: "Books", Where: database.Eq("isbn", "x")}}, database.ErrInvalidFilter},
+		{"unknown order", listAuthors, []database.Preload{{Association: "Books", OrderBy: "isbn"}}, database.ErrInvalidFilter},
+		{"negative limit", listAuthors, []database.Preload{{Association: "Books", Limit: -1}}, database.ErrInvalidFilter},
+		{"limit on belongs to", listBooks, []database.Preload{{Association: "Author", Limit: 1}}, database.ErrUnsupportedFilter},
+		{"memory repository", listMemory, []database.Preload{{Association: "Books"}}, database.ErrUnsupportedFilter},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.list(test.preloads); !errors.Is(err, test.want) {
+				t.Errorf("got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -2,19 +2,42 @@ package database
 
 // Projection defines how data should be projected from the database,
 // including specific fields, aggregates, conditionals, and subqueries.
+// Fields, buckets and aggregates are validated against the model's schema,
+// conditionals and subqueries are trusted SQL fragments.
 type Projection struct {
 	Fields       []string                // Fields to include in the projection.
 	Aggregates   []AggregateProjection   // Aggregate functions to apply.
+	Buckets      []TimeBucket            // Time columns truncated to a unit, to group time series.
 	Conditionals []ConditionalProjection // Conditional field values.
 	Subqueries   []SubqueryProjection    // Subqueries to include in the projection.
+	Ranks        []SearchRank            // Relevance of the rows to a full-text search.
 	Exclude      []string                // Fields to exclude.
 }
 
 // AggregateProjection specifies an aggregation operation on a field.
 type AggregateProjection struct {
-	Field    string // Field to aggregate.
-	Function string // Aggregate function (e.g., "SUM", "COUNT", "AVG").
-	Alias    string // Optional alias for the aggregated result.
+	Field    string // Field to aggregate, or "*" to COUNT rows.
+	Function string // Aggregate function: COUNT, SUM, AVG, MIN or MAX.
+	Alias    string // Optional alias for the aggregated result, defaults to function_field.
+}
+
+// TimeBucket truncates a time field to the start of its hour, day, week (starting on
+// Monday), month or year. Its alias can be used in QueryFilter.GroupBy and OrderBy.
+// SQLite returns buckets as text.
+type TimeBucket struct {
+	Field string // Time field to truncate.
+	Unit  string // One of hour, day, week, month or year.
+	Alias string // Alias of the bucket in the result.
+}
+
+// SearchRank projects the relevance of the rows to a Search of the same query and columns,
+// the higher the more relevant. Its alias can be used in QueryFilter.OrderBy to order the
+// results by relevance, such as "relevance DESC". When the projection selects nothing else,
+// the rank is selected along with all the columns of the model.
+type SearchRank struct {
+	Query   string   // Text searched.
+	Columns []string // Columns searched.
+	Alias   string   // Alias of the rank in the result.
 }
 
 // ConditionalProjection allows for conditional logic in field values.
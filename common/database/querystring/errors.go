@@ -0,0 +1,53 @@
+package querystring
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidQuery is matched by the validation errors returned by Parse
+var ErrInvalidQuery = errors.New("querystring: invalid query")
+
+// ParameterError describes why a query string parameter was rejected
+type ParameterError struct {
+	// Parameter is the rejected parameter, such as filter[price][gte]
+	Parameter string `json:"parameter"`
+	Message   string `json:"message"`
+}
+
+// ValidationError lists every rejected parameter of a query string. It matches ErrInvalidQuery
+// and is meant to be returned to the client as is, with StatusCode as the HTTP status.
+type ValidationError struct {
+	Errors []ParameterError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Parameter + ": " + err.Message
+	}
+	return ErrInvalidQuery.Error() + ": " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidQuery
+}
+
+// StatusCode returns the HTTP status of the error, 400 Bad Request
+func (e *ValidationError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// add records a rejected parameter
+func (e *ValidationError) add(parameter, message string) {
+	e.Errors = append(e.Errors, ParameterError{Parameter: parameter, Message: message})
+}
+
+// err returns the validation error if any parameter was rejected, nil otherwise
+func (e *ValidationError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
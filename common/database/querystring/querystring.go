@@ -0,0 +1,380 @@
+// Package querystring parses the filtering, sorting and paging parameters of list endpoints
+// into a database.QueryFilter, such as
+//
+//	?filter[status]=paid&filter[price][gte]=10&sort=-created_at&page[size]=20
+//
+// Only the fields and operators allowed by the Resource are accepted, and filter values are
+// parsed into the type of their field before reaching the database. Every rejected parameter
+// is reported in a single ValidationError, meant for a 400 Bad Request response.
+package querystring
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+)
+
+// Operator is a filter operator, given as filter[field][operator]=value
+type Operator string
+
+const (
+	// Eq matches equal values, it is the operator of filter[field]=value
+	Eq  Operator = "eq"
+	Ne  Operator = "ne"
+	Gt  Operator = "gt"
+	Gte Operator = "gte"
+	Lt  Operator = "lt"
+	Lte Operator = "lte"
+
+	// In matches any of the comma separated values, NotIn none of them
+	In    Operator = "in"
+	NotIn Operator = "nin"
+
+	// Contains and Prefix match strings ignoring case, wildcards match literally
+	Contains Operator = "contains"
+	Prefix   Operator = "prefix"
+
+	// Null matches NULL values for true and other values for false
+	Null Operator = "null"
+)
+
+// Type is the type filter values of a field are parsed into
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Float
+	Bool
+
+	// Time values are RFC 3339 timestamps or dates (2006-01-02)
+	Time
+)
+
+// Field is a field of a resource exposed to query strings
+type Field struct {
+	// Column is the column of the model the field maps to, defaults to the field's name
+	Column string
+
+	// Type is the type of the field's values, String by default
+	Type Type
+
+	// Operators lists the filter operators allowed on the field, it can not be filtered on without
+	Operators []Operator
+
+	// Sortable allows sorting on the field
+	Sortable bool
+}
+
+// Resource is the allowlist of the fields of a resource that list requests may filter and sort on
+type Resource struct {
+	// Fields maps the names used in query strings to the fields
+	Fields map[string]Field
+
+	// DefaultSort is the sort used when the query has none, in query string form (-created_at)
+	DefaultSort string
+
+	// DefaultPageSize is the page size used when the query has none (20), MaxPageSize is the
+	// largest accepted page size (100)
+	DefaultPageSize int
+	MaxPageSize     int
+
+	// MaxValues is the largest number of values of the In and NotIn operators (100)
+	MaxValues int
+}
+
+// Parse builds the query filter of a list request out of its query string parameters. Parameters
+// other than filter, sort and page are left to the caller. The returned error is a
+// *ValidationError listing every rejected parameter.
+func (r Resource) Parse(query url.Values) (database.QueryFilter, error) {
+	r = r.withDefaults()
+	verr := &ValidationError{}
+
+	qf := database.QueryFilter{Limit: r.DefaultPageSize}
+	var exprs []database.Expr
+	sort := r.DefaultSort
+	pageNumber := 0
+
+	// Sorted keys make both the filter and the errors deterministic
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		family, segments, ok := parseKey(key)
+		if !ok {
+			continue
+		}
+
+		values := query[key]
+		if len(values) != 1 {
+			verr.add(key, "must be given once")
+			continue
+		}
+		value := values[0]
+
+		switch family {
+		case "filter":
+			expr, err := r.filter(segments, value)
+			if err != nil {
+				verr.add(key, err.Error())
+				continue
+			}
+			exprs = append(exprs, expr)
+		case "sort":
+			if segments != nil {
+				verr.add(key, "unknown parameter")
+				continue
+			}
+			sort = value
+		case "page":
+			switch {
+			case len(segments) != 1:
+				verr.add(key, "unknown parameter")
+			case segments[0] == "size":
+				size, err := strconv.Atoi(value)
+				if err != nil || size < 1 || size > r.MaxPageSize {
+					verr.add(key, fmt.Sprintf("must be an integer between 1 and %d", r.MaxPageSize))
+					continue
+				}
+				qf.Limit = size
+			case segments[0] == "number":
+				number, err := strconv.Atoi(value)
+				if err != nil || number < 1 {
+					verr.add(key, "must be a positive integer")
+					continue
+				}
+				pageNumber = number
+			case segments[0] == "cursor":
+				qf.Cursor = value
+			default:
+				verr.add(key, "unknown parameter")
+			}
+		}
+	}
+
+	if pageNumber > 0 && qf.Cursor != "" {
+		verr.add("page[number]", "can not be combined with page[cursor]")
+	}
+	if pageNumber > 1 {
+		qf.Offset = (pageNumber - 1) * qf.Limit
+	}
+
+	orderBy, err := r.sort(sort)
+	if err != nil {
+		verr.add("sort", err.Error())
+	}
+	qf.OrderBy = orderBy
+
+	if len(exprs) > 0 {
+		qf.Where = database.And(exprs...)
+	}
+
+	if err := verr.err(); err != nil {
+		return database.QueryFilter{}, err
+	}
+	return qf, nil
+}
+
+func (r Resource) withDefaults() Resource {
+	if r.DefaultPageSize <= 0 {
+		r.DefaultPageSize = 20
+	}
+	if r.MaxPageSize <= 0 {
+		r.MaxPageSize = 100
+	}
+	if r.MaxValues <= 0 {
+		r.MaxValues = 100
+	}
+	r.DefaultPageSize = min(r.DefaultPageSize, r.MaxPageSize)
+	return r
+}
+
+// parseKey splits a parameter such as filter[price][gte] into its family and bracketed
+// segments, segments is nil for a parameter without brackets
+func parseKey(key string) (string, []string, bool) {
+	family, rest, bracketed := strings.Cut(key, "[")
+	switch family {
+	case "filter", "sort", "page":
+	default:
+		return "", nil, false
+	}
+	if !bracketed {
+		return family, nil, true
+	}
+
+	segments := []string{}
+	rest = "[" + rest
+	for rest != "" {
+		if rest[0] != '[' {
+			return family, []string{}, true
+		}
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return family, []string{}, true
+		}
+		segments = append(segments, rest[1:end])
+		rest = rest[end+1:]
+	}
+	return family, segments, true
+}
+
+// filter builds the expression of a filter[field] or filter[field][operator] parameter
+func (r Resource) filter(segments []string, value string) (database.Expr, error) {
+	if len(segments) == 0 || len(segments) > 2 || segments[0] == "" {
+		return nil, errors.New("must be filter[field] or filter[field][operator]")
+	}
+
+	name := segments[0]
+	field, ok := r.Fields[name]
+	if !ok || len(field.Operators) == 0 {
+		return nil, fmt.Errorf("can not filter on %q", name)
+	}
+
+	op := Eq
+	if len(segments) == 2 {
+		op = Operator(segments[1])
+	}
+	if !slices.Contains(field.Operators, op) {
+		return nil, fmt.Errorf("operator %q is not allowed on %q", op, name)
+	}
+
+	column := field.Column
+	if column == "" {
+		column = name
+	}
+
+	switch op {
+	case In, NotIn:
+		raw := strings.Split(value, ",")
+		if len(raw) > r.MaxValues {
+			return nil, fmt.Errorf("at most %d values are allowed", r.MaxValues)
+		}
+		values := make([]any, len(raw))
+		for i, v := range raw {
+			parsed, err := field.Type.parse(v)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = parsed
+		}
+		if op == In {
+			return database.In(column, values...), nil
+		}
+		return database.NotIn(column, values...), nil
+	case Contains, Prefix:
+		if field.Type != String {
+			return nil, fmt.Errorf("operator %q only applies to text", op)
+		}
+		if op == Contains {
+			return database.IContains(column, value), nil
+		}
+		return database.IHasPrefix(column, value), nil
+	case Null:
+		isNull, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean %q", value)
+		}
+		if isNull {
+			return database.IsNull(column), nil
+		}
+		return database.Not(database.IsNull(column)), nil
+	}
+
+	parsed, err := field.Type.parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case Eq:
+		return database.Eq(column, parsed), nil
+	case Ne:
+		return database.Ne(column, parsed), nil
+	case Gt:
+		return database.Gt(column, parsed), nil
+	case Gte:
+		return database.Gte(column, parsed), nil
+	case Lt:
+		return database.Lt(column, parsed), nil
+	case Lte:
+		return database.Lte(column, parsed), nil
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+}
+
+// sort translates a sort parameter such as -created_at,name to an ORDER BY expression
+func (r Resource) sort(sort string) (string, error) {
+	if sort == "" {
+		return "", nil
+	}
+
+	var terms []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(sort, ",") {
+		direction := "ASC"
+		if strings.HasPrefix(name, "-") {
+			name, direction = name[1:], "DESC"
+		}
+
+		field, ok := r.Fields[name]
+		if !ok || !field.Sortable {
+			return "", fmt.Errorf("can not sort on %q", name)
+		}
+		if seen[name] {
+			return "", fmt.Errorf("%q is sorted on more than once", name)
+		}
+		seen[name] = true
+
+		column := field.Column
+		if column == "" {
+			column = name
+		}
+		terms = append(terms, column+" "+direction)
+	}
+	return strings.Join(terms, ", "), nil
+}
+
+// parse parses a filter value into the type
+func (t Type) parse(value string) (any, error) {
+	switch t {
+	case Int:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", value)
+		}
+		return v, nil
+	case Float:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", value)
+		}
+		return v, nil
+	case Bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean %q", value)
+		}
+		return v, nil
+	case Time:
+		v, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			v, err = time.Parse(time.DateOnly, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q, expected RFC 3339 or a date", value)
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,348 @@
+package querystring_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+	"github.com/swarit-pandey/e-commerce/common/database/querystring"
+)
+
+var records = querystring.Resource{
+	Fields: map[string]querystring.Field{
+		"name": {
+			Operators: []querystring.Operator{querystring.Eq, querystring.Ne, querystring.Contains, querystring.Prefix},
+			Sortable:  true,
+		},
+		"category": {
+			Operators: []querystring.Operator{querystring.Eq, querystring.In, querystring.NotIn},
+		},
+		"score": {
+			Type:      querystring.Int,
+			Operators: []querystring.Operator{querystring.Eq, querystring.Gt, querystring.Gte, querystring.Lt, querystring.Lte, querystring.In},
+			Sortable:  true,
+		},
+		"rating": {
+			Type:      querystring.Float,
+			Operators: []querystring.Operator{querystring.Gte, querystring.Null},
+		},
+		"created": {
+			Column:    "created_at",
+			Type:      querystring.Time,
+			Operators: []querystring.Operator{querystring.Gte},
+			Sortable:  true,
+		},
+		"id": {
+			Type:     querystring.Int,
+			Sortable: true,
+		},
+	},
+	DefaultSort: "id",
+	MaxValues:   3,
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  database.QueryFilter
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  database.QueryFilter{OrderBy: "id ASC", Limit: 20},
+		},
+		{
+			name:  "equality",
+			query: "filter[name]=alpha",
+			want:  database.QueryFilter{Where: database.And(database.Eq("name", "alpha")), OrderBy: "id ASC", Limit: 20},
+		},
+		{
+			name:  "typed operators",
+			query: "filter[score][gte]=10&filter[score][lt]=30&filter[rating][gte]=2.5",
+			want: database.QueryFilter{
+				Where: database.And(
+					database.Gte("rating", 2.5),
+					database.Gte("score", int64(10)),
+					database.Lt("score", int64(30)),
+				),
+				OrderBy: "id ASC",
+				Limit:   20,
+			},
+		},
+		{
+			name:  "value lists",
+			query: "filter[category][in]=fruit,nuts&filter[score][in]=10,20",
+			want: database.QueryFilter{
+				Where: database.And(
+					database.In("category", "fruit", "nuts"),
+					database.In("score", int64(10), int64(20)),
+				),
+				OrderBy: "id ASC",
+				Limit:   20,
+			},
+		},
+		{
+			name:  "text operators",
+			query: "filter[name][contains]=ph&filter[category][nin]=veggie",
+			want: database.QueryFilter{
+				Where: database.And(
+					database.NotIn("category", "veggie"),
+					database.IContains("name", "ph"),
+				),
+				OrderBy: "id ASC",
+				Limit:   20,
+			},
+		},
+		{
+			name:  "null",
+			query: "filter[rating][null]=false",
+			want:  database.QueryFilter{Where: database.And(database.Not(database.IsNull("rating"))), OrderBy: "id ASC", Limit: 20},
+		},
+		{
+			name:  "time column",
+			query: "filter[created][gte]=2024-05-01",
+			want: database.QueryFilter{
+				Where:   database.And(database.Gte("created_at", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))),
+				OrderBy: "id ASC",
+				Limit:   20,
+			},
+		},
+		{
+			name:  "sort",
+			query: "sort=-score,name",
+			want:  database.QueryFilter{OrderBy: "score DESC, name ASC", Limit: 20},
+		},
+		{
+			name:  "sort on a column",
+			query: "sort=-created",
+			want:  database.QueryFilter{OrderBy: "created_at DESC", Limit: 20},
+		},
+		{
+			name:  "page number",
+			query: "page[size]=10&page[number]=3",
+			want:  database.QueryFilter{OrderBy: "id ASC", Limit: 10, Offset: 20},
+		},
+		{
+			name:  "page cursor",
+			query: "page[size]=100&page[cursor]=abc",
+			want:  database.QueryFilter{OrderBy: "id ASC", Limit: 100, Cursor: "abc"},
+		},
+		{
+			name:  "other parameters",
+			query: "include=addresses&fields=name",
+			want:  database.QueryFilter{OrderBy: "id ASC", Limit: 20},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatalf("parse query: %v", err)
+			}
+			got, err := records.Parse(query)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []querystring.ParameterError
+	}{
+		{
+			name:  "field not allowed",
+			query: "filter[password]=secret",
+			want:  []querystring.ParameterError{{Parameter: "filter[password]", Message: `can not filter on "password"`}},
+		},
+		{
+			name:  "field without operators",
+			query: "filter[id]=1",
+			want:  []querystring.ParameterError{{Parameter: "filter[id]", Message: `can not filter on "id"`}},
+		},
+		{
+			name:  "operator not allowed",
+			query: "filter[name][gt]=a",
+			want:  []querystring.ParameterError{{Parameter: "filter[name][gt]", Message: `operator "gt" is not allowed on "name"`}},
+		},
+		{
+			name:  "malformed filter",
+			query: "filter[score][gte][x]=1",
+			want: []querystring.ParameterError{{
+				Parameter: "filter[score][gte][x]",
+				Message:   "must be filter[field] or filter[field][operator]",
+			}},
+		},
+		{
+			name:  "invalid value",
+			query: "filter[score][gte]=ten",
+			want:  []querystring.ParameterError{{Parameter: "filter[score][gte]", Message: `invalid integer "ten"`}},
+		},
+		{
+			name:  "invalid time",
+			query: "filter[created][gte]=yesterday",
+			want: []querystring.ParameterError{{
+				Parameter: "filter[created][gte]",
+				Message:   `invalid time "yesterday", expected RFC 3339 or a date`,
+			}},
+		},
+		{
+			name:  "too many values",
+			query: "filter[category][in]=a,b,c,d",
+			want:  []querystring.ParameterError{{Parameter: "filter[category][in]", Message: "at most 3 values are allowed"}},
+		},
+		{
+			name:  "repeated parameter",
+			query: "filter[name]=a&filter[name]=b",
+			want:  []querystring.ParameterError{{Parameter: "filter[name]", Message: "must be given once"}},
+		},
+		{
+			name:  "sort not allowed",
+			query: "sort=category",
+			want:  []querystring.ParameterError{{Parameter: "sort", Message: `can not sort on "category"`}},
+		},
+		{
+			name:  "sort twice",
+			query: "sort=score,-score",
+			want:  []querystring.ParameterError{{Parameter: "sort", Message: `"score" is sorted on more than once`}},
+		},
+		{
+			name:  "page size too large",
+			query: "page[size]=101",
+			want:  []querystring.ParameterError{{Parameter: "page[size]", Message: "must be an integer between 1 and 100"}},
+		},
+		{
+			name:  "page size zero",
+			query: "page[size]=0",
+			want:  []querystring.ParameterError{{Parameter: "page[size]", Message: "must be an integer between 1 and 100"}},
+		},
+		{
+			name:  "page number and cursor",
+			query: "page[number]=2&page[cursor]=abc",
+			want:  []querystring.ParameterError{{Parameter: "page[number]", Message: "can not be combined with page[cursor]"}},
+		},
+		{
+			name:  "unknown page parameter",
+			query: "page[offset]=10",
+			want:  []querystring.ParameterError{{Parameter: "page[offset]", Message: "unknown parameter"}},
+		},
+		{
+			name:  "every rejected parameter",
+			query: "filter[password]=secret&page[size]=-1&sort=category",
+			want: []querystring.ParameterError{
+				{Parameter: "filter[password]", Message: `can not filter on "password"`},
+				{Parameter: "page[size]", Message: "must be an integer between 1 and 100"},
+				{Parameter: "sort", Message: `can not sort on "category"`},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatalf("parse query: %v", err)
+			}
+			qf, err := records.Parse(query)
+			if !errors.Is(err, querystring.ErrInvalidQuery) {
+				t.Fatalf("got %v, want ErrInvalidQuery", err)
+			}
+			if !reflect.DeepEqual(qf, database.QueryFilter{}) {
+				t.Errorf("query filter of a rejected query: got %+v", qf)
+			}
+
+			var verr *querystring.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("got %T, want *ValidationError", err)
+			}
+			if !reflect.DeepEqual(verr.Errors, test.want) {
+				t.Errorf("errors: got %+v, want %+v", verr.Errors, test.want)
+			}
+			if verr.StatusCode() != http.StatusBadRequest {
+				t.Errorf("status: got %d, want %d", verr.StatusCode(), http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestValidationErrorJSON(t *testing.T) {
+	_, err := records.Parse(url.Values{"filter[score]": {"ten"}})
+
+	body, jerr := json.Marshal(err)
+	if jerr != nil {
+		t.Fatalf("marshal: %v", jerr)
+	}
+	want := `{"errors":[{"parameter":"filter[score]","message":"invalid integer \"ten\""}]}`
+	if string(body) != want {
+		t.Errorf("got %s, want %s", body, want)
+	}
+	if want := `querystring: invalid query: filter[score]: invalid integer "ten"`; err.Error() != want {
+		t.Errorf("message: got %q, want %q", err.Error(), want)
+	}
+}
+
+// The parsed filters are accepted by the repositories and match what they describe
+func TestParseQueries(t *testing.T) {
+	ctx := context.Background()
+	repo := databasetest.SQLiteRecords(t)
+
+	for _, record := range []databasetest.Record{
+		{Name: "alpha", Category: "fruit", Score: 10},
+		{Name: "Bravo", Category: "fruit", Score: 20},
+		{Name: "charlie", Category: "veggie", Score: 20},
+		{Name: "delta", Category: "nuts", Score: 30},
+	} {
+		if err := repo.Create(ctx, &record); err != nil {
+			t.Fatalf("create %s: %v", record.Name, err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"filter[score][gte]=20&sort=-score,name", []string{"delta", "Bravo", "charlie"}},
+		{"filter[category][in]=fruit,nuts&filter[name][prefix]=b", []string{"Bravo"}},
+		{"filter[name][contains]=A&sort=-id&page[size]=2", []string{"delta", "charlie"}},
+		{"page[size]=2&page[number]=2", []string{"charlie", "delta"}},
+	}
+
+	for _, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatalf("parse query: %v", err)
+		}
+		qf, err := records.Parse(query)
+		if err != nil {
+			t.Fatalf("parse %s: %v", test.query, err)
+		}
+		got, err := repo.List(ctx, qf, nil)
+		if err != nil {
+			t.Fatalf("list %s: %v", test.query, err)
+		}
+
+		var names []string
+		for _, r := range got {
+			names = append(names, r.Name)
+		}
+		if !slices.Equal(names, test.want) {
+			t.Errorf("%s: got %v, want %v", test.query, names, test.want)
+		}
+	}
+}
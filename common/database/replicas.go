@@ -0,0 +1,264 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// replicaCheckInterval is the interval between two health checks of the replicas
+	replicaCheckInterval = 5 * time.Second
+
+	// replicaCheckTimeout bounds a single health check of a replica
+	replicaCheckTimeout = 2 * time.Second
+)
+
+var errReplicaNotConnected = errors.New("database: replica is not connected yet")
+
+type readYourWritesKey struct{}
+
+// ReadYourWrites returns a context whose queries are all served by the primary, so that
+// reads observe the writes made before them regardless of the replication lag
+func ReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, true)
+}
+
+// readsFromPrimary reports if the reads made with ctx must be served by the primary
+func readsFromPrimary(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	primary, _ := ctx.Value(readYourWritesKey{}).(bool)
+	return primary
+}
+
+// replicaSet routes reads to the healthy read replicas of a database. Reads are balanced
+// round-robin and served by the primary when no replica is healthy. Writes, reads within
+// transactions, locking reads and raw SQL always go to the primary.
+type replicaSet struct {
+	config   *Config
+	replicas []*replica
+	next     atomic.Uint64
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// replica is a single read replica, its pool is opened by the health checks so
+// that replicas which can not be reached on startup join once they can
+type replica struct {
+	Replica
+	db      atomic.Pointer[sql.DB]
+	healthy atomic.Bool
+}
+
+func (r *replica) name() string {
+	return r.ConnectionString + ":" + r.Port
+}
+
+// newReplicaSet connects to the replicas of the config and starts monitoring their health
+func newReplicaSet(config *Config) (*replicaSet, error) {
+	rs := &replicaSet{
+		config: config,
+		done:   make(chan struct{}),
+	}
+
+	for _, r := range config.Replicas {
+		// Invalid configurations fail right away rather than in the health checks
+		_, err := newDialector(config, r.ConnectionString, r.Port)
+		if err != nil {
+			return nil, fmt.Errorf("database: replica %s: %w", r.ConnectionString, err)
+		}
+		rs.replicas = append(rs.replicas, &replica{Replica: r})
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	rs.stop = stop
+	rs.check(ctx)
+	go rs.watch(ctx)
+
+	return rs, nil
+}
+
+// open opens the connection pool of a replica
+func (rs *replicaSet) open(r *replica) (*sql.DB, error) {
+	dialector, err := newDialector(rs.config, r.ConnectionString, r.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		closeGORM(db)
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	configurePool(sqlDB, rs.config)
+	return sqlDB, nil
+}
+
+// register installs the callbacks routing the queries of db
+func (rs *replicaSet) register(db *gorm.DB) error {
+	return errors.Join(
+		db.Callback().Query().Before("*").Register("database:route_read", rs.routeRead),
+		db.Callback().Row().Before("*").Register("database:route_read", rs.routeRead),
+		db.Callback().Create().Before("*").Register("database:route_write", rs.routeWrite),
+		db.Callback().Update().Before("*").Register("database:route_write", rs.routeWrite),
+		db.Callback().Delete().Before("*").Register("database:route_write", rs.routeWrite),
+		db.Callback().Raw().Before("*").Register("database:route_write", rs.routeWrite),
+	)
+}
+
+func (rs *replicaSet) routeRead(db *gorm.DB) {
+	stmt := db.Statement
+	if inTransaction(stmt.ConnPool) {
+		return
+	}
+
+	// Statements are reused when chaining, so a previous read may have routed this one
+	stmt.ConnPool = db.Config.ConnPool
+
+	if readsFromPrimary(stmt.Context) {
+		return
+	}
+	if _, locking := stmt.Clauses["FOR"]; locking {
+		return
+	}
+	// Raw SQL is not known to be a plain read, and GORM's schema migrator inspects the
+	// schema through it, so it stays on the primary
+	if stmt.SQL.Len() > 0 {
+		return
+	}
+
+	if replica := rs.pick(); replica != nil {
+		stmt.ConnPool = replica
+	}
+}
+
+func (rs *replicaSet) routeWrite(db *gorm.DB) {
+	if !inTransaction(db.Statement.ConnPool) {
+		db.Statement.ConnPool = db.Config.ConnPool
+	}
+}
+
+// pick returns the next healthy replica, or nil if none is healthy
+func (rs *replicaSet) pick() *sql.DB {
+	n := uint64(len(rs.replicas))
+	start := rs.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		r := rs.replicas[(start+i)%n]
+		if r.healthy.Load() {
+			return r.db.Load()
+		}
+	}
+	return nil
+}
+
+// watch checks the health of the replicas until ctx is done
+func (rs *replicaSet) watch(ctx context.Context) {
+	defer close(rs.done)
+
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rs.check(ctx)
+		}
+	}
+}
+
+// check pings every replica and updates its health
+func (rs *replicaSet) check(ctx context.Context) {
+	for _, r := range rs.replicas {
+		err := rs.ping(ctx, r)
+		if ctx.Err() != nil {
+			return
+		}
+
+		healthy := err == nil
+		if r.healthy.Swap(healthy) != healthy {
+			if healthy {
+				klog.InfoS("database: replica is healthy", "replica", r.name())
+			} else {
+				klog.ErrorS(err, "database: replica is unhealthy, reads are served by the other replicas", "replica", r.name())
+			}
+		}
+	}
+}
+
+// ping pings a replica, opening its pool first if needed
+func (rs *replicaSet) ping(ctx context.Context, r *replica) error {
+	ctx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+	defer cancel()
+
+	db := r.db.Load()
+	if db == nil {
+		var err error
+		db, err = rs.open(r)
+		if err != nil {
+			return err
+		}
+		r.db.Store(db)
+	}
+	return db.PingContext(ctx)
+}
+
+// pingAll pings every replica, keyed by host:port
+func (rs *replicaSet) pingAll(ctx context.Context) map[string]error {
+	errs := make(map[string]error, len(rs.replicas))
+	for _, r := range rs.replicas {
+		db := r.db.Load()
+		if db == nil {
+			errs[r.name()] = errReplicaNotConnected
+			continue
+		}
+		errs[r.name()] = db.PingContext(ctx)
+	}
+	return errs
+}
+
+// stats returns the pool statistics of every connected replica, keyed by host:port
+func (rs *replicaSet) stats() map[string]PoolStats {
+	stats := make(map[string]PoolStats, len(rs.replicas))
+	for _, r := range rs.replicas {
+		if db := r.db.Load(); db != nil {
+			stats[r.name()] = poolStats(db)
+		}
+	}
+	return stats
+}
+
+// close stops the health checks and disconnects from the replicas
+func (rs *replicaSet) close() error {
+	rs.stop()
+	<-rs.done
+
+	var errs []error
+	for _, r := range rs.replicas {
+		if db := r.db.Load(); db != nil {
+			errs = append(errs, db.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// inTransaction reports if the connection pool of a statement is a transaction
+func inTransaction(pool gorm.ConnPool) bool {
+	_, ok := pool.(gorm.TxCommitter)
+	return ok
+}
@@ -0,0 +1,140 @@
+package database_test
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+	"gorm.io/gorm/clause"
+)
+
+// sqliteFile creates a SQLite database file holding a single record, named after the file
+func sqliteFile(t *testing.T, path string) {
+	t.Helper()
+
+	db, err := database.NewSQLDatabase(&database.Config{Driver: "sqlite", ConnectionString: path})
+	if err != nil {
+		t.Fatalf("connect %s: %v", path, err)
+	}
+	defer db.Disconnect()
+
+	if err := db.Instance().AutoMigrate(&databasetest.Record{}); err != nil {
+		t.Fatalf("migrate %s: %v", path, err)
+	}
+	if err := db.Instance().Create(&databasetest.Record{Name: filepath.Base(path)}).Error; err != nil {
+		t.Fatalf("create in %s: %v", path, err)
+	}
+}
+
+// withReplicas connects to the SQLite database file primary, replicated by the replicas files
+func withReplicas(t *testing.T, primary string, replicas ...string) database.SQLDatabase {
+	t.Helper()
+
+	config := &database.Config{Driver: "sqlite", ConnectionString: primary, ConnectAttempts: 1}
+	for _, replica := range replicas {
+		config.Replicas = append(config.Replicas, database.Replica{ConnectionString: replica})
+	}
+	db, err := database.NewSQLDatabase(config)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Disconnect(); err != nil {
+			t.Errorf("disconnect: %v", err)
+		}
+	})
+	return db
+}
+
+// readNames lists the names of the records read with ctx
+func readNames(t *testing.T, ctx context.Context, records database.Repository[databasetest.Record]) []string {
+	t.Helper()
+
+	got, err := records.List(ctx, database.QueryFilter{}, nil)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var names []string
+	for _, r := range got {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func TestReplicaRouting(t *testing.T) {
+	dir := t.TempDir()
+	primary, first, second := filepath.Join(dir, "primary"), filepath.Join(dir, "first"), filepath.Join(dir, "second")
+	for _, path := range []string{primary, first, second} {
+		sqliteFile(t, path)
+	}
+
+	db := withReplicas(t, primary, first, second)
+	records := database.NewSQLHandler[databasetest.Record](db.Instance())
+	ctx := context.Background()
+
+	// Reads are balanced over the replicas
+	var reads []string
+	for i := 0; i < 4; i++ {
+		reads = append(reads, readNames(t, ctx, records)...)
+	}
+	slices.Sort(reads)
+	if want := []string{"first", "first", "second", "second"}; !slices.Equal(reads, want) {
+		t.Errorf("reads: got %v, want %v", reads, want)
+	}
+
+	// Writes, and the reads that must observe them, are served by the primary
+	if err := records.Create(ctx, &databasetest.Record{Name: "written"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if got, want := readNames(t, database.ReadYourWrites(ctx), records), []string{"primary", "written"}; !slices.Equal(got, want) {
+		t.Errorf("read your writes: got %v, want %v", got, want)
+	}
+
+	err := db.RunInTx(ctx, func(tx *database.Tx) error {
+		if got, want := readNames(t, ctx, database.TxHandler[databasetest.Record](tx)), []string{"primary", "written"}; !slices.Equal(got, want) {
+			t.Errorf("transaction read: got %v, want %v", got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("transaction: %v", err)
+	}
+
+	var locked []databasetest.Record
+	if err := db.Instance().WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Find(&locked).Error; err != nil {
+		t.Fatalf("locking read: %v", err)
+	}
+	if len(locked) != 2 {
+		t.Errorf("locking read: got %+v, want the records of the primary", locked)
+	}
+
+	health := db.Health(ctx)
+	if !health.Healthy() || len(health.Replicas) != 2 || health.Replicas[first+":"] != nil || health.Replicas[second+":"] != nil {
+		t.Errorf("health: got %+v", health)
+	}
+	if stats := db.Stats(); len(stats.Replicas) != 2 {
+		t.Errorf("stats: got %+v, want the pools of both replicas", stats)
+	}
+}
+
+// Reads fall back to the primary while no replica can be reached
+func TestReplicaUnavailable(t *testing.T) {
+	dir := t.TempDir()
+	primary, missing := filepath.Join(dir, "primary"), filepath.Join(dir, "missing", "replica")
+	sqliteFile(t, primary)
+
+	db := withReplicas(t, primary, missing)
+	records := database.NewSQLHandler[databasetest.Record](db.Instance())
+
+	if got := readNames(t, context.Background(), records); !slices.Equal(got, []string{"primary"}) {
+		t.Errorf("read: got %v, want the records of the primary", got)
+	}
+
+	health := db.Health(context.Background())
+	if !health.Healthy() || health.Replicas[missing+":"] == nil {
+		t.Errorf("health: got %+v, want a healthy primary and an unreachable replica", health)
+	}
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// RetryPolicy retries operations failing with transient errors, such as deadlocks and
+// serialization failures, waiting an exponentially growing and jittered backoff in between
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, values below 2 disable retries
+	MaxAttempts int
+
+	// InitialBackoff is the wait before the first retry, it is doubled after every
+	// retry up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Jitter is the fraction, between 0 and 1, of every backoff that is randomized so
+	// that conflicting callers do not retry in lockstep
+	Jitter float64
+
+	// Retryable reports if an error is transient, IsRetryable is used when nil. The
+	// error is classified (see ErrDeadlock) before being passed.
+	Retryable func(err error) bool
+
+	// OnRetry, if set, is called before waiting for a retry, with the attempt that
+	// failed (starting at 1), its error and the backoff. It is meant to log and count
+	// retries.
+	OnRetry func(ctx context.Context, attempt int, err error, backoff time.Duration)
+}
+
+// DefaultRetryPolicy returns a policy making up to 3 attempts with a backoff starting at
+// 20ms, suited to retry deadlocks and serialization failures of short transactions
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 20 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Jitter:         0.5,
+	}
+}
+
+// IsRetryable reports if err is a deadlock or a serialization failure, which succeed when
+// the transaction is run again. Locks that were not available are not retried, as waiting
+// for them defeats LockNoWait, policies may opt in with IsRetryableOrLocked.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrDeadlock) || errors.Is(err, ErrSerialization)
+}
+
+// IsRetryableOrLocked reports if err is retryable (see IsRetryable) or a lock that was not
+// available, for the policies of callers locking with a lock timeout rather than waiting
+func IsRetryableOrLocked(err error) bool {
+	return IsRetryable(err) || errors.Is(err, ErrLockNotAvailable)
+}
+
+// Do runs fn until it succeeds, fails with an error that is not retryable, the attempts
+// are exhausted or ctx is done. It returns the error of the last attempt.
+func (p RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !retryable(classifyError(err)) {
+			return err
+		}
+
+		delay := p.jitter(backoff)
+		klog.V(2).InfoS("database: retrying transient failure", "attempt", attempt, "backoff", delay, "err", err)
+		if p.OnRetry != nil {
+			p.OnRetry(ctx, attempt, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// jitter randomizes the Jitter fraction of backoff
+func (p RetryPolicy) jitter(backoff time.Duration) time.Duration {
+	jitter := min(max(p.Jitter, 0), 1)
+	spread := time.Duration(float64(backoff) * jitter)
+	if spread <= 0 {
+		return backoff
+	}
+	return backoff - spread + time.Duration(rand.Int63n(int64(spread)+1))
+}
@@ -0,0 +1,186 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+)
+
+// Unavailable locks are only retried by the policies opting in
+func TestRetryLockNotAvailable(t *testing.T) {
+	policy := database.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	attempts := 0
+	locked := func(ctx context.Context) error {
+		attempts++
+		return database.ErrLockNotAvailable
+	}
+
+	if err := policy.Do(context.Background(), locked); !errors.Is(err, database.ErrLockNotAvailable) || attempts != 1 {
+		t.Errorf("default policy: got %v after %d attempts, want ErrLockNotAvailable after 1", err, attempts)
+	}
+
+	attempts = 0
+	policy.Retryable = database.IsRetryableOrLocked
+	if err := policy.Do(context.Background(), locked); !errors.Is(err, database.ErrLockNotAvailable) || attempts != 3 {
+		t.Errorf("policy retrying locks: got %v after %d attempts, want ErrLockNotAvailable after 3", err, attempts)
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		failures    int
+		err         error
+		attempts    int
+	}{
+		{"first attempt", 3, 0, database.ErrDeadlock, 1},
+		{"recovered", 3, 2, database.ErrDeadlock, 3},
+		{"exhausted", 3, 5, database.ErrDeadlock, 3},
+		{"serialization", 2, 5, database.ErrSerialization, 2},
+		{"driver error", 3, 5, &pgconn.PgError{Code: "40001"}, 3},
+		{"not retryable", 3, 5, database.ErrUniqueViolation, 1},
+		{"unknown", 3, 5, errors.New("boom"), 1},
+		{"single attempt", 1, 5, database.ErrDeadlock, 1},
+		{"no attempts", 0, 5, database.ErrDeadlock, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			retries := 0
+			policy := database.RetryPolicy{
+				MaxAttempts:    test.maxAttempts,
+				InitialBackoff: time.Millisecond,
+				OnRetry: func(ctx context.Context, attempt int, err error, backoff time.Duration) {
+					retries++
+					if attempt != retries || err != test.err {
+						t.Errorf("retry %d: got attempt %d failing with %v", retries, attempt, err)
+					}
+				},
+			}
+
+			attempts := 0
+			err := policy.Do(context.Background(), func(ctx context.Context) error {
+				attempts++
+				if attempts <= test.failures {
+					return test.err
+				}
+				return nil
+			})
+
+			// The error of the last attempt is returned as is
+			var want error
+			if test.failures >= test.attempts {
+				want = test.err
+			}
+			if err != want {
+				t.Errorf("got %v, want %v", err, want)
+			}
+			if attempts != test.attempts || retries != attempts-1 {
+				t.Errorf("got %d attempts and %d retries, want %d attempts", attempts, retries, test.attempts)
+			}
+		})
+	}
+}
+
+// Backoffs double from InitialBackoff up to MaxBackoff
+func TestRetryBackoff(t *testing.T) {
+	var backoffs []time.Duration
+	policy := database.RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     3 * time.Millisecond,
+		OnRetry: func(ctx context.Context, attempt int, err error, backoff time.Duration) {
+			backoffs = append(backoffs, backoff)
+		},
+	}
+	policy.Do(context.Background(), func(ctx context.Context) error {
+		return database.ErrDeadlock
+	})
+
+	want := []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond, 3 * time.Millisecond}
+	if !slices.Equal(backoffs, want) {
+		t.Errorf("got backoffs %v, want %v", backoffs, want)
+	}
+
+	// The jittered fraction is taken off the backoff, which is cut short by the context
+	policy = database.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Hour, Jitter: 0.5}
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		policy.OnRetry = func(ctx context.Context, attempt int, err error, backoff time.Duration) {
+			if backoff < 30*time.Minute || backoff > time.Hour {
+				t.Errorf("jittered backoff: got %v, want between 30m and 1h", backoff)
+			}
+			cancel()
+		}
+
+		attempts := 0
+		err := policy.Do(ctx, func(ctx context.Context) error {
+			attempts++
+			return database.ErrDeadlock
+		})
+		if !errors.Is(err, database.ErrDeadlock) || attempts != 1 {
+			t.Fatalf("canceled backoff: got %v after %d attempts, want ErrDeadlock after 1", err, attempts)
+		}
+	}
+}
+
+func TestRetryBackoffDeadline(t *testing.T) {
+	policy := database.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := policy.Do(ctx, func(ctx context.Context) error {
+		return database.ErrSerialization
+	})
+	if !errors.Is(err, database.ErrSerialization) {
+		t.Errorf("got %v, want the error of the last attempt", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("backoff outlived the context deadline by %v", elapsed)
+	}
+}
+
+// Transactions of handlers are retried as a whole, unless they are nested in another one
+func TestHandlerRetry(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.New(t, &databasetest.Record{}).Instance()
+	policy := database.WithRetryPolicy(database.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	records := database.NewSQLHandler[databasetest.Record](db, policy)
+
+	attempts := 0
+	err := records.RunInTx(ctx, func(tx *database.Tx) error {
+		attempts++
+		if err := database.TxHandler[databasetest.Record](tx).Create(ctx, &databasetest.Record{Name: "alpha"}); err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return &pgconn.PgError{Code: "40P01"}
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("transaction: got %v after %d attempts, want success after 3", err, attempts)
+	}
+	if n, err := records.Count(ctx, database.QueryFilter{}); err != nil || n != 1 {
+		t.Errorf("records of the retried transaction: got %d, %v, want the one of the last attempt", n, err)
+	}
+
+	attempts = 0
+	err = records.RunInTx(ctx, func(tx *database.Tx) error {
+		return database.TxHandler[databasetest.Record](tx, policy).RunInTx(ctx, func(tx *database.Tx) error {
+			attempts++
+			return database.ErrDeadlock
+		})
+	})
+	if !errors.Is(err, database.ErrDeadlock) || attempts != 3 {
+		t.Errorf("nested transaction: got %v after %d attempts, want ErrDeadlock after 3 of the outer one", err, attempts)
+	}
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm/clause"
+)
+
+// searchConfig is the text search configuration of postgres, it splits text on words
+// without stemming, as the columns searched hold names in any language. An index only
+// serves the searches when it is built on the same document as tsvector, such as the GIN
+// indexes of the products and users migrations.
+const searchConfig = "simple"
+
+type searchExpr struct {
+	query   string
+	columns []string
+}
+
+// Search matches rows where all the words of query are found in any of the columns, using
+// the full-text search of the driver: to_tsvector and to_tsquery on postgres, and
+// MATCH ... AGAINST on MySQL, which requires a FULLTEXT index on exactly these columns.
+// Other drivers fall back to case-insensitive LIKE matching of every word. Rows can be
+// ordered by relevance with a SearchRank projection.
+//
+// On MySQL every word is required, but InnoDB does not index the words shorter than
+// innodb_ft_min_token_size (3 by default) nor its stopwords, so a query containing any of
+// them matches no row at all.
+func Search(query string, columns ...string) Expr {
+	return searchExpr{query: query, columns: columns}
+}
+
+func (s searchExpr) build(b *exprBuilder) (clause.Expression, error) {
+	columns, terms, err := b.search(s.query, s.columns)
+	if err != nil {
+		return nil, err
+	}
+	return b.dialect.search(columns, terms)
+}
+
+// search resolves the columns and the words of a search
+func (b *exprBuilder) search(query string, names []string) ([]clause.Column, []string, error) {
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("%w: search requires columns", ErrInvalidFilter)
+	}
+	columns := make([]clause.Column, len(names))
+	for i, name := range names {
+		column, err := b.column(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		columns[i] = column
+	}
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil, fmt.Errorf("%w: search query %q has no words", ErrInvalidFilter, query)
+	}
+	return columns, terms, nil
+}
+
+// searchTerms splits a search query into its lower case words, leaving out punctuation and
+// the operators of the full-text query syntaxes
+func searchTerms(query string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	seen := make(map[string]bool, len(terms))
+	unique := terms[:0]
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
+}
+
+// rank builds a search rank projection, aliased so that it can be ordered by
+func (b *exprBuilder) rank(r SearchRank) (clause.Expression, error) {
+	err := b.alias(r.Alias, "")
+	if err != nil {
+		return nil, err
+	}
+	columns, terms, err := b.search(r.Query, r.Columns)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := b.dialect.searchRank(columns, terms)
+	if err != nil {
+		return nil, err
+	}
+	return clause.Expr{SQL: "? AS ?", Vars: []any{expr, clause.Column{Name: r.Alias}}}, nil
+}
+
+// search matches rows where all the terms are found in any of the columns
+func (d dialect) search(columns []clause.Column, terms []string) (clause.Expression, error) {
+	switch d {
+	case dialectPostgres:
+		return clause.Expr{SQL: "? @@ ?", Vars: []any{tsvector(columns), tsquery(terms)}}, nil
+	case dialectMySQL:
+		return matchAgainst(columns, terms), nil
+	case dialectSQLite, dialectSQLServer:
+		conditions := make([]clause.Expression, len(terms))
+		for i, term := range terms {
+			alternatives := make([]clause.Expression, len(columns))
+			for j, column := range columns {
+				like, err := d.searchLike(column, term)
+				if err != nil {
+					return nil, err
+				}
+				alternatives[j] = like
+			}
+			conditions[i] = joinExpressions(alternatives, true)
+		}
+		return joinExpressions(conditions, false), nil
+	default:
+		return nil, d.unsupported("full-text search")
+	}
+}
+
+// searchRank scores the relevance of rows to a search, the higher the more relevant. The
+// LIKE fallback counts the columns each term is found in.
+func (d dialect) searchRank(columns []clause.Column, terms []string) (clause.Expression, error) {
+	switch d {
+	case dialectPostgres:
+		return clause.Expr{SQL: "ts_rank(?, ?)", Vars: []any{tsvector(columns), tsquery(terms)}}, nil
+	case dialectMySQL:
+		return matchAgainst(columns, terms), nil
+	case dialectSQLite, dialectSQLServer:
+		var sql []string
+		var vars []any
+		for _, term := range terms {
+			for _, column := range columns {
+				like, err := d.searchLike(column, term)
+				if err != nil {
+					return nil, err
+				}
+				sql = append(sql, "CASE WHEN ? THEN 1 ELSE 0 END")
+				vars = append(vars, like)
+			}
+		}
+		return clause.Expr{SQL: "(" + strings.Join(sql, " + ") + ")", Vars: vars}, nil
+	default:
+		return nil, d.unsupported("full-text search")
+	}
+}
+
+// searchLike matches the columns containing term, ignoring case
+func (d dialect) searchLike(column clause.Column, term string) (clause.Expression, error) {
+	return d.like(column, "%"+escapeLike(term)+"%", true)
+}
+
+// tsvector builds the postgres document of the columns, NULL columns are left out
+func tsvector(columns []clause.Column) clause.Expression {
+	sql := make([]string, len(columns))
+	vars := make([]any, len(columns))
+	for i, column := range columns {
+		sql[i] = "coalesce(?, '')"
+		vars[i] = column
+	}
+	return clause.Expr{
+		SQL:  "to_tsvector('" + searchConfig + "', " + strings.Join(sql, " || ' ' || ") + ")",
+		Vars: vars,
+	}
+}
+
+// tsquery builds the postgres query matching all the terms, which are words without
+// operators so that they can not fail to parse
+func tsquery(terms []string) clause.Expression {
+	return clause.Expr{SQL: "to_tsquery('" + searchConfig + "', ?)", Vars: []any{strings.Join(terms, " & ")}}
+}
+
+// matchAgainst builds the MySQL boolean mode search requiring all the terms, which is
+// also its relevance
+func matchAgainst(columns []clause.Column, terms []string) clause.Expression {
+	placeholders := make([]string, len(columns))
+	vars := make([]any, 0, len(columns)+1)
+	for i, column := range columns {
+		placeholders[i] = "?"
+		vars = append(vars, column)
+	}
+	vars = append(vars, "+"+strings.Join(terms, " +"))
+	return clause.Expr{SQL: "MATCH (" + strings.Join(placeholders, ", ") + ") AGAINST (? IN BOOLEAN MODE)", Vars: vars}
+}
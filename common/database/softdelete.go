@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// deletedAtField returns the gorm.DeletedAt field of the model, or nil when the model
+// does not support soft delete
+func deletedAtField(sch *schema.Schema) *schema.Field {
+	for _, field := range sch.Fields {
+		if field.FieldType == deletedAtType && field.DBName != "" {
+			return field
+		}
+	}
+	return nil
+}
+
+// softDeleteColumn returns the deleted_at column of T or ErrSoftDeleteUnsupported
+func (r *SQLHandler[T]) softDeleteColumn() (clause.Column, error) {
+	sch, err := parseSchema(r.db, new(T))
+	if err != nil {
+		return clause.Column{}, err
+	}
+
+	field := deletedAtField(sch)
+	if field == nil {
+		return clause.Column{}, fmt.Errorf("%w: %s", ErrSoftDeleteUnsupported, sch.Name)
+	}
+	return clause.Column{Table: clause.CurrentTable, Name: field.DBName}, nil
+}
+
+// Restore implements `Restore()` from Repository interface
+func (r *SQLHandler[T]) Restore(ctx context.Context, qf QueryFilter) error {
+	column, err := r.softDeleteColumn()
+	if err != nil {
+		return err
+	}
+
+	return r.retry(ctx, func(ctx context.Context) error {
+		db := r.db.WithContext(ctx).Unscoped().Model(new(T))
+		db = applyQueryFilters(db, qf)
+		db = db.Where(clause.Expr{SQL: "? IS NOT NULL", Vars: []any{column}})
+		err := classifyError(db.Update(column.Name, nil).Error)
+		if errors.Is(err, ErrUniqueViolation) {
+			return fmt.Errorf("%w: %w", ErrRestoreConflict, err)
+		}
+		return err
+	})
+}
+
+// ListDeleted implements `ListDeleted()` from Repository interface
+func (r *SQLHandler[T]) ListDeleted(ctx context.Context, qf QueryFilter, p *Projection) ([]T, error) {
+	column, err := r.softDeleteColumn()
+	if err != nil {
+		return nil, err
+	}
+
+	var entities []T
+	err = r.retry(ctx, func(ctx context.Context) error {
+		db := r.db.WithContext(ctx).Unscoped().Model(new(T))
+		db = applyProjections(db, p)
+		db = applyQueryFilters(db, qf)
+		db = applyPreloads(db, qf.Preload)
+		db = db.Where(clause.Expr{SQL: "? IS NOT NULL", Vars: []any{column}})
+		return classifyError(db.Find(&entities).Error)
+	})
+	return entities, err
+}
+
+// Purge implements `Purge()` from Repository interface
+func (r *SQLHandler[T]) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	column, err := r.softDeleteColumn()
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	cutoff := time.Now().Add(-olderThan)
+	err = r.retry(ctx, func(ctx context.Context) error {
+		result := r.db.WithContext(ctx).Unscoped().
+			Where(clause.Lt{Column: column, Value: cutoff}).
+			Delete(new(T))
+		purged = result.RowsAffected
+		return classifyError(result.Error)
+	})
+	return purged, err
+}
@@ -2,59 +2,89 @@ package database
 
 import (
 	"context"
-	"fmt"
-
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"k8s.io/klog/v2"
 )
 
 var _ Repository[any] = &SQLHandler[any]{}
 
 // SQLHandler wraps a GORM DB connection, providing CRUD operations for a generic type T.
 type SQLHandler[T any] struct {
-	db *gorm.DB
+	db   *gorm.DB
+	tx   *Tx
+	opts options
 }
 
 // NewSQLHandler creates a new instance of SQLHandler for the given GORM DB connection.
-func NewSQLHandler[T any](db *gorm.DB) *SQLHandler[T] {
-	return &SQLHandler[T]{db: db}
+// The tenancy callbacks are registered on db if it is missing them, see RegisterTenancy.
+func NewSQLHandler[T any](db *gorm.DB, opts ...Option) *SQLHandler[T] {
+	if err := RegisterTenancy(db); err != nil {
+		klog.ErrorS(err, "database: failed to register tenancy callbacks")
+	}
+	return &SQLHandler[T]{db: db, opts: newOptions(opts)}
 }
 
 // Create inserts a new entity of type T into the database.
 func (r *SQLHandler[T]) Create(ctx context.Context, entity *T) error {
-	return r.db.WithContext(ctx).Create(entity).Error
+	return r.retry(ctx, func(ctx context.Context) error {
+		return classifyError(r.db.WithContext(ctx).Create(entity).Error)
+	})
 }
 
 // Update modifies entities of type T in the database based on the provided QueryFilter.
+// Models with a Version field are updated with optimistic concurrency control.
 func (r *SQLHandler[T]) Update(ctx context.Context, qf QueryFilter) error {
-	db := r.db.WithContext(ctx).Model(new(T))
-	db = applyQueryFilters(db, qf)
-	return db.Updates(qf.UpdateMap).Error
+	sch, err := parseSchema(r.db, new(T))
+	if err != nil {
+		return err
+	}
+
+	return r.retry(ctx, func(ctx context.Context) error {
+		if field := versionField(sch); field != nil {
+			return r.updateVersioned(ctx, qf, sch, field)
+		}
+
+		db := r.db.WithContext(ctx).Model(new(T))
+		db = applyQueryFilters(db, qf)
+		return classifyError(db.Updates(qf.UpdateMap).Error)
+	})
 }
 
 // Delete removes entities of type T from the database based on the provided QueryFilter.
 func (r *SQLHandler[T]) Delete(ctx context.Context, qf QueryFilter) error {
-	db := r.db.WithContext(ctx).Model(new(T))
-	db = applyQueryFilters(db, qf)
-	return db.Delete(new(T)).Error
+	return r.retry(ctx, func(ctx context.Context) error {
+		db := r.db.WithContext(ctx).Model(new(T))
+		db = applyQueryFilters(db, qf)
+		return classifyError(db.Delete(new(T)).Error)
+	})
 }
 
 // Get retrieves a single entity of type T from the database matching the QueryFilter and Projection.
 func (r *SQLHandler[T]) Get(ctx context.Context, qf QueryFilter, p *Projection) (*T, error) {
 	var entity T
-	db := r.db.WithContext(ctx).Model(new(T))
-	db = applyQueryFilters(db, qf)
-	db = applyProjections(db, p)
-	err := db.First(&entity).Error
+	err := r.retry(ctx, func(ctx context.Context) error {
+		db := r.db.WithContext(ctx).Model(new(T))
+		db = applyProjections(db, p)
+		db = applyQueryFilters(db, qf)
+		db = applyPreloads(db, qf.Preload)
+		db = applyLock(db, qf.Lock)
+		return classifyError(db.First(&entity).Error)
+	})
 	return &entity, err
 }
 
 // List retrieves multiple entities of type T matching the QueryFilter and Projection.
 func (r *SQLHandler[T]) List(ctx context.Context, qf QueryFilter, p *Projection) ([]T, error) {
 	var entities []T
-	db := r.db.WithContext(ctx).Model(new(T))
-	db = applyQueryFilters(db, qf)
-	db = applyProjections(db, p)
-	err := db.Find(&entities).Error
+	err := r.retry(ctx, func(ctx context.Context) error {
+		db := r.db.WithContext(ctx).Model(new(T))
+		db = applyProjections(db, p)
+		db = applyQueryFilters(db, qf)
+		db = applyPreloads(db, qf.Preload)
+		db = applyLock(db, qf.Lock)
+		return classifyError(db.Find(&entities).Error)
+	})
 	return entities, err
 }
 
@@ -63,31 +93,72 @@ func (r *SQLHandler[T]) Batch(ctx context.Context, columnName string, ids []any)
 	var entities []T
 	db := r.db.WithContext(ctx).Model(new(T))
 
-	err := db.Where(fmt.Sprintf("%s IN (?)", columnName), ids).Find(&entities).Error
+	b, err := newQueryBuilder(db)
+	if err != nil {
+		return nil, err
+	}
+	column, err := b.column(columnName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.retry(ctx, func(ctx context.Context) error {
+		return classifyError(db.WithContext(ctx).Where(clause.IN{Column: column, Values: ids}).Find(&entities).Error)
+	})
 	return entities, err
 }
 
 // Count returns the count of entities of type T matching the QueryFilter.
 func (r *SQLHandler[T]) Count(ctx context.Context, qf QueryFilter) (int64, error) {
 	var count int64
-	db := r.db.WithContext(ctx).Model(new(T))
-	db = applyQueryFilters(db, qf)
-	err := db.Count(&count).Error
+	err := r.retry(ctx, func(ctx context.Context) error {
+		db := r.db.WithContext(ctx).Model(new(T))
+		db = applyQueryFilters(db, qf)
+		return classifyError(db.Count(&count).Error)
+	})
 	return count, err
 }
 
 // Exists checks if any entity of type T matches the QueryFilter.
 func (r *SQLHandler[T]) Exists(ctx context.Context, qf QueryFilter) (bool, error) {
 	var count int64
-	db := r.db.WithContext(ctx).Model(new(T))
-	db = applyQueryFilters(db, qf)
-	err := db.Limit(1).Count(&count).Error
+	err := r.retry(ctx, func(ctx context.Context) error {
+		db := r.db.WithContext(ctx).Model(new(T))
+		db = applyQueryFilters(db, qf)
+		return classifyError(db.Limit(1).Count(&count).Error)
+	})
 	return count > 0, err
 }
 
 // All retrieves all entities of type T from the database.
 func (r *SQLHandler[T]) All(ctx context.Context) ([]T, error) {
 	var entities []T
-	err := r.db.WithContext(ctx).Find(&entities).Error
+	err := r.retry(ctx, func(ctx context.Context) error {
+		return classifyError(r.db.WithContext(ctx).Find(&entities).Error)
+	})
 	return entities, err
 }
+
+// RunInTx runs fn in a new transaction, or in a savepoint when the handler is already tx-bound.
+func (r *SQLHandler[T]) RunInTx(ctx context.Context, fn func(tx *Tx) error) error {
+	if r.tx != nil {
+		return classifyError(r.tx.RunInTx(ctx, fn))
+	}
+	return r.retry(ctx, func(ctx context.Context) error {
+		return classifyError(runInTx(ctx, r.db, fn))
+	})
+}
+
+// retry runs fn under the retry policy of the handler. Statements of a transaction are
+// run once, as their failure aborts the whole transaction.
+func (r *SQLHandler[T]) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.opts.retry == nil || r.tx != nil || inTransaction(r.db.Statement.ConnPool) {
+		return fn(ctx)
+	}
+	return r.opts.retry.Do(ctx, fn)
+}
+
+// WithTx returns a handler for type T bound to the given transaction.
+func (r *SQLHandler[T]) WithTx(tx *Tx) Repository[T] {
+	return &SQLHandler[T]{db: tx.db, tx: tx, opts: r.opts}
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	sqlitedriver "github.com/glebarez/go-sqlite"
+)
+
+// sqliteMemory is the connection string of an in-memory SQLite database
+const sqliteMemory = ":memory:"
+
+// sqliteRegexCache holds the patterns compiled by the REGEXP function
+var sqliteRegexCache sync.Map
+
+func init() {
+	// SQLite parses `X REGEXP Y` but only evaluates it when a regexp(Y, X) function is registered
+	sqlitedriver.MustRegisterDeterministicScalarFunction("regexp", 2, sqliteRegexp)
+}
+
+// sqliteRegexp implements the regexp(pattern, value) SQL function with Go's regexp package
+func sqliteRegexp(_ *sqlitedriver.FunctionContext, args []driver.Value) (driver.Value, error) {
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	pattern, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("regexp: pattern must be text, got %T", args[0])
+	}
+
+	var value string
+	switch v := args[1].(type) {
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		value = fmt.Sprint(v)
+	}
+
+	re, ok := sqliteRegexCache.Load(pattern)
+	if !ok {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		re, _ = sqliteRegexCache.LoadOrStore(pattern, compiled)
+	}
+
+	if re.(*regexp.Regexp).MatchString(value) {
+		return int64(1), nil
+	}
+	return int64(0), nil
+}
+
+// sqliteDSN builds the DSN of a SQLite database from the file path (or ":memory:")
+// with foreign keys enforced, as they are on the other drivers
+func sqliteDSN(path string) string {
+	if path == "" {
+		path = sqliteMemory
+	}
+	return path + "?_pragma=foreign_keys(1)"
+}
+
+// isSQLiteMemory reports if the connection string refers to an in-memory database
+func isSQLiteMemory(path string) bool {
+	return path == "" || path == sqliteMemory || strings.Contains(path, "mode=memory")
+}
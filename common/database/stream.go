@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ForEach implements `ForEach()` from Repository interface
+func (r *SQLHandler[T]) ForEach(ctx context.Context, qf QueryFilter, batchSize int, fn func(entity *T) error) error {
+	sch, err := parseSchema(r.db, new(T))
+	if err != nil {
+		return err
+	}
+	return forEach(ctx, sch, r.opts.cursorKey, r.readKeyset, qf, batchSize, fn)
+}
+
+// keysetReader reads the entities of a keyset request, over-fetched by one, see SQLHandler.readKeyset
+type keysetReader[T any] func(ctx context.Context, qf QueryFilter, p *Projection, req *pageRequest) ([]T, error)
+
+// forEach calls fn for every entity of the batches read by read. The batches are chained by
+// the keys of their last entity, which never leave the process and need no signed cursor,
+// so only a filter starting from a cursor needs the cursor key.
+func forEach[T any](ctx context.Context, sch *schema.Schema, cursorKey []byte, read keysetReader[T],
+	qf QueryFilter, batchSize int, fn func(entity *T) error) error {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	var req *pageRequest
+	var err error
+	if qf.Cursor != "" {
+		req, err = newPageRequest(sch, qf, cursorKey)
+	} else {
+		req, err = newKeysetRequest(sch, qf)
+	}
+	if err != nil {
+		return err
+	}
+	if req.backward {
+		return fmt.Errorf("%w: ForEach can not start from a previous page cursor", ErrInvalidCursor)
+	}
+
+	// The limit of the filter caps the number of visited entities, batches are sized by the batch size
+	remaining := qf.Limit
+
+	for {
+		req.size = batchSize
+		if remaining > 0 && remaining < batchSize {
+			req.size = remaining
+		}
+
+		entities, err := read(ctx, qf, nil, req)
+		if err != nil {
+			return err
+		}
+		hasMore := len(entities) > req.size
+		if hasMore {
+			entities = entities[:req.size]
+		}
+
+		// The keys are taken before fn gets a chance to modify the entity
+		var next []any
+		if hasMore {
+			next = keyValues(ctx, req.keys, &entities[len(entities)-1])
+		}
+
+		for i := range entities {
+			err := ctx.Err()
+			if err != nil {
+				return err
+			}
+			err = fn(&entities[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		if remaining > 0 {
+			remaining -= len(entities)
+			if remaining == 0 {
+				return nil
+			}
+		}
+		if !hasMore {
+			return nil
+		}
+		req.after = next
+	}
+}
+
+// Stream iterates over the rows of a query one at a time, as they are received from
+// the database. It holds on to a connection until closed.
+type Stream[T any] struct {
+	ctx    context.Context
+	db     *gorm.DB
+	rows   *sql.Rows
+	entity *T
+	err    error
+
+	// items holds the entities left to read by a stream of a MemoryRepository, which has no rows
+	items []T
+}
+
+// Stream implements `Stream()` from Repository interface
+func (r *SQLHandler[T]) Stream(ctx context.Context, qf QueryFilter, p *Projection) (*Stream[T], error) {
+	if len(qf.Preload) > 0 {
+		return nil, fmt.Errorf("%w: associations can not be preloaded while streaming", ErrInvalidFilter)
+	}
+
+	db := r.db.WithContext(ctx).Model(new(T))
+	db = applyProjections(db, p)
+	db = applyQueryFilters(db, qf)
+	db = applyLock(db, qf.Lock)
+
+	rows, err := db.Rows()
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return &Stream[T]{ctx: ctx, db: db, rows: rows}, nil
+}
+
+// Next advances to the next entity, it returns false when the rows are exhausted, the
+// context is done or scanning failed, see Err
+func (s *Stream[T]) Next() bool {
+	if s.err != nil {
+		return false
+	}
+
+	s.err = s.ctx.Err()
+	if s.err == nil && s.rows == nil {
+		if len(s.items) == 0 {
+			s.entity = nil
+			return false
+		}
+		s.entity, s.items = &s.items[0], s.items[1:]
+		return true
+	}
+	if s.err != nil || !s.rows.Next() {
+		s.entity = nil
+		return false
+	}
+
+	s.entity = new(T)
+	s.err = s.db.ScanRows(s.rows, s.entity)
+	return s.err == nil
+}
+
+// Entity returns the entity read by the last call to Next
+func (s *Stream[T]) Entity() *T {
+	return s.entity
+}
+
+// Err returns the error that stopped the iteration, if any
+func (s *Stream[T]) Err() error {
+	if s.err != nil {
+		return classifyError(s.err)
+	}
+	if s.rows == nil {
+		return nil
+	}
+	return classifyError(s.rows.Err())
+}
+
+// Close releases the connection held by the stream, it must always be called
+func (s *Stream[T]) Close() error {
+	if s.rows == nil {
+		s.items = nil
+		return nil
+	}
+	return s.rows.Close()
+}
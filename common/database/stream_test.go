@@ -0,0 +1,57 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+)
+
+// ForEach chains its batches in process, so it must not need the cursor key ListPage needs
+func TestForEachWithoutCursorKey(t *testing.T) {
+	databasetest.RunBackends(t, []any{&databasetest.Record{}}, nil, func(t *testing.T, newRepository func(t *testing.T) database.Repository[databasetest.Record]) {
+		ctx := context.Background()
+		repo := newRepository(t)
+
+		var want []string
+		for i := 0; i < 5; i++ {
+			record := databasetest.Record{Name: fmt.Sprintf("record-%d", i), Score: 5 - i}
+			if err := repo.Create(ctx, &record); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			want = append([]string{record.Name}, want...)
+		}
+
+		var visited []string
+		err := repo.ForEach(ctx, database.QueryFilter{OrderBy: "score"}, 2, func(r *databasetest.Record) error {
+			visited = append(visited, r.Name)
+			return nil
+		})
+		if err != nil || !slices.Equal(visited, want) {
+			t.Errorf("for each: got %q, %v, want %q", visited, err, want)
+		}
+
+		visited = nil
+		err = repo.ForEach(ctx, database.QueryFilter{OrderBy: "score", Limit: 3}, 2, func(r *databasetest.Record) error {
+			visited = append(visited, r.Name)
+			return nil
+		})
+		if err != nil || !slices.Equal(visited, want[:3]) {
+			t.Errorf("for each with limit: got %q, %v, want %q", visited, err, want[:3])
+		}
+
+		_, err = repo.ListPage(ctx, database.QueryFilter{}, nil)
+		if !errors.Is(err, database.ErrNoCursorKey) {
+			t.Errorf("list page: got %v, want ErrNoCursorKey", err)
+		}
+
+		err = repo.ForEach(ctx, database.QueryFilter{Cursor: "token"}, 2, func(*databasetest.Record) error { return nil })
+		if !errors.Is(err, database.ErrNoCursorKey) {
+			t.Errorf("for each from a cursor: got %v, want ErrNoCursorKey", err)
+		}
+	})
+}
@@ -0,0 +1,301 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// TenantColumn is the column holding the tenant of the rows of tenant scoped models. Every
+// model with a field stored in it is scoped, the field should be a string.
+const TenantColumn = "tenant_id"
+
+var (
+	// ErrTenantRequired is returned for the statements on tenant scoped models made with a
+	// context carrying no tenant, see WithTenant and CrossTenant
+	ErrTenantRequired = errors.New("database: tenant required")
+
+	// ErrTenantMismatch is returned when a write would store a row of another tenant than
+	// the one of its context
+	ErrTenantMismatch = errors.New("database: row belongs to another tenant")
+)
+
+type (
+	tenantKey      struct{}
+	crossTenantKey struct{}
+)
+
+// TenantHeader carries the tenant of a request, set by the gateway in front of the services,
+// which must drop the header from the requests of clients
+const TenantHeader = "X-Tenant-ID"
+
+// tenantHeaderSize is the size of the tenant columns
+const tenantHeaderSize = 64
+
+// tenantStampedKey marks the creates whose rows were stamped by the package, such as the
+// entries of the audit trail which take the tenant of the audited rows
+const tenantStampedKey = "database:tenant_stamped"
+
+// WithTenant returns a context whose statements on tenant scoped models only read and
+// write the rows of the given tenant. Queries, updates and deletes are restricted to its
+// rows and new rows are stamped with it.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// CrossTenant returns a context whose statements on tenant scoped models are not scoped,
+// for admin jobs working across tenants. Rows created with it must carry their tenant.
+func CrossTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, crossTenantKey{}, true)
+}
+
+// TenantFromContext returns the tenant set on ctx by WithTenant
+func TenantFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// TenantRequest returns r with a context scoped to the tenant of its TenantHeader, see
+// WithTenant. Requests without one, or with one longer than the tenant columns, fail with
+// ErrTenantRequired.
+func TenantRequest(r *http.Request) (*http.Request, error) {
+	tenant := r.Header.Get(TenantHeader)
+	if tenant == "" || len(tenant) > tenantHeaderSize {
+		return nil, fmt.Errorf("%w: missing or invalid %s header", ErrTenantRequired, TenantHeader)
+	}
+	return r.WithContext(WithTenant(r.Context(), tenant)), nil
+}
+
+// tenantScope returns the tenant the statements made with ctx are scoped to, all is set for
+// CrossTenant contexts, which take precedence
+func tenantScope(ctx context.Context) (tenant string, all bool, err error) {
+	if ctx != nil {
+		if cross, _ := ctx.Value(crossTenantKey{}).(bool); cross {
+			return "", true, nil
+		}
+	}
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return "", false, ErrTenantRequired
+	}
+	return tenant, false, nil
+}
+
+// tenantField returns the tenant field of the model, nil when the model is not tenant scoped
+func tenantField(sch *schema.Schema) *schema.Field {
+	if sch == nil {
+		return nil
+	}
+	field := sch.LookUpField(TenantColumn)
+	if field == nil || field.DBName != TenantColumn {
+		return nil
+	}
+	return field
+}
+
+// stampTenant sets the tenant of a new or saved row to the tenant of ctx, rows carrying
+// another tenant are rejected. Across tenants the row must carry its own.
+func stampTenant(ctx context.Context, field *schema.Field, row reflect.Value) error {
+	tenant, all, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	value, zero := field.ValueOf(ctx, row)
+	switch {
+	case zero && all:
+		return fmt.Errorf("%w: rows created across tenants must set %s", ErrTenantRequired, TenantColumn)
+	case zero:
+		return field.Set(ctx, row, tenant)
+	case !all && fmt.Sprint(reflect.Indirect(reflect.ValueOf(value))) != tenant:
+		return ErrTenantMismatch
+	}
+	return nil
+}
+
+// checkTenantAssignment rejects updates moving rows to another tenant
+func checkTenantAssignment(ctx context.Context, value any) error {
+	tenant, all, err := tenantScope(ctx)
+	if err != nil || all {
+		return err
+	}
+	if fmt.Sprint(reflect.Indirect(reflect.ValueOf(value))) != tenant {
+		return ErrTenantMismatch
+	}
+	return nil
+}
+
+// checkTenantConflict rejects upserts that could update the row of another tenant, which
+// is prevented by conflicting on the tenant column
+func checkTenantConflict(conflictColumns []string) error {
+	if slices.Contains(conflictColumns, TenantColumn) {
+		return nil
+	}
+	return fmt.Errorf("%w: upserts of tenant scoped models must conflict on %s", ErrInvalidFilter, TenantColumn)
+}
+
+// checkTenantKeys rejects upserts on MySQL that could update the row of another tenant: ON
+// DUPLICATE KEY UPDATE fires on a conflict with any unique key of the table, not only the
+// one of the conflict columns. Every unique key declared by the model must then include the
+// tenant column, but the primary key when the database generates it for all the entities.
+func checkTenantKeys[T any](ctx context.Context, sch *schema.Schema, entities []T) error {
+	for _, key := range uniqueKeys(sch) {
+		scoped := slices.ContainsFunc(key.fields, func(field *schema.Field) bool {
+			return field.DBName == TenantColumn
+		})
+		if scoped || key.primary && !hasPrimaryKey(ctx, sch, entities) {
+			continue
+		}
+		return fmt.Errorf("%w: upserts of tenant scoped models on mysql require the unique key %s to include %s",
+			ErrInvalidFilter, key.name, TenantColumn)
+	}
+	return nil
+}
+
+// hasPrimaryKey reports if any of the entities has its primary key set
+func hasPrimaryKey[T any](ctx context.Context, sch *schema.Schema, entities []T) bool {
+	for i := range entities {
+		rv := reflect.ValueOf(&entities[i]).Elem()
+		for _, field := range sch.PrimaryFields {
+			if _, zero := field.ValueOf(ctx, rv); !zero {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tenancyMu serializes the registrations of the tenancy callbacks by NewSQLHandler
+var tenancyMu sync.Mutex
+
+// RegisterTenancy registers the callbacks scoping the statements on tenant scoped models to
+// the tenant of their context. Queries, updates and deletes get a condition on TenantColumn,
+// creates are stamped with the tenant, and statements made without a tenant fail with
+// ErrTenantRequired. Raw SQL is not scoped, and neither are the tables joined to a query,
+// which have to be joined on their tenant too.
+//
+// Connect registers the callbacks, and NewSQLHandler registers them on databases missing
+// them. Registering them more than once is a no-op.
+func RegisterTenancy(db *gorm.DB) error {
+	tenancyMu.Lock()
+	defer tenancyMu.Unlock()
+
+	cb := db.Callback()
+	if cb.Query().Get("database:tenant_scope") != nil {
+		return nil
+	}
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("database:tenant_stamp", tenantCreate),
+		cb.Query().Before("gorm:query").Register("database:tenant_scope", tenantScopeStatement),
+		cb.Row().Before("gorm:row").Register("database:tenant_scope", tenantScopeStatement),
+		cb.Update().Before("gorm:update").Register("database:tenant_scope", tenantUpdate),
+		cb.Delete().Before("gorm:delete").Register("database:tenant_scope", tenantScopeStatement),
+	)
+}
+
+// tenantScopeStatement adds the tenant condition to the statement. The existing conditions
+// are grouped first, so that an OR among them can not escape it.
+func tenantScopeStatement(db *gorm.DB) {
+	stmt := db.Statement
+	field := tenantField(stmt.Schema)
+	if db.Error != nil || field == nil || stmt.SQL.Len() > 0 {
+		return
+	}
+
+	tenant, all, err := tenantScope(stmt.Context)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	if all {
+		return
+	}
+
+	condition := clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenant}
+	c := stmt.Clauses["WHERE"]
+	where, _ := c.Expression.(clause.Where)
+	if len(where.Exprs) > 0 {
+		where.Exprs = []clause.Expression{clause.And(where.Exprs...), condition}
+	} else {
+		where.Exprs = []clause.Expression{condition}
+	}
+	c.Name = "WHERE"
+	c.Expression = where
+	stmt.Clauses["WHERE"] = c
+}
+
+func tenantCreate(db *gorm.DB) {
+	stmt := db.Statement
+	field := tenantField(stmt.Schema)
+	if db.Error != nil || field == nil {
+		return
+	}
+	if _, stamped := db.Get(tenantStampedKey); stamped {
+		return
+	}
+
+	if c, ok := stmt.Clauses["ON CONFLICT"]; ok {
+		if onConflict, ok := c.Expression.(clause.OnConflict); ok && !onConflict.DoNothing {
+			columns := make([]string, len(onConflict.Columns))
+			for i, column := range onConflict.Columns {
+				columns[i] = column.Name
+			}
+			if err := checkTenantConflict(columns); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+	}
+
+	switch value := stmt.ReflectValue; value.Kind() {
+	case reflect.Struct:
+		db.AddError(stampTenant(stmt.Context, field, value))
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len() && db.Error == nil; i++ {
+			db.AddError(stampTenant(stmt.Context, field, reflect.Indirect(value.Index(i))))
+		}
+	case reflect.Map:
+		db.AddError(fmt.Errorf("%w: tenant scoped models can not be created from maps", ErrInvalidFilter))
+	}
+}
+
+// tenantUpdate scopes an update and rejects the ones moving rows to another tenant
+func tenantUpdate(db *gorm.DB) {
+	stmt := db.Statement
+	field := tenantField(stmt.Schema)
+	if db.Error != nil || field == nil {
+		return
+	}
+
+	switch dest := stmt.Dest.(type) {
+	case map[string]any:
+		for key, value := range dest {
+			if key == field.DBName || key == field.Name {
+				db.AddError(checkTenantAssignment(stmt.Context, value))
+			}
+		}
+	default:
+		// Saved structs write every column, so their tenant is stamped as on create
+		value := reflect.Indirect(reflect.ValueOf(dest))
+		if value.Kind() != reflect.Struct || value.Type() != stmt.Schema.ModelType {
+			break
+		}
+		if value.CanAddr() {
+			db.AddError(stampTenant(stmt.Context, field, value))
+		} else if tenant, zero := field.ValueOf(stmt.Context, value); !zero {
+			db.AddError(checkTenantAssignment(stmt.Context, tenant))
+		}
+	}
+	tenantScopeStatement(db)
+}
@@ -0,0 +1,68 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	databasetest.RunBackends(t, []any{&databasetest.TenantRecord{}}, []database.Option{databasetest.CursorKey}, databasetest.RunTenantIsolation)
+}
+
+type globalNameRecord struct {
+	ID       uint   `gorm:"primaryKey"`
+	TenantID string `gorm:"size:64;not null"`
+	Name     string `gorm:"uniqueIndex"`
+	Score    int
+}
+
+// ON DUPLICATE KEY UPDATE fires on any unique key, the upserts that could hit the row of another
+// tenant are rejected before reaching MySQL
+func TestTenantUpsertMySQL(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:password@tcp(127.0.0.1:1)/db", SkipInitializeWithVersion: true}),
+		&gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	ctx := database.WithTenant(context.Background(), "acme")
+
+	records := database.NewSQLHandler[databasetest.TenantRecord](db)
+	_, err = records.Upsert(ctx, []databasetest.TenantRecord{{ID: 1, Name: "alpha"}}, []string{"tenant_id", "name"}, []string{"score"})
+	if !errors.Is(err, database.ErrInvalidFilter) {
+		t.Errorf("upsert with a primary key: got %v, want ErrInvalidFilter", err)
+	}
+	_, err = records.Upsert(ctx, []databasetest.TenantRecord{{Name: "alpha"}}, []string{"tenant_id", "name"}, []string{"score"})
+	if err == nil || errors.Is(err, database.ErrInvalidFilter) {
+		t.Errorf("upsert on tenant scoped keys: got %v, want a connection error", err)
+	}
+
+	global := database.NewSQLHandler[globalNameRecord](db)
+	_, err = global.Upsert(ctx, []globalNameRecord{{Name: "alpha"}}, []string{"tenant_id", "id"}, []string{"score"})
+	if !errors.Is(err, database.ErrInvalidFilter) {
+		t.Errorf("upsert with a unique key across tenants: got %v, want ErrInvalidFilter", err)
+	}
+}
+
+func TestTenantRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	if _, err := database.TenantRequest(req); !errors.Is(err, database.ErrTenantRequired) {
+		t.Errorf("request without a tenant: got %v, want ErrTenantRequired", err)
+	}
+
+	req.Header.Set(database.TenantHeader, "acme")
+	scoped, err := database.TenantRequest(req)
+	if err != nil {
+		t.Fatalf("request with a tenant: %v", err)
+	}
+	if tenant, _ := database.TenantFromContext(scoped.Context()); tenant != "acme" {
+		t.Errorf("tenant of the request: got %q, want acme", tenant)
+	}
+}
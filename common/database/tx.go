@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Tx represents a unit of work bound to a single database transaction. Handlers
+// obtained from a Tx (see WithTx and TxHandler) share the same connection, so every
+// write made through them either commits or rolls back together.
+type Tx struct {
+	db    *gorm.DB
+	depth int
+
+	// memory is set instead of db for transactions of a MemoryDatabase
+	memory *memoryTx
+}
+
+// Instance returns the transaction bound GORM instance, it is nil for transactions
+// of a MemoryDatabase
+func (tx *Tx) Instance() *gorm.DB {
+	return tx.db
+}
+
+// RunInTx runs fn in a nested unit of work backed by a savepoint. If fn returns an
+// error (or panics) only the work done since the savepoint is rolled back, the
+// outer transaction stays usable.
+func (tx *Tx) RunInTx(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	if tx.memory != nil {
+		return tx.memory.runInSavepoint(tx, fn)
+	}
+
+	name := fmt.Sprintf("sp_%d", tx.depth+1)
+	db := tx.db.WithContext(ctx)
+
+	err = db.SavePoint(name).Error
+	if err != nil {
+		return err
+	}
+
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			rollbackErr := db.RollbackTo(name).Error
+			if rollbackErr != nil && err != nil {
+				err = fmt.Errorf("%w (rollback to savepoint failed: %v)", err, rollbackErr)
+			}
+		}
+	}()
+
+	err = fn(&Tx{db: db, depth: tx.depth + 1})
+	panicked = false
+	return err
+}
+
+// TxHandler returns a SQLHandler for any entity type T bound to the given transaction
+func TxHandler[T any](tx *Tx, opts ...Option) *SQLHandler[T] {
+	return &SQLHandler[T]{db: tx.db, tx: tx, opts: newOptions(opts)}
+}
+
+// runInTx begins a new transaction on db and runs fn in it. The transaction is
+// committed when fn returns nil and rolled back when it returns an error or panics.
+func runInTx(ctx context.Context, db *gorm.DB, fn func(tx *Tx) error, opts ...*sql.TxOptions) (err error) {
+	gtx := db.WithContext(ctx).Begin(opts...)
+	if gtx.Error != nil {
+		return gtx.Error
+	}
+
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			gtx.Rollback()
+		}
+	}()
+
+	err = fn(&Tx{db: gtx})
+	panicked = false
+	if err != nil {
+		return err
+	}
+
+	return gtx.Commit().Error
+}
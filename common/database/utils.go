@@ -2,88 +2,234 @@ package database
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// applyQueryFilters will apply all the filters (if given any)
+// applyQueryFilters will apply all the filters (if given any). Invalid filters are
+// added to the query's errors and surface when the query is executed.
 func applyQueryFilters(query *gorm.DB, qf QueryFilter) *gorm.DB {
+	query, b, err := queryBuilder(query)
+	if err != nil {
+		query.AddError(err)
+		return query
+	}
+
 	// 1. Apply JOINs first as they expand or limit the scope of data to be queried.
-	query = applyJoins(query, qf.Joins)
+	query = applyJoins(query, b, qf.Joins)
 
 	// 2. Apply DISTINCT if required to ensure unique rows; beneficial post-JOINs.
 	query = applyDistinct(query, qf.Distinct)
 
-	// 3. Apply WHERE conditions to filter the dataset.
-	query = applyWhereConditions(query, qf)
+	// 3. Apply WHERE conditions to filter the dataset, regex conditions and OR
+	// alternatives are folded into the same (single) boolean expression.
+	query = applyWhereConditions(query, b, qf)
 
-	// 4. Applying regex conditions for advanced pattern matching.
-	query = applyRegexConditions(query, qf.RegexFilter)
+	// 4. GROUP BY to aggregate results based on specified columns.
+	query = applyGroupBy(query, b, qf.GroupBy)
 
-	// 5. GROUP BY to aggregate results based on specified columns.
-	query = applyGroupBy(query, qf.GroupBy)
+	// 5. HAVING conditions to filter groups.
+	query = applyHavingConditions(query, b, qf)
 
-	// 6. HAVING conditions to filter groups.
-	query = applyHavingConditions(query, qf)
+	// 6. ORDER BY to sort the results.
+	query = applyOrderBy(query, b, qf.OrderBy)
 
-	// 7. ORDER BY to sort the results.
-	query = applyOrderBy(query, qf.OrderBy)
-
-	// 8. Limit and Offset for pagination.
+	// 7. Limit and Offset for pagination.
 	query = applyLimitOffset(query, qf.Limit, qf.Offset)
 
-	// 9. OR conditions for alternative matching.
-	query = applyOrConditions(query, qf.Or)
-
-	// 10. Pluck is used typically at the end to select specific fields.
-	query = applyPluck(query, qf.Pluck)
+	// 8. Pluck is used typically at the end to select specific fields.
+	query = applyPluck(query, b, qf.Pluck)
 
 	return query
 }
 
-func applyJoins(query *gorm.DB, joins []Join) *gorm.DB {
+// builderKey stores the expression builder of a query, so that the filters see the
+// aliases of its projection
+const builderKey = "database:expr_builder"
+
+// queryBuilder returns the expression builder shared by the filters and the projection
+// of the query, creating it on first use
+func queryBuilder(query *gorm.DB) (*gorm.DB, *exprBuilder, error) {
+	if b, ok := query.InstanceGet(builderKey); ok {
+		return query, b.(*exprBuilder), nil
+	}
+
+	b, err := newQueryBuilder(query)
+	if err != nil {
+		return query, nil, err
+	}
+	return query.InstanceSet(builderKey, b), b, nil
+}
+
+// newQueryBuilder returns an expression builder for the model of the query
+func newQueryBuilder(query *gorm.DB) (*exprBuilder, error) {
+	if query.Statement.Schema == nil {
+		err := query.Statement.Parse(query.Statement.Model)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newExprBuilder(query.Statement.Schema, dialectOf(query)), nil
+}
+
+// joinTypes lists the accepted JOIN types
+var joinTypes = map[string]bool{
+	"":            true,
+	"INNER":       true,
+	"LEFT":        true,
+	"RIGHT":       true,
+	"FULL":        true,
+	"CROSS":       true,
+	"LEFT OUTER":  true,
+	"RIGHT OUTER": true,
+	"FULL OUTER":  true,
+}
+
+func applyJoins(query *gorm.DB, b *exprBuilder, joins []Join) *gorm.DB {
 	for _, join := range joins {
-		joinQuery := fmt.Sprintf("JOIN %s ON %s", join.Table, join.Condition) // Default JOIN
-		if join.Type != "" {
-			joinQuery = fmt.Sprintf("%s JOIN %s ON %s", strings.ToUpper(join.Type), join.Table, join.Condition)
+		joinType := strings.ToUpper(strings.Join(strings.Fields(join.Type), " "))
+		if !joinTypes[joinType] {
+			query.AddError(fmt.Errorf("%w: invalid join type %q", ErrInvalidFilter, join.Type))
+			return query
+		}
+
+		table, alias, err := parseJoinTable(join.Table)
+		if err != nil {
+			query.AddError(err)
+			return query
+		}
+
+		b.tables[table] = true
+		target := query.Statement.Quote(table)
+		if alias != "" {
+			b.tables[alias] = true
+			target += " " + query.Statement.Quote(alias)
+		}
+
+		// The condition is a trusted SQL fragment, values must be passed through Args
+		joinQuery := fmt.Sprintf("JOIN %s ON %s", target, join.Condition) // Default JOIN
+		if joinType != "" {
+			joinQuery = fmt.Sprintf("%s JOIN %s ON %s", joinType, target, join.Condition)
 		}
 		query = query.Joins(joinQuery, join.Args...)
 	}
 	return query
 }
 
-func applyWhereConditions(query *gorm.DB, qf QueryFilter) *gorm.DB {
-	if len(qf.WhereMap) > 0 {
-		for key, value := range qf.WhereMap {
-			query = query.Where(fmt.Sprintf("%s = ?", key), value)
+// parseJoinTable parses a join target of the form "table", "table alias" or "table AS alias"
+func parseJoinTable(target string) (string, string, error) {
+	parts := strings.Fields(target)
+	if len(parts) == 3 && strings.EqualFold(parts[1], "AS") {
+		parts = []string{parts[0], parts[2]}
+	}
+
+	if len(parts) == 0 || len(parts) > 2 {
+		return "", "", fmt.Errorf("%w: invalid join table %q", ErrInvalidFilter, target)
+	}
+	for _, part := range parts {
+		if !identifierRegex.MatchString(part) {
+			return "", "", fmt.Errorf("%w: invalid join table %q", ErrInvalidFilter, target)
 		}
+	}
 
-		if len(qf.UpdateMap) > 0 {
-			for key, value := range qf.UpdateMap {
-				query = query.Update(key, value)
-			}
+	if len(parts) == 1 {
+		return parts[0], "", nil
+	}
+	return parts[0], parts[1], nil
+}
+
+func applyWhereConditions(query *gorm.DB, b *exprBuilder, qf QueryFilter) *gorm.DB {
+	expr, err := whereExpression(b, qf)
+	if err != nil {
+		query.AddError(err)
+		return query
+	}
+
+	if expr != nil {
+		query = query.Where(expr)
+	}
+	return query
+}
+
+// whereExpression builds the boolean expression of a query filter: its equality, custom,
+// regex and expression conditions AND-ed together, OR-ed with each of its Or filters
+func whereExpression(b *exprBuilder, qf QueryFilter) (clause.Expression, error) {
+	var conditions []clause.Expression
+
+	for _, key := range sortedKeys(qf.WhereMap) {
+		column, err := b.column(key)
+		if err != nil {
+			return nil, err
 		}
+		conditions = append(conditions, clause.Eq{Column: column, Value: qf.WhereMap[key]})
 	}
 
 	if qf.WhereQuery != "" {
-		query = query.Where(qf.WhereQuery, qf.WhereArgs...)
+		conditions = append(conditions, clause.Expr{SQL: qf.WhereQuery, Vars: qf.WhereArgs})
+	}
 
-		if len(qf.UpdateMap) > 0 {
-			for key, value := range qf.UpdateMap {
-				query = query.Update(key, value)
-			}
+	regexConditions, err := regexExpressions(b, qf.RegexFilter)
+	if err != nil {
+		return nil, err
+	}
+	conditions = append(conditions, regexConditions...)
+
+	expr, err := b.build(qf.Where)
+	if err != nil {
+		return nil, err
+	}
+	if expr != nil {
+		conditions = append(conditions, expr)
+	}
+
+	var alternatives []clause.Expression
+	if len(conditions) > 0 {
+		alternatives = append(alternatives, joinExpressions(conditions, false))
+	}
+
+	for _, or := range qf.Or {
+		expr, err := whereExpression(b, or)
+		if err != nil {
+			return nil, err
+		}
+		if expr != nil {
+			alternatives = append(alternatives, expr)
 		}
 	}
 
-	return query
+	if len(alternatives) == 0 {
+		return nil, nil
+	}
+	return joinExpressions(alternatives, true), nil
+}
+
+// joinExpressions combines the expressions with AND (or OR), a single expression is returned as is
+func joinExpressions(exprs []clause.Expression, or bool) clause.Expression {
+	switch {
+	case len(exprs) == 1:
+		return exprs[0]
+	case or:
+		return clause.OrConditions{Exprs: exprs}
+	default:
+		return clause.AndConditions{Exprs: exprs}
+	}
 }
 
-func applyHavingConditions(query *gorm.DB, qf QueryFilter) *gorm.DB {
-	if len(qf.HavingMap) > 0 {
-		for key, value := range qf.HavingMap {
-			query = query.Having(fmt.Sprintf("%s = ?", key), value)
+func applyHavingConditions(query *gorm.DB, b *exprBuilder, qf QueryFilter) *gorm.DB {
+	for _, key := range sortedKeys(qf.HavingMap) {
+		// HAVING commonly refers to aliases of the projection, which are not part of the schema
+		column, err := b.column(key)
+		if err != nil {
+			if !identifierRegex.MatchString(key) {
+				query.AddError(err)
+				return query
+			}
+			column = clause.Column{Name: key}
 		}
+		query = query.Having(clause.Eq{Column: column, Value: qf.HavingMap[key]})
 	}
 
 	if qf.HavingQuery != "" {
@@ -93,16 +239,78 @@ func applyHavingConditions(query *gorm.DB, qf QueryFilter) *gorm.DB {
 	return query
 }
 
-func applyOrderBy(query *gorm.DB, orderBy string) *gorm.DB {
-	if orderBy != "" {
-		query = query.Order(orderBy)
+func applyOrderBy(query *gorm.DB, b *exprBuilder, orderBy string) *gorm.DB {
+	columns, err := orderByColumns(b, orderBy)
+	if err != nil {
+		query.AddError(err)
+		return query
+	}
+
+	for _, column := range columns {
+		query = query.Order(column)
 	}
 	return query
 }
 
-func applyGroupBy(query *gorm.DB, groupBy string) *gorm.DB {
-	if groupBy != "" {
-		query = query.Group(groupBy)
+// orderByColumns parses a comma separated list of "column [ASC|DESC]" terms
+func orderByColumns(b *exprBuilder, orderBy string) ([]clause.OrderByColumn, error) {
+	var columns []clause.OrderByColumn
+	for _, term := range strings.Split(orderBy, ",") {
+		parts := strings.Fields(term)
+		if len(parts) == 0 {
+			continue
+		}
+
+		column, err := b.column(parts[0])
+		if _, aliased := b.aliases[parts[0]]; err != nil && aliased {
+			column, err = clause.Column{Name: parts[0]}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		desc := false
+		if len(parts) == 2 {
+			switch strings.ToUpper(parts[1]) {
+			case "ASC":
+			case "DESC":
+				desc = true
+			default:
+				return nil, fmt.Errorf("%w: invalid sort direction %q", ErrInvalidFilter, parts[1])
+			}
+		} else if len(parts) > 2 {
+			return nil, fmt.Errorf("%w: invalid order by term %q", ErrInvalidFilter, strings.TrimSpace(term))
+		}
+
+		columns = append(columns, clause.OrderByColumn{Column: column, Desc: desc})
+	}
+	return columns, nil
+}
+
+func applyGroupBy(query *gorm.DB, b *exprBuilder, groupBy string) *gorm.DB {
+	var columns []clause.Column
+	for _, name := range strings.Split(groupBy, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		// Time buckets are grouped by their expression, as not every driver accepts aliases
+		if expr := b.aliases[name]; expr != "" {
+			columns = append(columns, clause.Column{Name: expr, Raw: true})
+			continue
+		}
+
+		column, err := b.column(name)
+		if err != nil {
+			query.AddError(err)
+			return query
+		}
+		columns = append(columns, column)
+	}
+
+	if len(columns) > 0 {
+		query = query.Clauses(clause.GroupBy{Columns: columns})
 	}
 	return query
 }
@@ -117,73 +325,161 @@ func applyLimitOffset(query *gorm.DB, limit, offset int) *gorm.DB {
 	return query
 }
 
-func applyRegexConditions(query *gorm.DB, regexFilter map[string]string) *gorm.DB {
-	for field, regex := range regexFilter {
-		query = query.Where(fmt.Sprintf("%s REGEXP ?", field), regex)
+// regexExpressions builds the regex conditions, keyed by column, in the dialect of the driver
+func regexExpressions(b *exprBuilder, regexFilter map[string]string) ([]clause.Expression, error) {
+	var exprs []clause.Expression
+	for _, field := range sortedKeys(regexFilter) {
+		expr, err := b.build(Regex(field, regexFilter[field]))
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
 	}
-	return query
+	return exprs, nil
 }
 
 func applyDistinct(query *gorm.DB, distinct bool) *gorm.DB {
-	if distinct {
-		query = query.Distinct()
+	if !distinct {
+		return query
+	}
+
+	// The projection is applied first, its columns are made distinct
+	query = query.Distinct()
+	if c, ok := query.Statement.Clauses["SELECT"]; ok {
+		if expr, ok := c.Expression.(clause.Expr); ok {
+			query = query.Clauses(clause.Select{Distinct: true, Expression: expr})
+		}
 	}
 	return query
 }
 
-func applyPluck(query *gorm.DB, pluck string) *gorm.DB {
-	if pluck != "" {
-		query = query.Pluck(pluck, nil)
+// applyPluck narrows the selection down to a single (validated) column
+func applyPluck(query *gorm.DB, b *exprBuilder, pluck string) *gorm.DB {
+	if pluck == "" {
+		return query
 	}
-	return query
+
+	column, err := b.column(pluck)
+	if err != nil {
+		query.AddError(err)
+		return query
+	}
+
+	// The columns of a projection take precedence
+	if c, ok := query.Statement.Clauses["SELECT"]; ok && c.Expression != nil {
+		return query
+	}
+
+	if column.Table == clause.CurrentTable {
+		column.Table = b.schema.Table
+	}
+	return query.Select(column.Table + "." + column.Name)
 }
 
-func applyOrConditions(query *gorm.DB, orConditions []QueryFilter) *gorm.DB {
-	for _, condition := range orConditions {
-		query = query.Or(applyQueryFilters(query, condition))
+// sortedKeys returns the keys of the map in order, so the generated SQL is deterministic
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
-	return query
+	sort.Strings(keys)
+	return keys
 }
 
-// applyProjections will project the required columns as provided by clients
+// applyProjections will project the required columns as provided by clients. Invalid
+// projections are added to the query's errors and surface when the query is executed.
 func applyProjections(query *gorm.DB, p *Projection) *gorm.DB {
-	if p != nil {
-		var projections []string
+	if p == nil {
+		return query
+	}
+
+	query, b, err := queryBuilder(query)
+	if err != nil {
+		query.AddError(err)
+		return query
+	}
+
+	// Every projection is a separate query argument, so that the validated ones are quoted
+	var projections []string
+	var vars []any
+	project := func(expr any) {
+		projections = append(projections, "?")
+		vars = append(vars, expr)
+	}
 
-		// Apply field projections
-		if len(p.Fields) > 0 {
-			projections = append(projections, p.Fields...)
+	// Apply field projections
+	for _, field := range p.Fields {
+		column, err := b.column(field)
+		if err != nil {
+			query.AddError(err)
+			return query
 		}
+		project(column)
+	}
 
-		// Apply aggregate projections
-		for _, aggregate := range p.Aggregates {
-			projection := fmt.Sprintf("%s(%s) AS %s", aggregate.Function, aggregate.Field, aggregate.Alias)
-			projections = append(projections, projection)
+	// Apply time buckets
+	for _, bucket := range p.Buckets {
+		expr, err := b.bucket(query, bucket)
+		if err != nil {
+			query.AddError(err)
+			return query
 		}
+		project(clause.Expr{SQL: expr + " AS ?", Vars: []any{clause.Column{Name: bucket.Alias}}})
+	}
 
-		// Apply conditional projections
-		for _, conditional := range p.Conditionals {
-			projection := fmt.Sprintf("CASE WHEN %s THEN %s ELSE %s END AS %s", conditional.Condition, conditional.TrueValue, conditional.FalseValue, conditional.Alias)
-			projections = append(projections, projection)
+	// Apply aggregate projections
+	for _, aggregate := range p.Aggregates {
+		expr, err := b.aggregate(aggregate)
+		if err != nil {
+			query.AddError(err)
+			return query
 		}
+		project(expr)
+	}
 
-		// Apply subquery projections
-		for _, subquery := range p.Subqueries {
-			projection := fmt.Sprintf("(%s) AS %s", subquery.Query, subquery.Alias)
-			projections = append(projections, projection)
+	// Apply conditional projections
+	for _, conditional := range p.Conditionals {
+		err := b.alias(conditional.Alias, "")
+		if err != nil {
+			query.AddError(err)
+			return query
 		}
+		project(clause.Expr{SQL: fmt.Sprintf("CASE WHEN %s THEN %s ELSE %s END AS ", conditional.Condition, conditional.TrueValue, conditional.FalseValue) + "?",
+			Vars: []any{clause.Column{Name: conditional.Alias}}})
+	}
 
-		// Apply projections to the query
-		query = query.Select(projections)
+	// Apply subquery projections
+	for _, subquery := range p.Subqueries {
+		err := b.alias(subquery.Alias, "")
+		if err != nil {
+			query.AddError(err)
+			return query
+		}
+		project(clause.Expr{SQL: "(" + subquery.Query + ") AS ?",
+			Vars: append(append([]any{}, subquery.Args...), clause.Column{Name: subquery.Alias})})
+	}
 
-		// Apply field exclusions
-		if len(p.Exclude) > 0 {
-			excludeFields := make([]string, len(p.Exclude))
-			for i, field := range p.Exclude {
-				excludeFields[i] = "-" + field
-			}
-			query = query.Omit(excludeFields...)
+	// Apply search ranks, along with the columns of the model unless others are selected
+	if len(p.Ranks) > 0 && len(projections) == 0 {
+		project(clause.Expr{SQL: "?.*", Vars: []any{clause.Table{Name: clause.CurrentTable}}})
+	}
+	for _, rank := range p.Ranks {
+		expr, err := b.rank(rank)
+		if err != nil {
+			query.AddError(err)
+			return query
 		}
+		project(expr)
+	}
+
+	// Apply projections to the query
+	if len(projections) > 0 {
+		query = query.Select(strings.Join(projections, ", "), vars...)
+	}
+
+	// Apply field exclusions
+	if len(p.Exclude) > 0 {
+		query = query.Omit(p.Exclude...)
 	}
 	return query
 }
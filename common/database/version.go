@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// versionFieldName is the name of the field holding the row version of models using
+// optimistic concurrency control
+const versionFieldName = "Version"
+
+// versionField returns the integer Version field of the model, or nil when the model
+// is not versioned
+func versionField(sch *schema.Schema) *schema.Field {
+	field := sch.LookUpField(versionFieldName)
+	if field == nil || field.DBName == "" {
+		return nil
+	}
+
+	switch field.IndirectFieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field
+	default:
+		return nil
+	}
+}
+
+// versionedUpdates returns a copy of updates in which the version column is incremented.
+// A version given in updates is the one the caller read, it is returned as the expected
+// version and the update only applies to rows still at that version.
+func versionedUpdates(sch *schema.Schema, field *schema.Field, updates map[string]any) (map[string]any, any, bool, error) {
+	versioned := make(map[string]any, len(updates)+1)
+	var expected any
+	found := false
+
+	for key, value := range updates {
+		f := sch.LookUpField(key)
+		if f != field {
+			versioned[key] = value
+			continue
+		}
+		if found {
+			return nil, nil, false, fmt.Errorf("%w: version given more than once", ErrInvalidFilter)
+		}
+		expected, found = value, true
+	}
+
+	versioned[field.DBName] = clause.Expr{
+		SQL:  "? + 1",
+		Vars: []any{clause.Column{Name: field.DBName}},
+	}
+	return versioned, expected, found, nil
+}
+
+// versionCondition restricts an update to the rows at the expected version
+func versionCondition(field *schema.Field, expected any) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: expected}
+}
+
+// updateVersioned runs an update on a versioned model, failing with ErrConcurrentModification
+// when the caller's expected version is stale
+func (r *SQLHandler[T]) updateVersioned(ctx context.Context, qf QueryFilter, sch *schema.Schema, field *schema.Field) error {
+	updates, expected, checked, err := versionedUpdates(sch, field, qf.UpdateMap)
+	if err != nil {
+		return err
+	}
+
+	db := r.db.WithContext(ctx).Model(new(T))
+	db = applyQueryFilters(db, qf)
+	if checked {
+		db = db.Where(versionCondition(field, expected))
+	}
+
+	result := db.Updates(updates)
+	if result.Error != nil || !checked || result.RowsAffected > 0 {
+		return classifyError(result.Error)
+	}
+
+	// Nothing was updated, either because nothing matches the filter or because the
+	// matching rows moved past the expected version. The primary is asked as a lagging
+	// replica could still hold the expected version.
+	exists, err := r.Exists(ReadYourWrites(ctx), qf)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrConcurrentModification
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Package service runs the serve and migrate commands shared by the service binaries
+package service
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/migrate"
+	"k8s.io/klog/v2"
+)
+
+// shutdownTimeout bounds the time given to in-flight requests once serve is asked to stop
+const shutdownTimeout = 10 * time.Second
+
+// Config is the part of the service configuration the commands need
+type Config struct {
+	// Address and Port are served on by the serve command
+	Address string
+	Port    int
+
+	Database *database.Config
+}
+
+// Service describes the binary of a service
+type Service struct {
+	// Name prefixes the logs and names the published pool statistics
+	Name string
+
+	// Migrations holds the migrations of the service, see the migrate package
+	Migrations fs.FS
+
+	// Load reads the configuration file at path
+	Load func(path string) (*Config, error)
+}
+
+// Main parses the command line and runs the serve or migrate command of s until it fails, or
+// it is interrupted. It exits the process on failure.
+func Main(s Service) {
+	configPath := flag.String("config", "../conf/app.yaml", "path of the service configuration")
+	migrationsDir := flag.String("migrations-dir", "../migrations", "directory new migrations are created in")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] serve | migrate up [N] | down [N] | status | redo | create NAME\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 || (args[0] != "migrate" && args[0] != "serve") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	if args[0] == "serve" {
+		err = serve(ctx, s, *configPath)
+	} else {
+		connect := func() (database.SQLDatabase, error) {
+			cfg, err := s.Load(*configPath)
+			if err != nil {
+				return nil, err
+			}
+			return database.NewSQLDatabaseContext(ctx, cfg.Database)
+		}
+		err = migrate.Command(ctx, args[1:], s.Migrations, *migrationsDir, connect, os.Stdout)
+	}
+	if err != nil {
+		klog.ErrorS(err, s.Name+": "+args[0]+" failed")
+		klog.Flush()
+		stop()
+		os.Exit(1)
+	}
+}
+
+// serve connects to the database and serves its health check on /healthz and the statistics
+// of its connection pools on /debug/vars (see database.PublishStats) until ctx is done
+func serve(ctx context.Context, s Service, configPath string) error {
+	cfg, err := s.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.NewSQLDatabaseContext(ctx, cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Disconnect()
+
+	database.PublishStats(s.Name, db)
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", database.HealthHandler(db))
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	server := &http.Server{
+		Addr:    net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port)),
+		Handler: database.AuditHandler(mux),
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		klog.InfoS(s.Name+": serving", "address", server.Addr)
+		errc <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -1 +1,21 @@
-package cmd
+package main
+
+import (
+	"github.com/swarit-pandey/e-commerce/common/service"
+	"github.com/swarit-pandey/e-commerce/inventory/migrations"
+	"github.com/swarit-pandey/e-commerce/inventory/pkg/config"
+)
+
+func main() {
+	service.Main(service.Service{
+		Name:       "inventory",
+		Migrations: migrations.FS,
+		Load: func(path string) (*service.Config, error) {
+			cfg, err := (&config.RootConfig{ConfigPath: path}).Load()
+			if err != nil {
+				return nil, err
+			}
+			return &service.Config{Address: cfg.Server.Address, Port: cfg.Server.Port, Database: cfg.Database.SQLConfig()}, nil
+		},
+	})
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS inventory_location_products;
+DROP TABLE IF EXISTS inventory_locations;
+DROP TABLE IF EXISTS inventories;
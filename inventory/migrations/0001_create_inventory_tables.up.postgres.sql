@@ -0,0 +1,31 @@
+-- product_id references rows owned by the product service, which may live in
+-- another database, so it carries no foreign key
+
+CREATE TABLE inventories (
+    id         BIGSERIAL PRIMARY KEY,
+    product_id BIGINT NOT NULL,
+    quantity   BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_inventories_product_id ON inventories (product_id);
+
+CREATE TABLE inventory_locations (
+    id         BIGSERIAL PRIMARY KEY,
+    name       TEXT NOT NULL DEFAULT '',
+    address    TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE TABLE inventory_location_products (
+    inventory_location_id BIGINT NOT NULL REFERENCES inventory_locations (id) ON DELETE CASCADE,
+    inventory_id          BIGINT NOT NULL REFERENCES inventories (id) ON DELETE CASCADE,
+    quantity              BIGINT NOT NULL DEFAULT 0,
+    created_at            TIMESTAMPTZ,
+    updated_at            TIMESTAMPTZ,
+    PRIMARY KEY (inventory_location_id, inventory_id)
+);
+
+CREATE INDEX idx_inventory_location_products_inventory_id ON inventory_location_products (inventory_id);
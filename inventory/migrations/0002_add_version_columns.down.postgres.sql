@@ -0,0 +1,2 @@
+ALTER TABLE inventory_location_products DROP COLUMN version;
+ALTER TABLE inventories DROP COLUMN version;
@@ -0,0 +1,2 @@
+ALTER TABLE inventories ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE inventory_location_products ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,23 @@
+CREATE TABLE audit_entries (
+    id          BIGSERIAL PRIMARY KEY,
+    entity_type VARCHAR(64) NOT NULL,
+    entity_id   VARCHAR(64) NOT NULL,
+    action      VARCHAR(16) NOT NULL,
+    changes     JSONB NOT NULL,
+    actor       VARCHAR(128) NOT NULL DEFAULT '',
+    request_id  VARCHAR(128) NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_audit_entries_entity ON audit_entries (entity_type, entity_id, created_at);
+CREATE INDEX idx_audit_entries_created_at ON audit_entries (created_at);
+
+-- The audit trail is append-only. The body has no semicolon at the end of a line, which
+-- would end the statement for the migrate package.
+CREATE FUNCTION audit_entries_append_only() RETURNS trigger AS $$
+BEGIN RAISE EXCEPTION 'audit_entries is append-only'; END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_entries_append_only
+    BEFORE UPDATE OR DELETE ON audit_entries
+    FOR EACH ROW EXECUTE FUNCTION audit_entries_append_only();
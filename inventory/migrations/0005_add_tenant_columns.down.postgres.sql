@@ -0,0 +1,8 @@
+DROP INDEX idx_inventories_tenant_id;
+ALTER TABLE inventories DROP COLUMN tenant_id;
+
+DROP INDEX idx_inventory_locations_tenant_id;
+ALTER TABLE inventory_locations DROP COLUMN tenant_id;
+
+DROP INDEX idx_inventory_location_products_tenant_id;
+ALTER TABLE inventory_location_products DROP COLUMN tenant_id;
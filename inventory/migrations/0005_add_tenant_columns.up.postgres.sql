@@ -0,0 +1,14 @@
+-- The rows stored before tenancy belong to no tenant, which no request can read. They have
+-- to be assigned their tenant by a job working across tenants.
+
+ALTER TABLE inventories ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE inventories ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE INDEX idx_inventories_tenant_id ON inventories (tenant_id);
+
+ALTER TABLE inventory_locations ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE inventory_locations ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE INDEX idx_inventory_locations_tenant_id ON inventory_locations (tenant_id);
+
+ALTER TABLE inventory_location_products ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE inventory_location_products ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE INDEX idx_inventory_location_products_tenant_id ON inventory_location_products (tenant_id);
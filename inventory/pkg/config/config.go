@@ -21,11 +21,10 @@ func (cfg *RootConfig) Load() (*InventoryConfig, error) {
 
 	configLoad := Config{}
 
-	err := confutil.LoadAndUnmarhsal(cfg.ConfigPath, configLoad)
+	err := confutil.LoadAndUnmarhsal(cfg.ConfigPath, &configLoad)
 	if err != nil {
 		return nil, fmt.Errorf("notification: %v", err)
 	}
 
 	return &configLoad.Inventory, nil
 }
-
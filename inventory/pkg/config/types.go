@@ -1,15 +1,17 @@
 package config
 
+import "github.com/swarit-pandey/e-commerce/common/conf"
+
 type Config struct {
 	Inventory InventoryConfig `mapstructure:"inventory"`
 }
 
 type InventoryConfig struct {
-	Metadata Metadata `mapstructure:"metadata"`
-	Server   Server   `mapstructure:"server"`
-	Broker   Broker   `mapstructure:"broker"`
-	Cache    Cache    `mapstructure:"cache"`
-	Database Database `mapstructure:"database"`
+	Metadata Metadata      `mapstructure:"metadata"`
+	Server   Server        `mapstructure:"server"`
+	Broker   Broker        `mapstructure:"broker"`
+	Cache    Cache         `mapstructure:"cache"`
+	Database conf.Database `mapstructure:"database"`
 }
 
 type Metadata struct {
@@ -46,15 +48,3 @@ type Cache struct {
 	Port   int    `mapstructure:"port"`
 	Driver string `mapstructure:"driver"`
 }
-
-type Database struct {
-	Port        int    `mapstructure:"port"`
-	Driver      string `mapstructure:"driver"`
-	Address     string `mapstructure:"address"`
-	Dialect     string `mapstructure:"dialect"`
-	Name        string `mapstructure:"name"`
-	Username    string `mapstructure:"username"`
-	Password    string `mapstructure:"password"`
-	SSL         string `mapstructure:"ssl"`
-	MaxConnPool int    `mapstructure:"maxconnpool"`
-}
@@ -8,15 +8,23 @@ import (
 
 type Inventory struct {
 	ID        uint             `gorm:"primaryKey" json:"id"`
+	TenantID  string           `gorm:"size:64;not null;index" json:"-"`
 	ProductID uint             `json:"-"`
 	Product   prodrepo.Product `gorm:"foreignKey:ProductID" json:"product"`
 	Quantity  uint             `json:"quantity"`
 	CreatedAt time.Time        `json:"created_at"`
 	UpdatedAt time.Time        `json:"updated_at"`
+	Version   uint             `gorm:"not null;default:0" json:"version"`
+}
+
+// AuditType implements database.Auditable, the writes to inventories are recorded in the audit trail
+func (Inventory) AuditType() string {
+	return "inventory"
 }
 
 type InventoryLocation struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
+	TenantID  string    `gorm:"size:64;not null;index" json:"-"`
 	Name      string    `json:"name"`
 	Address   string    `json:"address"`
 	CreatedAt time.Time `json:"created_at"`
@@ -26,7 +34,20 @@ type InventoryLocation struct {
 type InventoryLocationProduct struct {
 	InventoryLocationID uint      `gorm:"primaryKey" json:"-"`
 	InventoryID         uint      `gorm:"primaryKey" json:"-"`
+	TenantID            string    `gorm:"size:64;not null;index" json:"-"`
 	Quantity            uint      `json:"quantity"`
 	CreatedAt           time.Time `json:"created_at"`
 	UpdatedAt           time.Time `json:"updated_at"`
+	Version             uint      `gorm:"not null;default:0" json:"version"`
+}
+
+// AuditType implements database.Auditable, the stock held by every location is recorded in
+// the audit trail
+func (InventoryLocationProduct) AuditType() string {
+	return "inventory_location_product"
+}
+
+// Models returns the models persisted by the inventory service
+func Models() []any {
+	return []any{&Inventory{}, &InventoryLocation{}, &InventoryLocationProduct{}}
 }
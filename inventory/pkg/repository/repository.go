@@ -1 +1,95 @@
 package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDecrement         = errors.New("failed to decrement stock")
+	ErrInsufficientStock = errors.New("insufficient stock")
+)
+
+// forUpdate locks the stock rows read by a decrement until it commits
+var forUpdate = database.RowLock{Mode: database.LockForUpdate}
+
+type InventoryRepo interface {
+	// Decrement checks that a location holds at least quantity units of a product and removes
+	// them from the location and from the product's inventory, in a single transaction.
+	// It returns ErrInsufficientStock when either of them holds less.
+	Decrement(ctx context.Context, productID, locationID, quantity uint) error
+}
+
+type inventoryRepo struct {
+	db      *gorm.DB
+	handler *database.SQLHandler[Inventory]
+}
+
+func NewInventoryRepo(db *gorm.DB, opts ...database.Option) InventoryRepo {
+	return &inventoryRepo{
+		db:      db,
+		handler: database.NewSQLHandler[Inventory](db, append(opts, database.WithRetryPolicy(database.DefaultRetryPolicy()))...),
+	}
+}
+
+func (ir *inventoryRepo) Decrement(ctx context.Context, productID, locationID, quantity uint) error {
+	err := ir.handler.RunInTx(ctx, func(tx *database.Tx) error {
+		inventories := database.TxHandler[Inventory](tx)
+		locations := database.TxHandler[InventoryLocationProduct](tx)
+
+		// Every decrement locks the inventory before the location, so that concurrent
+		// decrements of the same product queue up instead of deadlocking
+		inventory, err := inventories.Get(ctx, database.QueryFilter{
+			WhereMap: map[string]any{"product_id": productID},
+			Lock:     forUpdate,
+		}, nil)
+		if err != nil {
+			return err
+		}
+
+		stock, err := locations.Get(ctx, database.QueryFilter{
+			WhereMap: map[string]any{
+				"inventory_id":          inventory.ID,
+				"inventory_location_id": locationID,
+			},
+			Lock: forUpdate,
+		}, nil)
+		if err != nil {
+			return err
+		}
+
+		if inventory.Quantity < quantity || stock.Quantity < quantity {
+			return ErrInsufficientStock
+		}
+
+		err = inventories.Update(ctx, database.QueryFilter{
+			WhereMap: map[string]any{"id": inventory.ID},
+			UpdateMap: map[string]any{
+				"quantity": inventory.Quantity - quantity,
+				"version":  inventory.Version,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		return locations.Update(ctx, database.QueryFilter{
+			WhereMap: map[string]any{
+				"inventory_id":          inventory.ID,
+				"inventory_location_id": locationID,
+			},
+			UpdateMap: map[string]any{
+				"quantity": stock.Quantity - quantity,
+				"version":  stock.Version,
+			},
+		})
+	})
+	if err != nil {
+		return errors.Join(ErrDecrement, err)
+	}
+
+	return nil
+}
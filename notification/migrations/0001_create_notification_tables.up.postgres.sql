@@ -0,0 +1,30 @@
+-- user_id references rows owned by the user service, which may live in another
+-- database, so it carries no foreign key
+
+CREATE TABLE notification_types (
+    id          BIGSERIAL PRIMARY KEY,
+    name        TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ
+);
+
+CREATE TABLE notifications (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL,
+    message    TEXT NOT NULL DEFAULT '',
+    is_read    BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_notifications_user_id ON notifications (user_id);
+
+CREATE TABLE user_notification_preferences (
+    user_id              BIGINT NOT NULL,
+    notification_type_id BIGINT NOT NULL REFERENCES notification_types (id) ON DELETE CASCADE,
+    is_enabled           BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at           TIMESTAMPTZ,
+    updated_at           TIMESTAMPTZ,
+    PRIMARY KEY (user_id, notification_type_id)
+);
@@ -0,0 +1,5 @@
+DROP INDEX idx_notifications_tenant_id;
+ALTER TABLE notifications DROP COLUMN tenant_id;
+
+DROP INDEX idx_user_notification_preferences_tenant_id;
+ALTER TABLE user_notification_preferences DROP COLUMN tenant_id;
@@ -0,0 +1,10 @@
+-- The rows stored before tenancy belong to no tenant, which no request can read. They have
+-- to be assigned their tenant by a job working across tenants.
+
+ALTER TABLE notifications ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE notifications ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE INDEX idx_notifications_tenant_id ON notifications (tenant_id);
+
+ALTER TABLE user_notification_preferences ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE user_notification_preferences ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE INDEX idx_user_notification_preferences_tenant_id ON user_notification_preferences (tenant_id);
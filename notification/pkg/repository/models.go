@@ -8,6 +8,7 @@ import (
 
 type Notification struct {
 	ID        uint          `gorm:"primaryKey" json:"id"`
+	TenantID  string        `gorm:"size:64;not null;index" json:"-"`
 	UserID    uint          `json:"-"`
 	User      userrepo.User `gorm:"foreignKey:UserID" json:"user"`
 	Message   string        `json:"message"`
@@ -27,7 +28,13 @@ type NotificationType struct {
 type UserNotificationPreference struct {
 	UserID             uint      `gorm:"primaryKey" json:"-"`
 	NotificationTypeID uint      `gorm:"primaryKey" json:"-"`
+	TenantID           string    `gorm:"size:64;not null;index" json:"-"`
 	IsEnabled          bool      `gorm:"default:true" json:"is_enabled"`
 	CreatedAt          time.Time `json:"created_at"`
 	UpdatedAt          time.Time `json:"updated_at"`
 }
+
+// Models returns the models persisted by the notification service
+func Models() []any {
+	return []any{&NotificationType{}, &Notification{}, &UserNotificationPreference{}}
+}
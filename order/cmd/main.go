@@ -1 +1,23 @@
-package cmd
+package main
+
+import (
+	"github.com/swarit-pandey/e-commerce/common/service"
+	"github.com/swarit-pandey/e-commerce/order/migrations"
+	"github.com/swarit-pandey/e-commerce/order/pkg/config"
+)
+
+func main() {
+	service.Main(service.Service{
+		Name:       "order",
+		Migrations: migrations.FS,
+		Load: func(path string) (*service.Config, error) {
+			cfg, err := (&config.RootConfig{ConfigPath: path}).Load()
+			if err != nil {
+				return nil, err
+			}
+			db := cfg.Database.SQLConfig()
+			db.Audit = true
+			return &service.Config{Address: cfg.Server.Address, Port: cfg.Server.Port, Database: db}, nil
+		},
+	})
+}
@@ -0,0 +1,4 @@
+DROP INDEX idx_audit_entries_entity;
+CREATE INDEX idx_audit_entries_entity ON audit_entries (entity_type, entity_id, created_at);
+
+ALTER TABLE audit_entries DROP COLUMN tenant_id;
@@ -0,0 +1,5 @@
+-- Audit entries belong to the tenant of the audited row, the existing ones to no tenant
+ALTER TABLE audit_entries ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+
+DROP INDEX idx_audit_entries_entity;
+CREATE INDEX idx_audit_entries_entity ON audit_entries (tenant_id, entity_type, entity_id, created_at);
@@ -0,0 +1,8 @@
+DROP INDEX idx_orders_tenant_id;
+ALTER TABLE orders DROP COLUMN tenant_id;
+
+DROP INDEX idx_order_items_tenant_id;
+ALTER TABLE order_items DROP COLUMN tenant_id;
+
+DROP INDEX idx_order_addresses_tenant_id;
+ALTER TABLE order_addresses DROP COLUMN tenant_id;
@@ -0,0 +1,14 @@
+-- The rows stored before tenancy belong to no tenant, which no request can read. They have
+-- to be assigned their tenant by a job working across tenants.
+
+ALTER TABLE orders ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE orders ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE INDEX idx_orders_tenant_id ON orders (tenant_id);
+
+ALTER TABLE order_items ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE order_items ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE INDEX idx_order_items_tenant_id ON order_items (tenant_id);
+
+ALTER TABLE order_addresses ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE order_addresses ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE INDEX idx_order_addresses_tenant_id ON order_addresses (tenant_id);
@@ -9,6 +9,7 @@ import (
 
 type Order struct {
 	ID        uint          `gorm:"primaryKey" json:"id"`
+	TenantID  string        `gorm:"size:64;not null;index" json:"-"`
 	UserID    uint          `json:"-"`
 	User      userrepo.User `gorm:"foreignKey:UserID" json:"user"`
 	Status    string        `json:"status"`
@@ -18,8 +19,14 @@ type Order struct {
 	Address   OrderAddress  `gorm:"foreignKey:OrderID" json:"address"`
 }
 
+// AuditType implements database.Auditable, the writes to orders are recorded in the audit trail
+func (Order) AuditType() string {
+	return "order"
+}
+
 type OrderItem struct {
 	ID        uint             `gorm:"primaryKey" json:"id"`
+	TenantID  string           `gorm:"size:64;not null;index" json:"-"`
 	OrderID   uint             `json:"-"`
 	ProductID uint             `json:"-"`
 	Product   prodrepo.Product `gorm:"foreignKey:ProductID" json:"product"`
@@ -31,6 +38,7 @@ type OrderItem struct {
 
 type OrderAddress struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
+	TenantID     string    `gorm:"size:64;not null;index" json:"-"`
 	OrderID      uint      `json:"-"`
 	AddressLine1 string    `json:"address_line1"`
 	AddressLine2 string    `json:"address_line2"`
@@ -41,3 +49,8 @@ type OrderAddress struct {
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
+
+// Models returns the models persisted by the order service
+func Models() []any {
+	return []any{&Order{}, &OrderItem{}, &OrderAddress{}}
+}
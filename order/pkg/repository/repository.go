@@ -1 +1,80 @@
 package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCreate  = errors.New("failed to create order")
+	ErrNoItems = errors.New("order has no items")
+)
+
+type OrderRepo interface {
+	// CreateWithItems creates the order along with its items and address in a single
+	// transaction, so that an order is never stored without them. The generated keys
+	// are set on the order, its items and its address.
+	CreateWithItems(ctx context.Context, order *Order) (*Order, error)
+}
+
+type orderRepo struct {
+	db      *gorm.DB
+	handler *database.SQLHandler[Order]
+
+	// opts are handed down to the handlers bound to a transaction
+	opts []database.Option
+}
+
+func NewOrderRepo(db *gorm.DB, opts ...database.Option) OrderRepo {
+	return &orderRepo{
+		db:      db,
+		handler: database.NewSQLHandler[Order](db, append(opts, database.WithRetryPolicy(database.DefaultRetryPolicy()))...),
+		opts:    opts,
+	}
+}
+
+func (or *orderRepo) CreateWithItems(ctx context.Context, order *Order) (*Order, error) {
+	if len(order.Items) == 0 {
+		return nil, errors.Join(ErrCreate, ErrNoItems)
+	}
+
+	var (
+		created Order
+		items   []OrderItem
+		address OrderAddress
+	)
+
+	// fn may be run again when the transaction is retried, so every attempt starts
+	// over from copies of the request rather than from the keys of a rolled back one
+	err := or.handler.RunInTx(ctx, func(tx *database.Tx) error {
+		created = *order
+		created.Items, created.Address = nil, OrderAddress{}
+		err := database.TxHandler[Order](tx, or.opts...).Create(ctx, &created)
+		if err != nil {
+			return err
+		}
+
+		items = append([]OrderItem(nil), order.Items...)
+		for i := range items {
+			items[i].OrderID = created.ID
+		}
+		err = database.TxHandler[OrderItem](tx, or.opts...).CreateBatch(ctx, items, 0)
+		if err != nil {
+			return err
+		}
+
+		address = order.Address
+		address.OrderID = created.ID
+		return database.TxHandler[OrderAddress](tx, or.opts...).Create(ctx, &address)
+	})
+	if err != nil {
+		return nil, errors.Join(ErrCreate, err)
+	}
+
+	created.Items, created.Address = items, address
+	*order = created
+	return order, nil
+}
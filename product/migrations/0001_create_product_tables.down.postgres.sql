@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS product_images;
+DROP TABLE IF EXISTS product_categories;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS products;
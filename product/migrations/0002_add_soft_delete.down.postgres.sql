@@ -0,0 +1,9 @@
+-- Tombstoned rows can not be represented without the deleted_at column
+DELETE FROM products WHERE deleted_at IS NOT NULL;
+DELETE FROM categories WHERE deleted_at IS NOT NULL;
+
+DROP INDEX idx_categories_deleted_at;
+ALTER TABLE categories DROP COLUMN deleted_at;
+
+DROP INDEX idx_products_deleted_at;
+ALTER TABLE products DROP COLUMN deleted_at;
@@ -0,0 +1,8 @@
+DROP INDEX idx_products_tenant_id;
+ALTER TABLE products DROP COLUMN tenant_id;
+
+DROP INDEX idx_categories_tenant_id;
+ALTER TABLE categories DROP COLUMN tenant_id;
+
+DROP INDEX idx_product_images_tenant_id;
+ALTER TABLE product_images DROP COLUMN tenant_id;
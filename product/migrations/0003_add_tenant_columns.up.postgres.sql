@@ -0,0 +1,14 @@
+-- The rows stored before tenancy belong to no tenant, which no request can read. They have
+-- to be assigned their tenant by a job working across tenants.
+
+ALTER TABLE products ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE products ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE INDEX idx_products_tenant_id ON products (tenant_id);
+
+ALTER TABLE categories ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE categories ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE INDEX idx_categories_tenant_id ON categories (tenant_id);
+
+ALTER TABLE product_images ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE product_images ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE INDEX idx_product_images_tenant_id ON product_images (tenant_id);
@@ -0,0 +1,4 @@
+-- Serves database.Search("...", "name", "description"), the expression must be the one
+-- built by the search for these columns in this order
+CREATE INDEX idx_products_search ON products
+    USING GIN (to_tsvector('simple', coalesce(name, '') || ' ' || coalesce(description, '')));
@@ -0,0 +1,10 @@
+// Package migrations embeds the schema migrations of the product service
+package migrations
+
+import "embed"
+
+// FS holds the migration scripts. They are written for postgres only, so migrate rejects the
+// other drivers, see the common/database/migrate package for the naming scheme
+//
+//go:embed *.sql
+var FS embed.FS
@@ -21,7 +21,7 @@ func (cfg *RootConfig) Load() (*ProductConfig, error) {
 
 	configLoad := Config{}
 
-	err := confutil.LoadAndUnmarhsal(cfg.ConfigPath, configLoad)
+	err := confutil.LoadAndUnmarhsal(cfg.ConfigPath, &configLoad)
 	if err != nil {
 		return nil, fmt.Errorf("notification: %v", err)
 	}
@@ -1,31 +1,45 @@
 package repository
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Product struct {
 	ID          uint           `gorm:"primaryKey" json:"id"`
+	TenantID    string         `gorm:"size:64;not null;index" json:"-"`
 	Name        string         `json:"name"`
 	Description string         `json:"description"`
 	Price       float64        `json:"price"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 	Categories  []Category     `gorm:"many2many:product_categories;" json:"categories"`
 	Images      []ProductImage `gorm:"foreignKey:ProductID" json:"images"`
 }
 
 type Category struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	TenantID    string         `gorm:"size:64;not null;index" json:"-"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type ProductImage struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
+	TenantID  string    `gorm:"size:64;not null;index" json:"-"`
 	ProductID uint      `json:"-"`
 	ImageURL  string    `json:"image_url"`
 	AltText   string    `json:"alt_text"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// Models returns the models persisted by the product service
+func Models() []any {
+	return []any{&Product{}, &Category{}, &ProductImage{}}
+}
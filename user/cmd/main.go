@@ -1,5 +1,56 @@
-package cmd
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/migrate"
+	"github.com/swarit-pandey/e-commerce/user/migrations"
+	"github.com/swarit-pandey/e-commerce/user/pkg/config"
+	"k8s.io/klog/v2"
+)
 
 func main() {
+	root := config.Default()
+	flag.StringVar(&root.ConfigPath, "config", "../conf/app.yaml", "path of the service configuration")
+	migrationsDir := flag.String("migrations-dir", "../migrations", "directory new migrations are created in")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] serve | migrate up [N] | down [N] | status | redo | create NAME\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 || (args[0] != "migrate" && args[0] != "serve") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	var err error
+	if args[0] == "serve" {
+		err = serve(ctx, root)
+	} else {
+		connect := func() (database.SQLDatabase, error) {
+			cfg, err := root.Load()
+			if err != nil {
+				return nil, err
+			}
+			return database.NewSQLDatabaseContext(ctx, cfg.Database.SQLConfig())
+		}
+		err = migrate.Command(ctx, args[1:], migrations.FS, *migrationsDir, connect, os.Stdout)
+	}
+	if err != nil {
+		klog.ErrorS(err, "user: "+args[0]+" failed")
+		klog.Flush()
+		stop()
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/swarit-pandey/e-commerce/common/database"
+	httpapi "github.com/swarit-pandey/e-commerce/user/api/http/server"
+	"github.com/swarit-pandey/e-commerce/user/pkg/cache"
+	"github.com/swarit-pandey/e-commerce/user/pkg/config"
+	"github.com/swarit-pandey/e-commerce/user/pkg/repository"
+	"github.com/swarit-pandey/e-commerce/user/pkg/service"
+	"github.com/swarit-pandey/e-commerce/user/pkg/transport"
+	"k8s.io/klog/v2"
+)
+
+// shutdownTimeout bounds the time given to in-flight requests once serve is asked to stop
+const shutdownTimeout = 10 * time.Second
+
+// serve connects to the database and the cache and serves the user API, along with the
+// health check of the database on /healthz and the statistics of its connection pools on
+// /debug/vars (see database.PublishStats), until ctx is done
+func serve(ctx context.Context, root *config.RootConfig) error {
+	cfg, err := root.Load()
+	if err != nil {
+		return err
+	}
+	opts, err := cfg.Database.Options()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.NewSQLDatabaseContext(ctx, cfg.Database.SQLConfig())
+	if err != nil {
+		return err
+	}
+	defer db.Disconnect()
+
+	database.PublishStats("user", db)
+
+	users := repository.NewUserRepo(db.Instance(), opts...)
+	addresses := repository.NewAddressRepo(db.Instance(), opts...)
+
+	cacheService, err := cache.NewCacheService(&cfg.Cache, repository.User{}, users, repository.UserAddress{}, addresses)
+	if err != nil {
+		return err
+	}
+	handler := transport.NewHandler(service.NewUserService(cacheService))
+
+	router := gin.New()
+	router.Use(gin.Logger(), gin.Recovery(), transport.AuditContext())
+	transport.RegisterHealth(router, db)
+	httpapi.RegisterHandlersWithOptions(router, handler, httpapi.GinServerOptions{
+		BaseURL:     cfg.Server.BasePath,
+		Middlewares: []httpapi.MiddlewareFunc{httpapi.MiddlewareFunc(transport.TenantContext())},
+	})
+
+	server := &http.Server{
+		Addr:    net.JoinHostPort(cfg.Server.Address, strconv.Itoa(cfg.Server.Port)),
+		Handler: router,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		klog.InfoS("user: serving", "address", server.Addr)
+		errc <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
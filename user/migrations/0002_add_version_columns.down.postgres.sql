@@ -0,0 +1,2 @@
+ALTER TABLE user_addresses DROP COLUMN version;
+ALTER TABLE users DROP COLUMN version;
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE user_addresses ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
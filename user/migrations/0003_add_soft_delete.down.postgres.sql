@@ -0,0 +1,10 @@
+-- Tombstoned rows can not be represented without the deleted_at column
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+DROP INDEX idx_users_username;
+DROP INDEX idx_users_email;
+CREATE UNIQUE INDEX idx_users_username ON users (username);
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+
+DROP INDEX idx_users_deleted_at;
+ALTER TABLE users DROP COLUMN deleted_at;
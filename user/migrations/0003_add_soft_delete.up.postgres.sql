@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+-- Soft deleted users must not keep their username and email reserved
+DROP INDEX idx_users_username;
+DROP INDEX idx_users_email;
+CREATE UNIQUE INDEX idx_users_username ON users (username) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX idx_users_email ON users (email) WHERE deleted_at IS NULL;
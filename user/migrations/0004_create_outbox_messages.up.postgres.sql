@@ -0,0 +1,15 @@
+CREATE TABLE outbox_messages (
+    id              BIGSERIAL PRIMARY KEY,
+    aggregate_type  VARCHAR(64) NOT NULL,
+    aggregate_id    VARCHAR(64) NOT NULL,
+    type            VARCHAR(128) NOT NULL,
+    payload         BYTEA NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL,
+    attempts        BIGINT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_error      TEXT NOT NULL DEFAULT '',
+    delivered_at    TIMESTAMPTZ
+);
+
+CREATE INDEX idx_outbox_messages_aggregate ON outbox_messages (aggregate_type, aggregate_id);
+CREATE INDEX idx_outbox_messages_delivered_at ON outbox_messages (delivered_at);
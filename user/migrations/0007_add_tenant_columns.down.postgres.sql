@@ -0,0 +1,8 @@
+DROP INDEX idx_users_username;
+DROP INDEX idx_users_email;
+CREATE UNIQUE INDEX idx_users_username ON users (username) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX idx_users_email ON users (email) WHERE deleted_at IS NULL;
+ALTER TABLE users DROP COLUMN tenant_id;
+
+DROP INDEX idx_user_addresses_tenant_id;
+ALTER TABLE user_addresses DROP COLUMN tenant_id;
@@ -0,0 +1,15 @@
+-- The rows stored before tenancy belong to no tenant, which no request can read. They have
+-- to be assigned their tenant by a job working across tenants.
+
+ALTER TABLE users ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE users ALTER COLUMN tenant_id DROP DEFAULT;
+
+-- Usernames and emails are only unique within a tenant
+DROP INDEX idx_users_username;
+DROP INDEX idx_users_email;
+CREATE UNIQUE INDEX idx_users_username ON users (tenant_id, username) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX idx_users_email ON users (tenant_id, email) WHERE deleted_at IS NULL;
+
+ALTER TABLE user_addresses ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE user_addresses ALTER COLUMN tenant_id DROP DEFAULT;
+CREATE INDEX idx_user_addresses_tenant_id ON user_addresses (tenant_id);
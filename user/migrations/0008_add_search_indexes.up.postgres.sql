@@ -0,0 +1,4 @@
+-- Serves database.Search("...", "username", "name"), the expression must be the one built
+-- by the search for these columns in this order
+CREATE INDEX idx_users_search ON users
+    USING GIN (to_tsvector('simple', coalesce(username, '') || ' ' || coalesce(name, '')));
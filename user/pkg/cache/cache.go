@@ -2,23 +2,35 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/swarit-pandey/e-commerce/common/cache"
+	"github.com/swarit-pandey/e-commerce/common/database"
 	"github.com/swarit-pandey/e-commerce/user/pkg/config"
 	"github.com/swarit-pandey/e-commerce/user/pkg/repository"
 	"k8s.io/klog/v2"
 )
 
 const (
-	cacheSet     = "entity_cache"
-	userCacheBin = "user"
-	addrCacheBin = "address"
+	cacheSet      = "entity_cache"
+	userCacheBin  = "user"
+	addrCacheBin  = "address"
+	tokenCacheBin = "reset_token"
 )
 
+// tenantKey formats a cache key scoped to the tenant of ctx, so that the entities of a
+// tenant are never served to another from the cache
+func tenantKey(ctx context.Context, format string, args ...any) string {
+	tenant, _ := database.TenantFromContext(ctx)
+	return tenant + ":" + fmt.Sprintf(format, args...)
+}
+
 type CacheService struct {
-	cache         cache.Repository[any]
+	users         cache.Repository[cachedUser]
+	addresses     cache.Repository[cachedAddress]
+	tokens        cache.Repository[string]
 	userRepo      repository.User
 	addrRepo      repository.UserAddress
 	userInterface repository.UserRepo
@@ -27,21 +39,42 @@ type CacheService struct {
 
 func NewCacheService(conf *config.Cache, userRepo repository.User, userInterface repository.UserRepo, addrRepo repository.UserAddress, addressInterface repository.AddressRepo) (*CacheService, error) {
 	cacheConfig := cache.Config{
-		URL:       conf.Address,
-		Port:      conf.Port,
-		Namespace: conf.Namespace,
-		LogLevel:  conf.LogLevel,
-		Set:       cacheSet,
-		Bin:       userCacheBin,
+		Backend:    conf.Backend,
+		URL:        conf.Address,
+		Port:       conf.Port,
+		Namespace:  conf.Namespace,
+		LogLevel:   conf.LogLevel,
+		Set:        cacheSet,
+		Bin:        userCacheBin,
+		Password:   conf.Password,
+		DB:         conf.DB,
+		MaxEntries: conf.MaxEntries,
+		MaxBytes:   conf.MaxBytes,
 	}
 
-	aeroCache, err := cache.NewAero[any](&cacheConfig)
+	// Every cache decodes its own type, an entity read back from a cache of any would
+	// be a map instead
+	users, err := cache.New[cachedUser](&cacheConfig)
+	if err != nil {
+		return nil, err
+	}
+	addrConfig := cacheConfig
+	addrConfig.Bin = addrCacheBin
+	addresses, err := cache.New[cachedAddress](&addrConfig)
+	if err != nil {
+		return nil, err
+	}
+	tokenConfig := cacheConfig
+	tokenConfig.Bin = tokenCacheBin
+	tokens, err := cache.New[string](&tokenConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	return &CacheService{
-		cache:         aeroCache,
+		users:         users,
+		addresses:     addresses,
+		tokens:        tokens,
 		userRepo:      userRepo,
 		userInterface: userInterface,
 		addrRepo:      addrRepo,
@@ -67,7 +100,7 @@ func (cs *CacheService) SetUser(ctx context.Context, user *repository.User) erro
 func (cs *CacheService) GetUser(ctx context.Context, userID uint) (*repository.User, error) {
 	// Scenario 1: Data found in cache
 	user, err := cs.getUserFromCache(ctx, userID)
-	if err != nil {
+	if err == nil {
 		return user, nil
 	}
 
@@ -87,29 +120,25 @@ func (cs *CacheService) GetUser(ctx context.Context, userID uint) (*repository.U
 }
 
 func (cs *CacheService) getUserFromCache(ctx context.Context, userID uint) (*repository.User, error) {
-	key := fmt.Sprintf("user_%d", userID)
-	value, err := cs.cache.Get(ctx, key)
+	key := tenantKey(ctx, "user_%d", userID)
+	user, err := cs.users.Get(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-
-	user, ok := value.(*repository.User)
-	if !ok {
-		return nil, ErrCacheInvalidated
-	}
-	return user, nil
+	return user.user(), nil
 }
 
 func (cs *CacheService) setUserInCache(ctx context.Context, user repository.User) error {
-	userIDKey := fmt.Sprintf("user_%d", user.ID)
-	usernameKey := fmt.Sprintf("user_username_%s", user.Username)
+	userIDKey := tenantKey(ctx, "user_%d", user.ID)
+	usernameKey := tenantKey(ctx, "user_username_%s", user.Username)
 
-	err := cs.cache.Set(ctx, userIDKey, user, 2*time.Hour)
+	cached := newCachedUser(user)
+	err := cs.users.Set(ctx, userIDKey, cached, 2*time.Hour)
 	if err != nil {
 		return err
 	}
 
-	err = cs.cache.Set(ctx, usernameKey, user, 2*time.Hour)
+	err = cs.users.Set(ctx, usernameKey, cached, 2*time.Hour)
 	if err != nil {
 		return err
 	}
@@ -120,7 +149,7 @@ func (cs *CacheService) setUserInCache(ctx context.Context, user repository.User
 func (cs *CacheService) GetAddress(ctx context.Context, addrID uint) (*repository.UserAddress, error) {
 	// Scenario 1: Data found in cache
 	addr, err := cs.getAddressFromCache(ctx, addrID)
-	if err != nil {
+	if err == nil {
 		return addr, nil
 	}
 
@@ -157,22 +186,17 @@ func (cs *CacheService) SetAddress(ctx context.Context, addr *repository.UserAdd
 }
 
 func (cs *CacheService) getAddressFromCache(ctx context.Context, addrID uint) (*repository.UserAddress, error) {
-	key := fmt.Sprintf("addr_%d", addrID)
-	value, err := cs.cache.Get(ctx, key)
+	key := tenantKey(ctx, "addr_%d", addrID)
+	address, err := cs.addresses.Get(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-
-	address, ok := value.(*repository.UserAddress)
-	if !ok {
-		return nil, ErrCacheInvalidated
-	}
-	return address, nil
+	return address.address(), nil
 }
 
 func (cs *CacheService) setAddressInCache(ctx context.Context, addr repository.UserAddress) error {
-	key := fmt.Sprintf("address_%d", addr.ID)
-	err := cs.cache.Set(ctx, key, addr, 2*time.Hour)
+	key := tenantKey(ctx, "addr_%d", addr.ID)
+	err := cs.addresses.Set(ctx, key, newCachedAddress(addr), 2*time.Hour)
 	return err
 }
 
@@ -202,15 +226,15 @@ func (cs *CacheService) DeleteUser(ctx context.Context, userID uint) error {
 }
 
 func (cs *CacheService) deleteUserFromCache(ctx context.Context, user *repository.User) error {
-	userIDKey := fmt.Sprintf("user_%d", user.ID)
-	usernameKey := fmt.Sprintf("user_username_%s", user.Username)
+	userIDKey := tenantKey(ctx, "user_%d", user.ID)
+	usernameKey := tenantKey(ctx, "user_username_%s", user.Username)
 
-	err := cs.cache.Delete(ctx, userIDKey)
+	err := cs.users.Delete(ctx, userIDKey)
 	if err != nil {
 		return err
 	}
 
-	err = cs.cache.Delete(ctx, usernameKey)
+	err = cs.users.Delete(ctx, usernameKey)
 	if err != nil {
 		return err
 	}
@@ -243,20 +267,20 @@ func (cs *CacheService) DeleteAddress(ctx context.Context, addrID uint) error {
 }
 
 func (cs *CacheService) deleteAddressFromCache(ctx context.Context, addrID uint) error {
-	key := fmt.Sprintf("addr_%d", addrID)
-	err := cs.cache.Delete(ctx, key)
+	key := tenantKey(ctx, "addr_%d", addrID)
+	err := cs.addresses.Delete(ctx, key)
 	return err
 }
 
 func (cs *CacheService) GetUserByUsername(ctx context.Context, username string) (*repository.User, error) {
 	// Scenario 1: Data found in cache
 	user, err := cs.getUserFromCacheByUsername(ctx, username)
-	if err != nil {
+	if err == nil {
 		return user, nil
 	}
 
 	// Scenario 2: Data not found in cache, get from repository
-	user, err = cs.userInterface.GetByUsername(ctx, user)
+	user, err = cs.userInterface.GetByUsername(ctx, &repository.User{Username: username})
 	if err == nil {
 		// Write-through
 		err = cs.setUserInCache(ctx, *user)
@@ -270,22 +294,27 @@ func (cs *CacheService) GetUserByUsername(ctx context.Context, username string)
 	return nil, ErrEntityNotFound
 }
 
-func (cs *CacheService) getUserFromCacheByUsername(ctx context.Context, username string) (*repository.User, error) {
-	key := fmt.Sprintf("user_username_%s", username)
-	value, err := cs.cache.Get(ctx, key)
+// GetUserCredentials returns the user with the given username from the repository, along
+// with its password hash, which is never cached
+func (cs *CacheService) GetUserCredentials(ctx context.Context, username string) (*repository.User, error) {
+	user, err := cs.userInterface.GetByUsername(ctx, &repository.User{Username: username})
 	if err != nil {
-		return nil, err
+		return nil, errors.Join(ErrEntityNotFound, err)
 	}
+	return user, nil
+}
 
-	user, ok := value.(*repository.User)
-	if !ok {
-		return nil, ErrCacheInvalidated
+func (cs *CacheService) getUserFromCacheByUsername(ctx context.Context, username string) (*repository.User, error) {
+	key := tenantKey(ctx, "user_username_%s", username)
+	user, err := cs.users.Get(ctx, key)
+	if err != nil {
+		return nil, err
 	}
-	return user, nil
+	return user.user(), nil
 }
 
 func (cs *CacheService) SetPasswordResetToken(ctx context.Context, userID uint, token string) error {
-	key := fmt.Sprintf("reset_token_%d", userID)
-	err := cs.cache.Set(ctx, key, token, 6*time.Hour)
+	key := tenantKey(ctx, "reset_token_%d", userID)
+	err := cs.tokens.Set(ctx, key, token, 6*time.Hour)
 	return err
 }
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/cache"
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+	"github.com/swarit-pandey/e-commerce/user/pkg/config"
+	"github.com/swarit-pandey/e-commerce/user/pkg/repository"
+)
+
+// Users are served from the cache once stored, and only to their tenant
+func TestGetUserFromCache(t *testing.T) {
+	ctx := database.WithTenant(context.Background(), "acme")
+	db := databasetest.New(t, repository.Models()...).Instance()
+
+	cs, err := NewCacheService(&config.Cache{Backend: cache.BackendMemory},
+		repository.User{}, repository.NewUserRepo(db), repository.UserAddress{}, repository.NewAddressRepo(db))
+	if err != nil {
+		t.Fatalf("new cache service: %v", err)
+	}
+
+	user := &repository.User{Username: "ada", Email: "ada@example.com"}
+	if err := cs.SetUser(ctx, user); err != nil {
+		t.Fatalf("set user: %v", err)
+	}
+	if err := db.Exec("DELETE FROM users").Error; err != nil {
+		t.Fatalf("delete users: %v", err)
+	}
+
+	got, err := cs.GetUser(ctx, user.ID)
+	if err != nil || got.Username != "ada" || got.TenantID != "acme" {
+		t.Errorf("cached user: got %+v, %v", got, err)
+	}
+	got, err = cs.GetUserByUsername(ctx, "ada")
+	if err != nil || got.ID != user.ID {
+		t.Errorf("cached user by username: got %+v, %v", got, err)
+	}
+
+	other := database.WithTenant(context.Background(), "globex")
+	if got, err := cs.GetUser(other, user.ID); !errors.Is(err, ErrEntityNotFound) {
+		t.Errorf("user of another tenant: got %+v, %v, want ErrEntityNotFound", got, err)
+	}
+}
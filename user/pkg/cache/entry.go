@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/swarit-pandey/e-commerce/user/pkg/repository"
+)
+
+// cachedUser is the form users are cached in. The JSON form of repository.User is the one
+// of the API, which hides the tenant. The password hash is not cached at all, credentials
+// are always checked against the repository, see GetUserCredentials.
+type cachedUser struct {
+	ID        uint            `json:"id"`
+	TenantID  string          `json:"tenant_id"`
+	Username  string          `json:"username"`
+	Email     string          `json:"email"`
+	Name      string          `json:"name"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Version   uint            `json:"version"`
+	Addresses []cachedAddress `json:"addresses"`
+}
+
+// cachedAddress is the form addresses are cached in, keeping the tenant and the user
+type cachedAddress struct {
+	ID           uint      `json:"id"`
+	TenantID     string    `json:"tenant_id"`
+	UserID       uint      `json:"user_id"`
+	AddressLine1 string    `json:"address_line1"`
+	AddressLine2 string    `json:"address_line2"`
+	City         string    `json:"city"`
+	State        string    `json:"state"`
+	Country      string    `json:"country"`
+	PostalCode   string    `json:"postal_code"`
+	IsPrimary    bool      `json:"is_primary"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Version      uint      `json:"version"`
+}
+
+func newCachedUser(user repository.User) cachedUser {
+	cached := cachedUser{
+		ID:        user.ID,
+		TenantID:  user.TenantID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Name:      user.Name,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Version:   user.Version,
+	}
+	for _, addr := range user.Addresses {
+		cached.Addresses = append(cached.Addresses, newCachedAddress(addr))
+	}
+	return cached
+}
+
+func (c cachedUser) user() *repository.User {
+	user := &repository.User{
+		ID:        c.ID,
+		TenantID:  c.TenantID,
+		Username:  c.Username,
+		Email:     c.Email,
+		Name:      c.Name,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Version:   c.Version,
+	}
+	for _, addr := range c.Addresses {
+		user.Addresses = append(user.Addresses, *addr.address())
+	}
+	return user
+}
+
+func newCachedAddress(addr repository.UserAddress) cachedAddress {
+	return cachedAddress{
+		ID:           addr.ID,
+		TenantID:     addr.TenantID,
+		UserID:       addr.UserID,
+		AddressLine1: addr.AddressLine1,
+		AddressLine2: addr.AddressLine2,
+		City:         addr.City,
+		State:        addr.State,
+		Country:      addr.Country,
+		PostalCode:   addr.PostalCode,
+		IsPrimary:    addr.IsPrimary,
+		CreatedAt:    addr.CreatedAt,
+		UpdatedAt:    addr.UpdatedAt,
+		Version:      addr.Version,
+	}
+}
+
+func (c cachedAddress) address() *repository.UserAddress {
+	return &repository.UserAddress{
+		ID:           c.ID,
+		TenantID:     c.TenantID,
+		UserID:       c.UserID,
+		AddressLine1: c.AddressLine1,
+		AddressLine2: c.AddressLine2,
+		City:         c.City,
+		State:        c.State,
+		Country:      c.Country,
+		PostalCode:   c.PostalCode,
+		IsPrimary:    c.IsPrimary,
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+		Version:      c.Version,
+	}
+}
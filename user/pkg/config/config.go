@@ -4,8 +4,12 @@ import (
 	"fmt"
 
 	confutil "github.com/swarit-pandey/e-commerce/common/conf"
+	"github.com/swarit-pandey/e-commerce/common/database"
 )
 
+// minCursorKeyLength is the minimum length of the key signing the page cursors
+const minCursorKeyLength = 32
+
 type RootConfig struct {
 	ConfigPath string
 }
@@ -21,7 +25,7 @@ func (cfg *RootConfig) Load() (*UserConfig, error) {
 
 	configLoad := Config{}
 
-	err := confutil.LoadAndUnmarhsal(cfg.ConfigPath, configLoad)
+	err := confutil.LoadAndUnmarhsal(cfg.ConfigPath, &configLoad)
 	if err != nil {
 		return nil, fmt.Errorf("notification: %v", err)
 	}
@@ -29,3 +33,52 @@ func (cfg *RootConfig) Load() (*UserConfig, error) {
 	return &configLoad.User, nil
 }
 
+// Options returns the options of the repositories built on the database. It fails unless the
+// cursor-key signing their page cursors is set, so only the commands building repositories
+// require it.
+func (d Database) Options() ([]database.Option, error) {
+	if len(d.CursorKey) < minCursorKeyLength {
+		return nil, fmt.Errorf("user: database cursor-key must be at least %d characters", minCursorKeyLength)
+	}
+	return []database.Option{database.WithCursorKey([]byte(d.CursorKey))}, nil
+}
+
+// SQLConfig maps the database section to the configuration of the common database client
+func (d Database) SQLConfig() *database.Config {
+	name := d.DBName
+	if name == "" {
+		name = d.Name
+	}
+
+	var replicas []database.Replica
+	for _, replica := range d.Replicas {
+		replicas = append(replicas, database.Replica{
+			ConnectionString: replica.Address,
+			Port:             replica.Port,
+		})
+	}
+
+	return &database.Config{
+		Driver:             d.Driver,
+		ConnectionString:   d.Address,
+		Port:               d.Port,
+		Username:           d.Username,
+		Password:           d.Password,
+		MaxOpenConnections: d.MaxConnPool,
+		MaxIdleConnections: d.MaxConnPool,
+		SSLMode:            d.SSL,
+		SSLRootCert:        d.SSLRootCert,
+		SSLCert:            d.SSLCert,
+		SSLKey:             d.SSLKey,
+		ConnMaxLifetime:    d.ConnMaxLifetime,
+		ConnMaxIdleTime:    d.ConnMaxIdleTime,
+		DialTimeout:        d.DialTimeout,
+		StatementTimeout:   d.StatementTimeout,
+		ConnectAttempts:    d.ConnectAttempts,
+		SchemaName:         d.SchemaName,
+		DBName:             name,
+		Replicas:           replicas,
+		Observability:      &database.Observability{SlowThreshold: d.SlowQueryThreshold},
+		Audit:              true,
+	}
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type Config struct {
 	User UserConfig `mapstructure:"user"`
 }
@@ -43,10 +45,15 @@ type Broker struct {
 }
 
 type Cache struct {
-	Address   string `mapstructure:"address"`
-	Port      int    `mapstructure:"port"`
-	LogLevel  string `mapstructure:"driver"`
-	Namespace string `mapstructure:"namespace"`
+	Backend    string `mapstructure:"backend"`
+	Address    string `mapstructure:"address"`
+	Port       int    `mapstructure:"port"`
+	LogLevel   string `mapstructure:"driver"`
+	Namespace  string `mapstructure:"namespace"`
+	Password   string `mapstructure:"password"`
+	DB         int    `mapstructure:"db"`
+	MaxEntries int    `mapstructure:"maxEntries"`
+	MaxBytes   int64  `mapstructure:"maxBytes"`
 }
 
 type Database struct {
@@ -61,4 +68,27 @@ type Database struct {
 	MaxConnPool int    `mapstructure:"maxconnpool"`
 	SchemaName  string `mapstructure:"schema-name"`
 	DBName      string `mapstructure:"db-name"`
+	SSLRootCert string `mapstructure:"ssl-root-cert"`
+	SSLCert     string `mapstructure:"ssl-cert"`
+	SSLKey      string `mapstructure:"ssl-key"`
+
+	ConnMaxLifetime  time.Duration `mapstructure:"conn-max-lifetime"`
+	ConnMaxIdleTime  time.Duration `mapstructure:"conn-max-idle-time"`
+	DialTimeout      time.Duration `mapstructure:"dial-timeout"`
+	StatementTimeout time.Duration `mapstructure:"statement-timeout"`
+	ConnectAttempts  int           `mapstructure:"connect-attempts"`
+
+	// SlowQueryThreshold logs the statements running for longer, zero disables the log
+	SlowQueryThreshold time.Duration `mapstructure:"slow-query-threshold"`
+
+	// CursorKey signs the page cursors handed out by the repositories, it is required to serve
+	// (but not to migrate) and must be shared by all the replicas of the service
+	CursorKey string `mapstructure:"cursor-key"`
+
+	Replicas []Replica `mapstructure:"replicas"`
+}
+
+type Replica struct {
+	Address string `mapstructure:"address"`
+	Port    string `mapstructure:"port"`
 }
@@ -2,7 +2,6 @@ package repository
 
 import (
 	"context"
-	"errors"
 
 	"github.com/swarit-pandey/e-commerce/common/database"
 	"gorm.io/gorm"
@@ -22,17 +21,24 @@ type addressRepo struct {
 	handler *database.SQLHandler[UserAddress]
 }
 
-func NewAddressRepo(db *gorm.DB) AddressRepo {
+func NewAddressRepo(db *gorm.DB, opts ...database.Option) AddressRepo {
 	return &addressRepo{
 		db:      db,
-		handler: database.NewSQLHandler[UserAddress](db),
+		handler: database.NewSQLHandler[UserAddress](db, append(opts, retryDeadlocks)...),
+	}
+}
+
+func newTxAddressRepo(tx *database.Tx, opts ...database.Option) AddressRepo {
+	return &addressRepo{
+		db:      tx.Instance(),
+		handler: database.TxHandler[UserAddress](tx, opts...),
 	}
 }
 
 func (ar *addressRepo) Create(ctx context.Context, request *UserAddress) (*UserAddress, error) {
 	err := ar.handler.Create(ctx, request)
 	if err != nil {
-		return nil, errors.Join(ErrCreate, err)
+		return nil, wrap(ErrCreate, err)
 	}
 
 	return request, nil
@@ -48,7 +54,7 @@ func (ar *addressRepo) Get(ctx context.Context, request *UserAddress) (*UserAddr
 
 	resp, err := ar.handler.Get(ctx, qf, nil)
 	if err != nil {
-		return nil, errors.Join(ErrRead, err)
+		return nil, wrap(ErrRead, err)
 	}
 
 	return resp, nil
@@ -68,14 +74,16 @@ func (ar *addressRepo) Update(ctx context.Context, request *UserAddress) (*UserA
 			"country":       request.Country,
 			"postal_code":   request.PostalCode,
 			"is_primary":    request.IsPrimary,
+			"version":       request.Version,
 		},
 	}
 
 	err := ar.handler.Update(ctx, qf)
 	if err != nil {
-		return nil, errors.Join(ErrUpdate, err)
+		return nil, wrap(ErrUpdate, err)
 	}
 
+	request.Version++
 	return request, nil
 }
 
@@ -89,7 +97,7 @@ func (ar *addressRepo) Delete(ctx context.Context, request *UserAddress) (*UserA
 
 	err := ar.handler.Delete(ctx, qf)
 	if err != nil {
-		return nil, errors.Join(ErrDelete, err)
+		return nil, wrap(ErrDelete, err)
 	}
 
 	return request, nil
@@ -105,7 +113,7 @@ func (ar *addressRepo) Exists(ctx context.Context, request *UserAddress) (bool,
 	ok, err := ar.handler.Exists(ctx, qf)
 	if err != nil {
 		// This should not be false ideally, but lets for now lets return false
-		return false, errors.Join(ErrExists, err)
+		return false, wrap(ErrExists, err)
 	}
 
 	if !ok {
@@ -1,6 +1,10 @@
 package repository
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+)
 
 var (
 	ErrCreate        = errors.New("failed to add entity")
@@ -10,4 +14,18 @@ var (
 	ErrList          = errors.New("failed to list entity")
 	ErrExists        = errors.New("failed to check if entity exists")
 	ErrDoesNotExists = errors.New("entity does not exists")
+	ErrAlreadyExists = errors.New("entity already exists")
 )
+
+// wrap joins the error of a failed operation with its cause, adding ErrAlreadyExists or
+// ErrDoesNotExists when the database reported why it failed
+func wrap(op, err error) error {
+	switch {
+	case errors.Is(err, database.ErrUniqueViolation):
+		return errors.Join(op, ErrAlreadyExists, err)
+	case errors.Is(err, database.ErrNotFound):
+		return errors.Join(op, ErrDoesNotExists, err)
+	default:
+		return errors.Join(op, err)
+	}
+}
@@ -1,20 +1,33 @@
 package repository
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
-	ID           uint          `gorm:"primaryKey" json:"id"`
-	Username     string        `gorm:"uniqueIndex" json:"username"`
-	Email        string        `gorm:"uniqueIndex" json:"email"`
-	PasswordHash string        `json:"-"`
-	Name         string        `json:"name"`
-	CreatedAt    time.Time     `json:"created_at"`
-	UpdatedAt    time.Time     `json:"updated_at"`
-	Addresses    []UserAddress `gorm:"foreignKey:UserID" json:"addresses"`
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	TenantID     string         `gorm:"size:64;not null;uniqueIndex:idx_users_username,priority:1;uniqueIndex:idx_users_email,priority:1" json:"-"`
+	Username     string         `gorm:"uniqueIndex:idx_users_username,priority:2,where:deleted_at IS NULL" json:"username"`
+	Email        string         `gorm:"uniqueIndex:idx_users_email,priority:2,where:deleted_at IS NULL" json:"email"`
+	PasswordHash string         `audit:"redact" json:"-"`
+	Name         string         `json:"name"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	Version      uint           `gorm:"not null;default:0" json:"version"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	Addresses    []UserAddress  `gorm:"foreignKey:UserID" json:"addresses"`
+}
+
+// AuditType implements database.Auditable, the writes to users are recorded in the audit trail
+func (User) AuditType() string {
+	return "user"
 }
 
 type UserAddress struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
+	TenantID     string    `gorm:"size:64;not null;index" json:"-"`
 	UserID       uint      `json:"-"`
 	AddressLine1 string    `json:"address_line1"`
 	AddressLine2 string    `json:"address_line2"`
@@ -25,4 +38,10 @@ type UserAddress struct {
 	IsPrimary    bool      `gorm:"default:false" json:"is_primary"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	Version      uint      `gorm:"not null;default:0" json:"version"`
+}
+
+// Models returns the models persisted by the user service
+func Models() []any {
+	return []any{&User{}, &UserAddress{}}
 }
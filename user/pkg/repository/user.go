@@ -2,7 +2,6 @@ package repository
 
 import (
 	"context"
-	"errors"
 
 	"github.com/swarit-pandey/e-commerce/common/database"
 	"gorm.io/gorm"
@@ -16,33 +15,79 @@ type UserRepo interface {
 	GetByUsername(ctx context.Context, request *User) (*User, error)
 	Update(ctx context.Context, request *User) (*User, error)
 	Delete(ctx context.Context, request *User) (*User, error)
+
+	// RunInTx runs fn in a single transaction, the user and address repositories
+	// handed to fn are bound to it so their writes commit or roll back together
+	RunInTx(ctx context.Context, fn func(users UserRepo, addresses AddressRepo) error) error
+}
+
+// retryDeadlocks retries the operations of the repositories failing with deadlocks or
+// serialization failures, rather than failing the request
+var retryDeadlocks = database.WithRetryPolicy(database.DefaultRetryPolicy())
+
+// listLimit caps the users returned by List, which are read in batches of listBatchSize
+const (
+	listLimit     = 1000
+	listBatchSize = 100
+)
+
+// addressesPreload loads the addresses of a user, primary address first
+var addressesPreload = []database.Preload{
+	{Association: "Addresses", OrderBy: "is_primary DESC, id"},
 }
 
 type userRepo struct {
 	db      *gorm.DB
 	handler *database.SQLHandler[User]
+
+	// opts are handed down to the repositories bound to a transaction
+	opts []database.Option
 }
 
-func NewUserRepo(db *gorm.DB) UserRepo {
+func NewUserRepo(db *gorm.DB, opts ...database.Option) UserRepo {
 	return &userRepo{
 		db:      db,
-		handler: database.NewSQLHandler[User](db),
+		handler: database.NewSQLHandler[User](db, append(opts, retryDeadlocks)...),
+		opts:    opts,
+	}
+}
+
+func newTxUserRepo(tx *database.Tx, opts ...database.Option) UserRepo {
+	return &userRepo{
+		db:      tx.Instance(),
+		handler: database.TxHandler[User](tx, opts...),
+		opts:    opts,
 	}
 }
 
+func (ur *userRepo) RunInTx(ctx context.Context, fn func(users UserRepo, addresses AddressRepo) error) error {
+	return ur.handler.RunInTx(ctx, func(tx *database.Tx) error {
+		return fn(newTxUserRepo(tx, ur.opts...), newTxAddressRepo(tx, ur.opts...))
+	})
+}
+
 func (ur *userRepo) Create(ctx context.Context, request *User) (*User, error) {
 	err := ur.handler.Create(ctx, request)
 	if err != nil {
-		return nil, errors.Join(ErrCreate, err)
+		return nil, wrap(ErrCreate, err)
 	}
 
 	return request, nil
 }
 
 func (ur *userRepo) List(ctx context.Context, request *User) ([]User, error) {
-	resp, err := ur.handler.All(ctx)
+	qf := database.QueryFilter{
+		OrderBy: "id",
+		Limit:   listLimit,
+	}
+
+	var resp []User
+	err := ur.handler.ForEach(ctx, qf, listBatchSize, func(user *User) error {
+		resp = append(resp, *user)
+		return nil
+	})
 	if err != nil || len(resp) == 0 {
-		return nil, errors.Join(ErrList, err)
+		return nil, wrap(ErrList, err)
 	}
 
 	return resp, nil
@@ -58,7 +103,7 @@ func (ur *userRepo) Exists(ctx context.Context, request *User) (bool, error) {
 
 	exists, err := ur.handler.Exists(ctx, qf)
 	if err != nil {
-		return false, errors.Join(ErrExists, err)
+		return false, wrap(ErrExists, err)
 	}
 
 	return exists, nil
@@ -69,11 +114,12 @@ func (ur *userRepo) Get(ctx context.Context, request *User) (*User, error) {
 		WhereMap: map[string]any{
 			"id": request.ID,
 		},
+		Preload: addressesPreload,
 	}
 
 	resp, err := ur.handler.Get(ctx, qf, nil)
 	if err != nil {
-		return nil, errors.Join(ErrRead, err)
+		return nil, wrap(ErrRead, err)
 	}
 
 	return resp, nil
@@ -84,11 +130,12 @@ func (ur *userRepo) GetByUsername(ctx context.Context, request *User) (*User, er
 		WhereMap: map[string]any{
 			"username": request.Username,
 		},
+		Preload: addressesPreload,
 	}
 
 	resp, err := ur.handler.Get(ctx, qf, nil)
 	if err != nil {
-		return nil, errors.Join(ErrRead, err)
+		return nil, wrap(ErrRead, err)
 	}
 	return resp, nil
 }
@@ -99,16 +146,18 @@ func (ur *userRepo) Update(ctx context.Context, request *User) (*User, error) {
 			"id": request.ID,
 		},
 		UpdateMap: map[string]any{
-			"name":  request.Name,
-			"email": request.Email,
+			"name":    request.Name,
+			"email":   request.Email,
+			"version": request.Version,
 		},
 	}
 
 	err := ur.handler.Update(ctx, qf)
 	if err != nil {
-		return nil, errors.Join(ErrUpdate, err)
+		return nil, wrap(ErrUpdate, err)
 	}
 
+	request.Version++
 	return request, nil
 }
 
@@ -121,7 +170,7 @@ func (ur *userRepo) Delete(ctx context.Context, request *User) (*User, error) {
 
 	err := ur.handler.Delete(ctx, qf)
 	if err != nil {
-		return nil, errors.Join(ErrDelete, err)
+		return nil, wrap(ErrDelete, err)
 	}
 
 	return request, nil
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+)
+
+func newTestRepos(t *testing.T) (UserRepo, AddressRepo) {
+	db := databasetest.New(t, Models()...).Instance()
+	return NewUserRepo(db), NewAddressRepo(db)
+}
+
+func TestRunInTx(t *testing.T) {
+	ctx := database.WithTenant(context.Background(), "acme")
+	users, addresses := newTestRepos(t)
+
+	errAbort := errors.New("abort")
+	err := users.RunInTx(ctx, func(users UserRepo, addresses AddressRepo) error {
+		user, err := users.Create(ctx, &User{Username: "ada", Email: "ada@example.com"})
+		if err != nil {
+			return err
+		}
+		_, err = addresses.Create(ctx, &UserAddress{UserID: user.ID, City: "London"})
+		if err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("rolled back transaction: got %v, want %v", err, errAbort)
+	}
+	exists, err := users.Exists(ctx, &User{Username: "ada", Email: "ada@example.com"})
+	if err != nil || exists {
+		t.Fatalf("user of a rolled back transaction: exists %v, %v", exists, err)
+	}
+
+	var userID, addressID uint
+	err = users.RunInTx(ctx, func(users UserRepo, addresses AddressRepo) error {
+		user, err := users.Create(ctx, &User{Username: "ada", Email: "ada@example.com"})
+		if err != nil {
+			return err
+		}
+		address, err := addresses.Create(ctx, &UserAddress{UserID: user.ID, City: "London"})
+		if err != nil {
+			return err
+		}
+		userID, addressID = user.ID, address.ID
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("committed transaction: %v", err)
+	}
+
+	user, err := users.Get(ctx, &User{ID: userID})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if len(user.Addresses) != 1 || user.Addresses[0].ID != addressID {
+		t.Errorf("addresses of the committed user: got %+v", user.Addresses)
+	}
+	if _, err := addresses.Get(ctx, &UserAddress{ID: addressID, UserID: userID}); err != nil {
+		t.Errorf("get address: %v", err)
+	}
+}
+
+func TestVersionedUpdate(t *testing.T) {
+	ctx := database.WithTenant(context.Background(), "acme")
+	users, addresses := newTestRepos(t)
+
+	user, err := users.Create(ctx, &User{Username: "ada", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	stale := *user
+
+	user.Name = "Ada Lovelace"
+	user, err = users.Update(ctx, user)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if user.Version != 1 {
+		t.Errorf("version after update: got %d, want 1", user.Version)
+	}
+
+	stale.Name = "Ada Byron"
+	_, err = users.Update(ctx, &stale)
+	if !errors.Is(err, database.ErrConcurrentModification) || !errors.Is(err, ErrUpdate) {
+		t.Errorf("update of a stale version: got %v, want ErrConcurrentModification", err)
+	}
+
+	got, err := users.Get(ctx, &User{ID: user.ID})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Name != "Ada Lovelace" || got.Version != 1 {
+		t.Errorf("user after a stale update: got %q at version %d", got.Name, got.Version)
+	}
+
+	address, err := addresses.Create(ctx, &UserAddress{UserID: user.ID, City: "London"})
+	if err != nil {
+		t.Fatalf("create address: %v", err)
+	}
+	staleAddress := *address
+
+	address.City = "Paris"
+	if _, err := addresses.Update(ctx, address); err != nil {
+		t.Fatalf("update address: %v", err)
+	}
+	_, err = addresses.Update(ctx, &staleAddress)
+	if !errors.Is(err, database.ErrConcurrentModification) {
+		t.Errorf("update of a stale address: got %v, want ErrConcurrentModification", err)
+	}
+}
+
+// List reads the users in batches and stops at listLimit, rather than loading the whole table
+func TestListLimit(t *testing.T) {
+	ctx := database.WithTenant(context.Background(), "acme")
+	users, _ := newTestRepos(t)
+
+	if _, err := users.List(ctx, &User{}); !errors.Is(err, ErrList) {
+		t.Errorf("list of no users: got %v, want ErrList", err)
+	}
+
+	for i := 0; i <= listLimit; i++ {
+		name := fmt.Sprintf("user-%d", i)
+		if _, err := users.Create(ctx, &User{Username: name, Email: name + "@example.com"}); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+
+	got, err := users.List(ctx, &User{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(got) != listLimit {
+		t.Fatalf("listed users: got %d, want %d", len(got), listLimit)
+	}
+	for i, user := range got {
+		if want := fmt.Sprintf("user-%d", i); user.Username != want {
+			t.Fatalf("user %d: got %q, want %q", i, user.Username, want)
+		}
+	}
+}
+
+// The username and email of a soft deleted user may be taken again, restoring the user then
+// conflicts with the new one
+func TestRestoreReusedEmail(t *testing.T) {
+	databasetest.RunBackends(t, Models(), nil, func(t *testing.T, newRepository func(t *testing.T) database.Repository[User]) {
+		ctx := database.WithTenant(context.Background(), "acme")
+		repo := newRepository(t)
+
+		deleted := User{Username: "ada", Email: "ada@example.com"}
+		if err := repo.Create(ctx, &deleted); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if err := repo.Delete(ctx, database.QueryFilter{WhereMap: map[string]any{"id": deleted.ID}}); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if err := repo.Create(ctx, &User{Username: "ada", Email: "ada@example.com"}); err != nil {
+			t.Fatalf("create with the username of a deleted user: %v", err)
+		}
+		if err := repo.Create(ctx, &User{Username: "ada", Email: "lovelace@example.com"}); !errors.Is(err, database.ErrUniqueViolation) {
+			t.Errorf("create with the username of a live user: got %v, want ErrUniqueViolation", err)
+		}
+		other := database.WithTenant(context.Background(), "globex")
+		if err := repo.Create(other, &User{Username: "ada", Email: "ada@example.com"}); err != nil {
+			t.Errorf("create with the username of a user of another tenant: %v", err)
+		}
+
+		err := repo.Restore(ctx, database.QueryFilter{WhereMap: map[string]any{"id": deleted.ID}})
+		if !errors.Is(err, database.ErrRestoreConflict) || !errors.Is(err, database.ErrUniqueViolation) {
+			t.Errorf("restore: got %v, want ErrRestoreConflict", err)
+		}
+		remaining, err := repo.ListDeleted(ctx, database.QueryFilter{}, nil)
+		if err != nil || len(remaining) != 1 {
+			t.Errorf("deleted users after a failed restore: got %d, %v", len(remaining), err)
+		}
+	})
+}
+
+// The unique indexes of the users only cover the live ones, an upsert on them inserts the
+// users whose key is only taken by a soft deleted user
+func TestUpsertLiveUsers(t *testing.T) {
+	databasetest.RunBackends(t, Models(), nil, func(t *testing.T, newRepository func(t *testing.T) database.Repository[User]) {
+		ctx := database.WithTenant(context.Background(), "acme")
+		repo := newRepository(t)
+
+		deleted := User{Username: "ada", Email: "ada@example.com"}
+		live := User{Username: "grace", Email: "grace@example.com"}
+		for _, user := range []*User{&deleted, &live} {
+			if err := repo.Create(ctx, user); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+		}
+		if err := repo.Delete(ctx, database.QueryFilter{WhereMap: map[string]any{"id": deleted.ID}}); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+
+		users := []User{{Username: "lovelace", Email: "ada@example.com"}, {Username: "hopper", Email: "grace@example.com"}}
+		result, err := repo.Upsert(ctx, users, []string{"tenant_id", "email"}, []string{"username"})
+		if err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+		if result.Inserted != 1 || result.Updated != 1 {
+			t.Errorf("upsert: got %+v, want 1 inserted and 1 updated", result)
+		}
+		if users[0].ID == deleted.ID || users[1].ID != live.ID {
+			t.Errorf("upserted ids: got %d and %d, want a new one and %d", users[0].ID, users[1].ID, live.ID)
+		}
+
+		remaining, err := repo.ListDeleted(ctx, database.QueryFilter{}, nil)
+		if err != nil || len(remaining) != 1 || remaining[0].Username != "ada" {
+			t.Errorf("deleted users after the upsert: got %+v, %v", remaining, err)
+		}
+	})
+}
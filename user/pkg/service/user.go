@@ -97,7 +97,8 @@ func (us *userService) LoginUser(ctx context.Context, request *httpapi.UserLogin
 		return response, errors.Join(ErrInvalidPassword, err)
 	}
 
-	user, err := us.cacheService.GetUserByUsername(ctx, request.Username)
+	// The password hash is not cached, so the user is read from the repository
+	user, err := us.cacheService.GetUserCredentials(ctx, request.Username)
 	if err != nil {
 		return response, errors.Join(ErrGettingFromCache, err)
 	}
@@ -385,7 +386,7 @@ func validateUsername(username string) error {
 }
 
 func hashPassword(password string) (string, error) {
-	hashed, err := aerobcrypt.Hash(password, "encode")
+	hashed, err := aerobcrypt.Hash(password)
 	if err != nil {
 		return "", errors.New("failed to hash password")
 	}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/swarit-pandey/e-commerce/common/cache"
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/common/database/databasetest"
+	httpapi "github.com/swarit-pandey/e-commerce/user/api/http/server"
+	servicecache "github.com/swarit-pandey/e-commerce/user/pkg/cache"
+	"github.com/swarit-pandey/e-commerce/user/pkg/config"
+	"github.com/swarit-pandey/e-commerce/user/pkg/repository"
+)
+
+// Logins check the password against the repository, the cached users carry no hash
+func TestLoginWithWarmCache(t *testing.T) {
+	ctx := database.WithTenant(context.Background(), "acme")
+	db := databasetest.New(t, repository.Models()...).Instance()
+
+	cs, err := servicecache.NewCacheService(&config.Cache{Backend: cache.BackendMemory},
+		repository.User{}, repository.NewUserRepo(db), repository.UserAddress{}, repository.NewAddressRepo(db))
+	if err != nil {
+		t.Fatalf("new cache service: %v", err)
+	}
+	users := NewUserService(cs)
+
+	name := "Ada Lovelace"
+	_, err = users.CreateUser(ctx, &httpapi.UserRegistrationRequest{
+		Username: "ada.lovelace",
+		Email:    "ada@example.com",
+		Name:     &name,
+		Password: "Analytical1!",
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if cached, err := cs.GetUserByUsername(ctx, "ada.lovelace"); err != nil || cached.PasswordHash != "" {
+		t.Fatalf("cached user: got %+v, %v, want no password hash", cached, err)
+	}
+
+	resp, err := users.LoginUser(ctx, &httpapi.UserLoginRequest{Username: "ada.lovelace", Password: "Analytical1!"})
+	if err != nil || resp.AccessToken == nil {
+		t.Errorf("login: got %+v, %v", resp, err)
+	}
+	_, err = users.LoginUser(ctx, &httpapi.UserLoginRequest{Username: "ada.lovelace", Password: "Analytical2!"})
+	if !errors.Is(err, ErrPasswordMatch) {
+		t.Errorf("login with a wrong password: got %v, want ErrPasswordMatch", err)
+	}
+}
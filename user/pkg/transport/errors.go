@@ -0,0 +1,31 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/swarit-pandey/e-commerce/common/database"
+	"github.com/swarit-pandey/e-commerce/user/pkg/repository"
+)
+
+// errorStatus maps an error returned by the user service to its HTTP status code
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrConcurrentModification):
+		// The client should reload the resource and retry its change
+		return http.StatusConflict
+	case errors.Is(err, repository.ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, database.ErrTenantRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrTenantMismatch):
+		return http.StatusForbidden
+	case errors.Is(err, repository.ErrDoesNotExists):
+		return http.StatusNotFound
+	case database.IsRetryableOrLocked(err):
+		// Retries were exhausted, the request may succeed later
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,15 +1,17 @@
 package transport
 
 import (
-	"context"
+	"expvar"
 	"net/http"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/swarit-pandey/e-commerce/common/database"
 	httpapi "github.com/swarit-pandey/e-commerce/user/api/http/server"
 	"github.com/swarit-pandey/e-commerce/user/pkg/service"
 )
 
+var _ httpapi.ServerInterface = &Handler{}
+
 type Handler struct {
 	userService service.UserService
 }
@@ -28,9 +30,9 @@ func (h *Handler) PostUsers(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.userService.CreateUser(context.Background(), &req)
+	resp, err := h.userService.CreateUser(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -44,9 +46,9 @@ func (h *Handler) PostUsersLogin(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.userService.LoginUser(context.Background(), &req)
+	resp, err := h.userService.LoginUser(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -61,9 +63,9 @@ func (h *Handler) PostUsersPasswordReset(c *gin.Context) {
 		return
 	}
 
-	err := h.userService.InitiatePasswordReset(context.Background(), &req)
+	err := h.userService.InitiatePasswordReset(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -78,9 +80,9 @@ func (h *Handler) PutUsersPasswordReset(c *gin.Context) {
 		return
 	}
 
-	err := h.userService.UpdatePassword(context.Background(), &req)
+	err := h.userService.UpdatePassword(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -89,9 +91,9 @@ func (h *Handler) PutUsersPasswordReset(c *gin.Context) {
 
 // GetUsersUserId gets a user profile
 func (h *Handler) GetUsersUserId(c *gin.Context, userID int) {
-	resp, err := h.userService.GetUserProfile(context.Background(), uint(userID))
+	resp, err := h.userService.GetUserProfile(c.Request.Context(), uint(userID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -111,9 +113,9 @@ func (h *Handler) PostUsersUserId(c *gin.Context, userID int) {
 		return
 	}
 
-	err := h.userService.AddUserProfile(context.Background(), &reqProfile, &reqAddress)
+	err := h.userService.AddUserProfile(c.Request.Context(), &reqProfile, &reqAddress)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -122,9 +124,9 @@ func (h *Handler) PostUsersUserId(c *gin.Context, userID int) {
 
 // DeleteUsersUserIdAddressesAddressId deletes a user address
 func (h *Handler) DeleteUsersUserIdAddressesAddressId(c *gin.Context, userID int, addressID int) {
-	err := h.userService.DeleteUserAddress(context.Background(), uint(userID), uint(addressID))
+	err := h.userService.DeleteUserAddress(c.Request.Context(), uint(userID), uint(addressID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -132,30 +134,49 @@ func (h *Handler) DeleteUsersUserIdAddressesAddressId(c *gin.Context, userID int
 }
 
 // PutUsersUserIdAddressesAddressId updates a user address
-func (h *Handler) PutUsersUserIdAddressesAddressId(c *gin.Context) {
-	userId, err := strconv.Atoi(c.Param("userId"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
-		return
-	}
-
-	_, err = strconv.Atoi(c.Param("addressId"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
-		return
-	}
-
+func (h *Handler) PutUsersUserIdAddressesAddressId(c *gin.Context, userID int, addressID int) {
 	var req httpapi.Address
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	err = h.userService.UpdateUserAddress(context.Background(), uint(userId), &req)
+	err := h.userService.UpdateUserAddress(c.Request.Context(), uint(userID), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User address updated"})
 }
+
+// RegisterHealth serves the health check of db on /healthz and the statistics of its
+// connection pools on /debug/vars, see database.PublishStats
+func RegisterHealth(router gin.IRouter, db database.SQLDatabase) {
+	router.GET("/healthz", gin.WrapH(database.HealthHandler(db)))
+	router.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+}
+
+// AuditContext attributes the writes made by the handlers to the actor and request ID of
+// the request, see database.AuditRequest, and echoes the request ID in the response
+func AuditContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestID string
+		c.Request, requestID = database.AuditRequest(c.Request)
+		c.Header(database.RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// TenantContext scopes the handlers to the tenant of the request, see database.TenantRequest,
+// and rejects the requests without one
+func TenantContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, err := database.TenantRequest(c.Request)
+		if err != nil {
+			c.AbortWithStatusJSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.Request = r
+	}
+}